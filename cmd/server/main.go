@@ -2,24 +2,44 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"slices"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/expvar"
 	"github.com/gofiber/fiber/v2/middleware/healthcheck"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
-	"github.com/gofiber/fiber/v2/middleware/proxy"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/redis/go-redis/v9"
 	"github.com/redis/go-redis/v9/maintnotifications"
 	slogfiber "github.com/samber/slog-fiber"
+	"github.com/schnurbus/go-mcp-gateway/internal/aggregate"
 	"github.com/schnurbus/go-mcp-gateway/internal/auth"
 	"github.com/schnurbus/go-mcp-gateway/internal/config"
 	"github.com/schnurbus/go-mcp-gateway/internal/handler"
+	"github.com/schnurbus/go-mcp-gateway/internal/keyset"
 	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+	"github.com/schnurbus/go-mcp-gateway/internal/mcpsession"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/adminauth"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/challenge"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/gatewaytoken"
 	"github.com/schnurbus/go-mcp-gateway/internal/middleware/googletokenvalidator"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/identity"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/tokenauth"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider/dev"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider/github"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider/google"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider/oidc"
+	"github.com/schnurbus/go-mcp-gateway/internal/proxy"
+	"github.com/schnurbus/go-mcp-gateway/internal/stdio"
+	"github.com/schnurbus/go-mcp-gateway/internal/store"
+	"github.com/schnurbus/go-mcp-gateway/internal/tokenvalidator"
+	"github.com/schnurbus/go-mcp-gateway/internal/vault"
 )
 
 func main() {
@@ -41,11 +61,89 @@ func main() {
 		},
 	})
 
+	// Load JWT signing keys
+	var keySet *keyset.KeySet
+	if cfg.SigningKeyFiles != "" {
+		keySet, err = keyset.Load(config.SplitList(cfg.SigningKeyFiles))
+		if err != nil {
+			log.Fatalf("could not load signing keys: %v", err)
+		}
+	}
+
+	// Every proxied MCP server is a resource tokens can be bound to. Clients
+	// may request its scopes, and its Google scopes after an insufficient
+	// scope challenge.
+	resources := make([]string, 0, len(proxies))
+	scopes := make(map[string][]string, len(proxies))
+	for _, p := range proxies {
+		resources = append(resources, p.Resource)
+		scopes[p.Resource] = append(slices.Clone(p.Scopes), p.GoogleScopes...)
+	}
+
+	// Upstream identity providers, registered once the callback URL is known
+	upstreams := provider.NewRegistry()
+
+	// Create the vault of the upstream tokens, it refreshes them at the
+	// upstream providers
+	vaultKeys, err := vault.ParseKeys(config.SplitList(cfg.VaultKeys))
+	if err != nil {
+		log.Fatalf("could not load vault keys: %v", err)
+	}
+	if len(vaultKeys) == 0 {
+		mainLogger.Warn("No vault keys configured, generated a development key, upstream tokens are lost on restart")
+		key, err := vault.GenerateKey()
+		if err != nil {
+			log.Fatalf("could not generate vault key: %v", err)
+		}
+		vaultKeys = append(vaultKeys, key)
+	}
+	vault, err := vault.NewVault(&vault.VaultConfig{
+		Keys:          vaultKeys,
+		Refresher:     upstreams,
+		RefreshBefore: cfg.VaultRefreshBefore,
+	}, rdb)
+	if err != nil {
+		log.Fatalf("could not create vault: %v", err)
+	}
+
 	// Create Auth
-	auth := auth.NewAuth(cfg.BaseURL, rdb)
+	auth := auth.NewAuth(&auth.AuthConfig{
+		BaseURL:              cfg.BaseURL,
+		AccessTokenFormat:    cfg.AccessTokenFormat,
+		KeySet:               keySet,
+		Resources:            resources,
+		Scopes:               scopes,
+		Vault:                vault,
+		IntrospectionClients: config.SplitList(cfg.IntrospectionClientIDs),
+	}, rdb)
+
+	for _, name := range cfg.Providers {
+		upstream, err := newUpstreamProvider(ctx, rdb, cfg, auth.GetCallbackURL(), name)
+		if err != nil {
+			log.Fatalf("could not create upstream provider: %v", err)
+		}
+		upstreams.Register(name, upstream)
+	}
+
+	// Cache Google tokeninfo lookups of the proxied requests
+	var tokenInfoCache *googletokenvalidator.Cache
+	if cfg.TokenInfoCacheSize > 0 || cfg.TokenInfoCacheRedis {
+		cacheConfig := &googletokenvalidator.CacheConfig{
+			Size:        cfg.TokenInfoCacheSize,
+			MaxTTL:      cfg.TokenInfoCacheMaxTTL,
+			NegativeTTL: cfg.TokenInfoCacheNegativeTTL,
+		}
+		if cfg.TokenInfoCacheRedis {
+			cacheConfig.Store = store.NewStore(rdb, "tokeninfo", cfg.TokenInfoCacheMaxTTL)
+		}
+		tokenInfoCache = googletokenvalidator.NewCache(cacheConfig)
+	}
+
+	// Open MCP sessions of the proxied routes
+	sessions := mcpsession.NewRegistry(rdb)
 
 	// Create Handler
-	handler, err := handler.NewHandler(ctx, rdb, cfg, auth)
+	handler, err := handler.NewHandler(ctx, rdb, cfg, auth, upstreams, proxies, sessions)
 	if err != nil {
 		log.Fatalf("failed to create handler: %v", err)
 	}
@@ -56,8 +154,9 @@ func main() {
 	// Fiber Middleware
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     cfg.AllowedOrigins,
-		AllowMethods:     "GET, POST, OPTIONS",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, MCP-Protocol-Version",
+		AllowMethods:     "GET, POST, PUT, DELETE, OPTIONS",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, MCP-Protocol-Version, Mcp-Session-Id, Last-Event-ID",
+		ExposeHeaders:    "Mcp-Session-Id, WWW-Authenticate",
 		AllowCredentials: true,
 	}))
 	app.Use(healthcheck.New())
@@ -69,26 +168,244 @@ func main() {
 	app.Use(slogfiber.New(mainLogger))
 	app.Use(recover.New())
 	app.Use(requestid.New())
+	if cfg.ExpvarEnabled {
+		// Serves /debug/vars, including the tokeninfo cache counters
+		app.Use(expvar.New())
+	}
 
 	// Routes
-	app.Get("/.well-known/oauth-protected-resource", handler.HandleOAuthProtectedResourceMetadata)
+	app.Get(config.ProtectedResourceMetadataPath, handler.HandleOAuthProtectedResourceMetadata)
 	app.Get("/.well-known/oauth-authorization-server", handler.HandleOAuthAuthorizationServerMetadata)
+	app.Get(auth.GetJWKSPath(), handler.HandleJWKS)
 	app.Post(auth.GetDynamicRegistrationPath(), handler.HandleOAuthRegister)
+	app.Get(auth.GetClientConfigurationPath(), handler.HandleOAuthClientConfigurationRead)
+	app.Put(auth.GetClientConfigurationPath(), handler.HandleOAuthClientConfigurationUpdate)
+	app.Delete(auth.GetClientConfigurationPath(), handler.HandleOAuthClientConfigurationDelete)
 	app.Get(auth.GetAuthorizationPath(), handler.HandleOAuthAuthorize)
+	app.Get(auth.GetProviderSelectionPath(), handler.HandleOAuthProviderSelection)
 	app.Get(auth.GetCallbackPath(), handler.HandleOAuthCallback)
+	if slices.Contains(cfg.Providers, config.ProviderDev) {
+		mainLogger.Warn("Development provider is enabled, anyone can sign in as a test user")
+		app.Get(dev.LoginPath, handler.HandleDevLogin)
+		app.Post(dev.LoginPath, handler.HandleDevLoginSubmit)
+	}
 	app.Post(auth.GetTokenPath(), handler.HandleOauthToken)
+	app.Post(auth.GetIntrospectionPath(), handler.HandleOAuthIntrospect)
+	app.Post(auth.GetRevocationPath(), handler.HandleOAuthRevoke)
+	if cfg.AdminAPIKey != "" {
+		admin := app.Group("/admin", adminauth.New(cfg.AdminAPIKey))
+		admin.Get("/providers/:provider/users/:sub/sessions", handler.HandleAdminSessionsList)
+		admin.Delete("/providers/:provider/users/:sub/sessions", handler.HandleAdminSessionsTerminate)
+		admin.Delete("/providers/:provider/users/:sub/sessions/:id", handler.HandleAdminSessionsTerminate)
+	}
 
-	// Validate Google access tokens for all proxied requests
-	app.Use(googletokenvalidator.New(cfg.GoogleClientID))
-
-	// Proxies
+	// Proxies: authenticate with the token validator of the route. Google
+	// routes first swap gateway-issued access tokens bound to the route for
+	// the upstream Google access token. The identity of the token is
+	// forwarded in the route's identity headers and, if configured, a signed
+	// identity assertion. Stdio routes bridge to a launched MCP server
+	// instead. The upstream handlers are also served in-process to the
+	// aggregate routes, which are registered once the routes they aggregate
+	// are. Their authentication is left to the aggregate route, the config
+	// ensures it is at least as strict.
+	members := fiber.New()
+	type aggregateRoute struct {
+		proxy    *config.ProxyConfig
+		handlers []fiber.Handler
+	}
+	var aggregates []aggregateRoute
 	for _, p := range proxies {
-		mainLogger.Info("Register proxy", "pattern", p.Pattern, "target", p.TargetURL.String())
-		app.Get(p.Pattern, proxy.Forward(p.TargetURL.String()))
-		app.Post(p.Pattern, proxy.Forward(p.TargetURL.String()))
+		switch {
+		case len(p.Aggregate) > 0:
+			prefixes := make([]string, 0, len(p.Aggregate))
+			for _, server := range p.Aggregate {
+				prefixes = append(prefixes, server.Prefix+"="+server.Route)
+			}
+			mainLogger.Info("Register proxy", "pattern", p.Pattern, "aggregate", prefixes, "resource", p.Resource)
+		case p.Stdio != nil:
+			mainLogger.Info("Register proxy", "pattern", p.Pattern, "command", p.Stdio.Command, "mode", p.Stdio.Mode, "resource", p.Resource)
+		default:
+			mainLogger.Info("Register proxy", "pattern", p.Pattern, "targets", p.TargetURLs, "resource", p.Resource)
+		}
+		app.Get(config.ProtectedResourceMetadataPath+p.ResourcePath, handler.HandleOAuthProtectedResourceMetadata)
+
+		challengeOptions := challenge.Options{
+			ResourceMetadataURL: p.ResourceMetadataURL,
+			Scopes:              p.Scopes,
+			LegacyErrors:        p.LegacyAuthErrors,
+		}
+		validator, err := newTokenValidator(&p.Validator, p.Resource, cfg, auth, keySet, tokenInfoCache)
+		if err != nil {
+			log.Fatalf("could not create token validator for %s: %v", p.Pattern, err)
+		}
+
+		var handlers []fiber.Handler
+		if p.Validator.Type == config.ValidatorGoogle {
+			handlers = append(handlers, gatewaytoken.New(auth, p.Resource, challengeOptions))
+		}
+		identityConfig := identity.Config{
+			Headers: p.IdentityHeaders,
+		}
+		if p.IdentityAssertion != nil {
+			identityConfig.Assertion = &identity.AssertionConfig{
+				Auth:     auth,
+				Audience: p.Resource,
+				Header:   p.IdentityAssertion.Header,
+			}
+		}
+		handlers = append(handlers, tokenauth.New(tokenauth.Config{
+			Validator:      validator,
+			Challenge:      challengeOptions,
+			UpstreamScopes: p.GoogleScopes,
+		}))
+		var upstream []fiber.Handler
+		switch {
+		case len(p.Aggregate) > 0:
+			aggregates = append(aggregates, aggregateRoute{proxy: p, handlers: handlers})
+			continue
+		case p.Stdio != nil:
+			upstream = append(upstream, stdio.New(ctx, stdio.Config{
+				Server:            p.Stdio,
+				Sessions:          sessions,
+				IdleTimeout:       p.StreamIdleTimeout,
+				MaxStreamDuration: p.StreamMaxDuration,
+			}))
+		default:
+			upstream = append(upstream,
+				identity.New(identityConfig),
+				proxy.New(proxy.Config{
+					Rewrite: p.Rewrite,
+					Balancer: proxy.NewBalancer(ctx, &proxy.BalancerConfig{
+						Targets:     p.TargetURLs,
+						Policy:      p.LoadBalancing,
+						HealthCheck: p.HealthCheck,
+					}),
+					Sessions:          sessions,
+					IdleTimeout:       p.StreamIdleTimeout,
+					MaxStreamDuration: p.StreamMaxDuration,
+				}),
+			)
+		}
+		members.Get(p.Pattern, upstream...)
+		members.Post(p.Pattern, upstream...)
+		members.Delete(p.Pattern, upstream...)
+
+		// GET also serves HEAD, CORS preflights are answered by the cors
+		// middleware. DELETE ends MCP sessions.
+		handlers = append(handlers, upstream...)
+		app.Get(p.Pattern, handlers...)
+		app.Post(p.Pattern, handlers...)
+		app.Delete(p.Pattern, handlers...)
+	}
+	routes := members.Handler()
+	for _, r := range aggregates {
+		handlers := append(r.handlers, aggregate.New(aggregate.Config{
+			Servers:  r.proxy.Aggregate,
+			Routes:   routes,
+			Redis:    rdb,
+			Sessions: sessions,
+		}))
+		app.Get(r.proxy.Pattern, handlers...)
+		app.Post(r.proxy.Pattern, handlers...)
+		app.Delete(r.proxy.Pattern, handlers...)
 	}
 
 	// Server
 
 	log.Fatal(app.Listen(":8080"))
 }
+
+func newTokenValidator(
+	v *config.ValidatorConfig,
+	resource string,
+	cfg *config.Config,
+	auth *auth.Auth,
+	keySet *keyset.KeySet,
+	cache *googletokenvalidator.Cache,
+) (tokenvalidator.TokenValidator, error) {
+	switch v.Type {
+	case config.ValidatorGateway:
+		return tokenvalidator.NewGateway(auth, resource), nil
+	case config.ValidatorJWT:
+		return tokenvalidator.NewJWT(&tokenvalidator.JWTConfig{
+			Issuer:   v.Issuer,
+			Audience: v.Audience,
+			JWKSURL:  v.JWKSURL,
+			KeySet:   keySet,
+		})
+	case config.ValidatorIntrospection:
+		return tokenvalidator.NewIntrospection(&tokenvalidator.IntrospectionConfig{
+			URL:          v.IntrospectionURL,
+			ClientID:     v.ClientID,
+			ClientSecret: v.ClientSecret,
+			Audience:     v.Audience,
+		})
+	default:
+		return tokenvalidator.NewGoogle(cfg.GoogleClientID, cache), nil
+	}
+}
+
+func newUpstreamProvider(ctx context.Context, rdb *redis.Client, cfg *config.Config, callbackURL, name string) (provider.Provider, error) {
+	switch name {
+	case config.ProviderDev:
+		// The dev provider serves its own login form and needs no network
+		return dev.NewDevProvider(&dev.DevConfig{
+			Users:       config.SplitList(cfg.DevUsers),
+			LoginURL:    cfg.BaseURL + dev.LoginPath,
+			RedirectURI: callbackURL,
+		}, rdb), nil
+	case config.ProviderGitHub:
+		upstream, err := github.NewGitHubProvider(ctx, &github.GitHubConfig{
+			GitHubClientID:     cfg.GitHubClientID,
+			GitHubClientSecret: cfg.GitHubClientSecret,
+			GitHubRedirectURI:  cfg.GitHubRedirectURI,
+			GitHubScopes:       config.SplitList(cfg.GitHubScopes),
+			GitHubURL:          cfg.GitHubURL,
+			GitHubAPIURL:       cfg.GitHubAPIURL,
+		}, rdb)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create oauth github provider: %w", err)
+		}
+		return upstream, nil
+	case config.ProviderOIDC:
+		upstream, err := oidc.NewOIDCProvider(ctx, &oidc.OIDCConfig{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURI:  cfg.OIDCRedirectURI,
+			Scopes:       config.SplitList(cfg.OIDCScopes),
+			Claims: oidc.ClaimMapping{
+				Subject:       cfg.OIDCClaimSubject,
+				Email:         cfg.OIDCClaimEmail,
+				EmailVerified: cfg.OIDCClaimEmailVerified,
+				Name:          cfg.OIDCClaimName,
+			},
+		}, rdb)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create oauth oidc provider: %w", err)
+		}
+		return upstream, nil
+	default:
+		// Preselect accounts of the allowed Workspace domains
+		var hostedDomain string
+		switch hostedDomains := config.SplitList(cfg.SignInHostedDomains); len(hostedDomains) {
+		case 0:
+		case 1:
+			hostedDomain = hostedDomains[0]
+		default:
+			hostedDomain = "*"
+		}
+
+		upstream, err := google.NewGoogleProvider(ctx, &google.GoogleConfig{
+			GoogleClientID:     cfg.OAuthGoogleConfig.GoogleClientID,
+			GoogleClientSecret: cfg.OAuthGoogleConfig.GoogleClientSecret,
+			GoogleRedirectURI:  cfg.OAuthGoogleConfig.GoogleRedirectURI,
+			GoogleScopes:       config.SplitList(cfg.OAuthGoogleConfig.GoogleScopes),
+			GoogleHostedDomain: hostedDomain,
+		}, rdb)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create oauth google provider: %w", err)
+		}
+		return upstream, nil
+	}
+}
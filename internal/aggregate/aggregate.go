@@ -0,0 +1,542 @@
+package aggregate
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+	"github.com/schnurbus/go-mcp-gateway/internal/mcpsession"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/tokenauth"
+	"github.com/schnurbus/go-mcp-gateway/internal/store"
+	"github.com/schnurbus/go-mcp-gateway/internal/tokenvalidator"
+	"github.com/schnurbus/go-mcp-gateway/internal/utils"
+	"github.com/schnurbus/go-mcp-gateway/pkg/jsonrpc"
+	"github.com/valyala/fasthttp"
+)
+
+// heartbeatInterval is how often an SSE comment is sent on quiet streams.
+const heartbeatInterval = 15 * time.Second
+
+// Config configures an aggregate route.
+type Config struct {
+	// Servers are the aggregated MCP servers, the routes that serve them and
+	// their prefixes.
+	Servers []*config.AggregateServerConfig
+
+	// Routes serves the routes of the servers. They get the Authorization
+	// header and the locals of the request to the aggregate route, which
+	// already authenticated it.
+	Routes fasthttp.RequestHandler
+
+	// Redis keeps the aggregate sessions, so that every gateway serves them.
+	Redis *redis.Client
+
+	// Sessions are the sessions of the routes of the servers, which the
+	// aggregate sessions keep alive.
+	Sessions *mcpsession.Registry
+}
+
+type aggregator struct {
+	servers      []*config.AggregateServerConfig
+	routes       fasthttp.RequestHandler
+	sessionStore *store.Store // key: Mcp-Session-Id, value: session
+	registry     *mcpsession.Registry
+}
+
+// New serves several MCP servers as one. An aggregate session opens a session
+// with each server, initialize and the list methods are fanned out to them
+// and their results merged, with the tools, prompts and resources of each
+// server prefixed. Requests for a tool, prompt or resource go to the server
+// of its prefix, the messages of the servers reach the client on the
+// response, or merged on one standalone stream.
+func New(cfg Config) fiber.Handler {
+	a := &aggregator{
+		servers:      cfg.Servers,
+		routes:       cfg.Routes,
+		sessionStore: store.NewStore(cfg.Redis, "mcp_aggregate_session", store.MCPSessionTTL),
+		registry:     cfg.Sessions,
+	}
+	return a.handle
+}
+
+func (a *aggregator) handle(c *fiber.Ctx) error {
+	log := logger.FromContext(c.Context()).With(
+		slog.String("handler", "aggregate"),
+	)
+
+	var owner mcpsession.Owner
+	if principal, ok := c.Locals(tokenauth.LocalsKey).(*tokenvalidator.Principal); ok {
+		owner = mcpsession.Owner{Provider: principal.Provider, Subject: principal.Subject}
+	}
+	o := newOrigin(c)
+
+	// Sessions start with an initialize request without session id
+	sessionID := c.Get(mcpsession.Header)
+	if sessionID == "" && c.Method() == fiber.MethodPost {
+		return a.handleInitialize(c, log, o, owner)
+	}
+
+	var err error
+	switch c.Method() {
+	case fiber.MethodPost:
+		err = a.handlePost(c, log, o, owner)
+	case fiber.MethodGet:
+		err = a.handleGet(c, log, o, owner)
+	case fiber.MethodDelete:
+		err = a.handleDelete(c, log, o, owner)
+	default:
+		return fiber.ErrMethodNotAllowed
+	}
+
+	if errors.Is(err, errSessionGone) {
+		log.Info("mcp session of an aggregated server ended")
+		if err := a.deleteSession(c.Context(), sessionID); err != nil {
+			log.Error("failed to delete aggregate session", "error", err)
+		}
+		return fiber.NewError(fiber.StatusNotFound, "MCP session not found")
+	}
+	return err
+}
+
+// session returns the session of the request.
+func (a *aggregator) session(c *fiber.Ctx, log *slog.Logger, owner mcpsession.Owner) (*session, error) {
+	sessionID := c.Get(mcpsession.Header)
+	if sessionID == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "MCP session required")
+	}
+	s, err := a.loadSession(c.Context(), sessionID)
+	if err != nil && !errors.Is(err, errSessionGone) {
+		log.Error("failed to look up aggregate session", "error", err)
+		return nil, fiber.NewError(fiber.StatusServiceUnavailable, "MCP session unavailable")
+	}
+	if s == nil || s.Owner != owner || s.Route != c.Path() {
+		log.Warn("unknown mcp session", "provider", owner.Provider, "sub", owner.Subject)
+		return nil, fiber.NewError(fiber.StatusNotFound, "MCP session not found")
+	}
+	return s, err
+}
+
+func (a *aggregator) handleInitialize(c *fiber.Ctx, log *slog.Logger, o *origin, owner mcpsession.Owner) error {
+	m, parseErr := parseMessage(c.Body())
+	if parseErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(parseErr)
+	}
+	if m.Method != "initialize" || !m.isRequest() {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			jsonrpc.NewErrorResponse(nil, "Bad Request: No valid session ID provided", codeNoSession, nil))
+	}
+
+	body, _ := json.Marshal(m)
+	responses, sessionIDs, _ := a.fanOut(log, o, nil, func(string) []byte { return body })
+
+	s := &session{Route: c.Path(), Owner: owner, Members: map[string]*memberSession{}}
+	prefixes := make([]string, len(a.servers))
+	results := make([]*initializeResult, len(a.servers))
+	for i, server := range a.servers {
+		prefixes[i] = server.Prefix
+		response := responses[i]
+		if response == nil {
+			continue
+		}
+		var result initializeResult
+		if response.Error != nil || json.Unmarshal(response.Result, &result) != nil {
+			log.Warn("aggregated mcp server failed to initialize", "prefix", server.Prefix, "error", string(response.Error))
+			continue
+		}
+		results[i] = &result
+		s.Members[server.Prefix] = &memberSession{
+			SessionID:       sessionIDs[i],
+			ProtocolVersion: result.ProtocolVersion,
+		}
+	}
+	if len(s.Members) == 0 {
+		log.Error("no aggregated mcp server initialized")
+		return fiber.NewError(fiber.StatusBadGateway, "MCP servers unavailable")
+	}
+
+	sessionID := utils.RandString(32)
+	if err := a.saveSession(c.Context(), sessionID, s); err != nil {
+		log.Error("failed to store aggregate session", "error", err)
+		return fiber.NewError(fiber.StatusServiceUnavailable, "MCP session unavailable")
+	}
+	c.Set(mcpsession.Header, sessionID)
+	return c.JSON(newResultMessage(m.ID, mergeInitialize(prefixes, results)))
+}
+
+func (a *aggregator) handlePost(c *fiber.Ctx, log *slog.Logger, o *origin, owner mcpsession.Owner) error {
+	m, parseErr := parseMessage(c.Body())
+	if parseErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(parseErr)
+	}
+	s, err := a.session(c, log, owner)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case m.isResponse():
+		return a.answer(c, log, o, s, m)
+	case m.isNotification():
+		// Notifications like cancellations are for the server that has
+		// the request, the others ignore them
+		body, _ := json.Marshal(m)
+		if err := a.each(log, s, func(_ int, server *config.AggregateServerConfig, ms *memberSession) error {
+			u, err := a.exchange(o, server, ms, fiber.MethodPost, body)
+			if err != nil {
+				return err
+			}
+			u.close()
+			return nil
+		}); err != nil {
+			return err
+		}
+		return c.SendStatus(fiber.StatusAccepted)
+	}
+
+	switch _, list := lists[m.Method]; {
+	case list:
+		return a.list(c, log, o, s, m)
+	case m.Method == "ping":
+		return c.JSON(newResultMessage(m.ID, struct{}{}))
+	case m.Method == "initialize":
+		return c.JSON(newErrorMessage(m.ID, codeInvalidRequest, "Session is already initialized"))
+	case m.Method == "logging/setLevel":
+		body, _ := json.Marshal(m)
+		if _, _, err := a.fanOut(log, o, s, func(string) []byte { return body }); err != nil {
+			return err
+		}
+		return c.JSON(newResultMessage(m.ID, struct{}{}))
+	default:
+		return a.forward(c, log, o, s, m)
+	}
+}
+
+// answer passes a response of the client to the server whose request it
+// answers.
+func (a *aggregator) answer(c *fiber.Ctx, log *slog.Logger, o *origin, s *session, m *message) error {
+	prefix, id, ok := splitID(m.ID)
+	server, ms := a.server(s, prefix)
+	if !ok || server == nil {
+		log.Warn("dropped response to unknown request", "id", string(m.ID))
+		return c.SendStatus(fiber.StatusAccepted)
+	}
+
+	m.ID = id
+	body, _ := json.Marshal(m)
+	u, err := a.exchange(o, server, ms, fiber.MethodPost, body)
+	if err != nil {
+		if errors.Is(err, errSessionGone) {
+			return err
+		}
+		log.Error("failed to reach aggregated mcp server", "prefix", prefix, "error", err)
+		return fiber.NewError(fiber.StatusBadGateway, "MCP server unavailable")
+	}
+	u.close()
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// list merges a list of the servers. The cursor of the client holds the
+// cursors of the servers that have more items, the others are not asked
+// again. If one of them fails, the client gets an error and may retry the
+// cursor.
+func (a *aggregator) list(c *fiber.Ctx, log *slog.Logger, o *origin, s *session, m *message) error {
+	var cursors map[string]string
+	if cursor := stringMember(m.Params, "cursor"); cursor != "" {
+		var err error
+		if cursors, err = decodeCursor(cursor); err != nil {
+			return c.JSON(newErrorMessage(m.ID, codeInvalidParams, "Invalid cursor"))
+		}
+	}
+
+	responses, _, err := a.fanOut(log, o, s, func(prefix string) []byte {
+		forwarded := *m
+		if cursors != nil {
+			cursor, ok := cursors[prefix]
+			if !ok {
+				return nil
+			}
+			forwarded.Params = withCursor(m.Params, cursor)
+		}
+		body, _ := json.Marshal(&forwarded)
+		return body
+	})
+	if err != nil {
+		return err
+	}
+
+	var pages []page
+	for i, response := range responses {
+		prefix := a.servers[i].Prefix
+		if response != nil && response.Error != nil {
+			log.Warn("aggregated mcp server failed to list", "prefix", prefix, "method", m.Method, "error", string(response.Error))
+		}
+		if response == nil || response.Error != nil {
+			// Servers are left out of the first page, but leaving them out
+			// of a later one would silently end their list
+			if _, paging := cursors[prefix]; paging {
+				return c.JSON(newErrorMessage(m.ID, codeInternalError, "Aggregated MCP server "+prefix+" failed to list, retry with the same cursor"))
+			}
+			continue
+		}
+		pages = append(pages, page{prefix: prefix, result: response.Result})
+	}
+	return c.JSON(newResultMessage(m.ID, mergeList(m.Method, pages)))
+}
+
+// withCursor returns params with the cursor replaced.
+func withCursor(params json.RawMessage, cursor string) json.RawMessage {
+	object := map[string]json.RawMessage{}
+	_ = json.Unmarshal(params, &object)
+	if object == nil {
+		object = map[string]json.RawMessage{}
+	}
+	object["cursor"], _ = json.Marshal(cursor)
+	params, _ = json.Marshal(object)
+	return params
+}
+
+// forward passes a request to the server of the prefix of the tool, prompt
+// or resource it names, and its response back.
+func (a *aggregator) forward(c *fiber.Ctx, log *slog.Logger, o *origin, s *session, m *message) error {
+	if _, routed := routes[m.Method]; !routed && m.Method != "completion/complete" {
+		return c.JSON(newErrorMessage(m.ID, codeMethodNotFound, "Method not found"))
+	}
+	prefix, params, ok := route(m)
+	server, ms := a.server(s, prefix)
+	if !ok || server == nil {
+		if strings.HasPrefix(m.Method, "resources/") {
+			return c.JSON(newErrorMessage(m.ID, codeResourceNotFound, "Resource not found"))
+		}
+		return c.JSON(newErrorMessage(m.ID, codeInvalidParams, "Unknown tool, prompt or resource"))
+	}
+
+	forwarded := *m
+	forwarded.Params = params
+	body, _ := json.Marshal(&forwarded)
+	u, err := a.exchange(o, server, ms, fiber.MethodPost, body)
+	if err != nil {
+		if errors.Is(err, errSessionGone) {
+			return err
+		}
+		log.Error("failed to reach aggregated mcp server", "prefix", prefix, "error", err)
+		return fiber.NewError(fiber.StatusBadGateway, "MCP server unavailable")
+	}
+
+	// Progress and requests of the server reach clients that accept an
+	// event stream
+	if u.eventStream && acceptsEventStream(c) {
+		a.streamEvents(c, log, []*memberStream{{prefix: prefix, method: m.Method, upstream: u}})
+		return nil
+	}
+
+	defer u.close()
+	r, err := newEventReader(u.body, u.eventStream)
+	if err != nil {
+		log.Error("failed to read aggregated mcp server response", "prefix", prefix, "error", err)
+		return fiber.NewError(fiber.StatusBadGateway, "MCP server response incomplete")
+	}
+	response, err := r.response()
+	if err != nil {
+		log.Error("failed to read aggregated mcp server response", "prefix", prefix, "error", err)
+		return fiber.NewError(fiber.StatusBadGateway, "MCP server response incomplete")
+	}
+	fromServer(prefix, m.Method, response)
+	return c.JSON(response)
+}
+
+// handleGet merges the standalone streams of the servers. Servers without one
+// answer 405 and are left out.
+func (a *aggregator) handleGet(c *fiber.Ctx, log *slog.Logger, o *origin, owner mcpsession.Owner) error {
+	s, err := a.session(c, log, owner)
+	if err != nil {
+		return err
+	}
+	if !acceptsEventStream(c) {
+		return fiber.NewError(fiber.StatusNotAcceptable, "Client must accept text/event-stream")
+	}
+
+	opened := make([]*memberStream, len(a.servers))
+	err = a.each(log, s, func(i int, server *config.AggregateServerConfig, ms *memberSession) error {
+		u := a.send(o, server, ms, fiber.MethodGet, nil)
+		if u.status == fiber.StatusMethodNotAllowed {
+			u.close()
+			return nil
+		}
+		if err := check(u, ms); err != nil {
+			u.close()
+			return err
+		}
+		opened[i] = &memberStream{prefix: server.Prefix, upstream: u}
+		return nil
+	})
+
+	var streams []*memberStream
+	for _, stream := range opened {
+		if stream != nil {
+			streams = append(streams, stream)
+		}
+	}
+	if err != nil || len(streams) == 0 {
+		for _, stream := range streams {
+			stream.upstream.close()
+		}
+		if err != nil {
+			return err
+		}
+		return fiber.NewError(fiber.StatusMethodNotAllowed, "MCP servers offer no event stream")
+	}
+
+	a.streamEvents(c, log, streams)
+	return nil
+}
+
+func (a *aggregator) handleDelete(c *fiber.Ctx, log *slog.Logger, o *origin, owner mcpsession.Owner) error {
+	s, err := a.session(c, log, owner)
+	if err != nil && !errors.Is(err, errSessionGone) {
+		return err
+	}
+
+	// The sessions that already ended answer 404, which is fine
+	_ = a.each(log, s, func(_ int, server *config.AggregateServerConfig, ms *memberSession) error {
+		if ms.SessionID != "" {
+			a.send(o, server, ms, fiber.MethodDelete, nil).close()
+		}
+		return nil
+	})
+	if err := a.deleteSession(c.Context(), c.Get(mcpsession.Header)); err != nil {
+		log.Error("failed to delete aggregate session", "error", err)
+		return fiber.NewError(fiber.StatusServiceUnavailable, "MCP session unavailable")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// server returns the server with prefix and the session with it, or nil if
+// the session has none.
+func (a *aggregator) server(s *session, prefix string) (*config.AggregateServerConfig, *memberSession) {
+	ms := s.Members[prefix]
+	if ms == nil {
+		return nil, nil
+	}
+	for _, server := range a.servers {
+		if server.Prefix == prefix {
+			return server, ms
+		}
+	}
+	return nil, nil
+}
+
+// memberStream is an event stream of the server with prefix. Its responses
+// answer a request with method.
+type memberStream struct {
+	prefix   string
+	method   string
+	upstream *upstream
+}
+
+// streamEvents answers with the messages of streams as one event stream.
+func (a *aggregator) streamEvents(c *fiber.Ctx, log *slog.Logger, streams []*memberStream) {
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := writeEvents(w, streams); err != nil {
+			log.Debug("event stream closed", "error", err)
+		}
+	})
+}
+
+// writeEvents writes the messages of streams as SSE events, rewritten for the
+// client. Quiet streams get a heartbeat comment. It returns when all streams
+// ended, or when the client cannot be written to anymore, which closes the
+// streams.
+func writeEvents(w *bufio.Writer, streams []*memberStream) error {
+	messages := make(chan *message)
+	ended := make(chan struct{}, len(streams))
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		for _, stream := range streams {
+			stream.upstream.close()
+		}
+	}()
+
+	for _, stream := range streams {
+		go func() {
+			defer func() { ended <- struct{}{} }()
+			r, err := newEventReader(stream.upstream.body, stream.upstream.eventStream)
+			if err != nil {
+				return
+			}
+			for {
+				m, err := r.next()
+				if err != nil {
+					return
+				}
+				fromServer(stream.prefix, stream.method, m)
+				select {
+				case messages <- m:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	// The response headers are only sent with the first data
+	if _, err := w.WriteString(": stream open\n\n"); err != nil {
+		return err
+	}
+	for open := len(streams); ; {
+		// Flush fails once the client disconnected
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if open == 0 {
+			return nil
+		}
+
+		select {
+		case m := <-messages:
+			data, err := json.Marshal(m)
+			if err != nil {
+				return err
+			}
+			if _, err := w.WriteString("event: message\ndata: " + string(data) + "\n\n"); err != nil {
+				return err
+			}
+			heartbeat.Reset(heartbeatInterval)
+		case <-ended:
+			open--
+		case <-heartbeat.C:
+			if _, err := w.WriteString(": keepalive\n\n"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// parseMessage parses the body of a POST request. Batches are not supported.
+func parseMessage(body []byte) (*message, *jsonrpc.JSONRPCErrorResponse) {
+	messages, batch, err := parseMessages(body)
+	if err != nil {
+		return nil, jsonrpc.NewErrorResponse(nil, "Parse error", codeParseError, nil)
+	}
+	if batch {
+		return nil, jsonrpc.NewErrorResponse(nil, "Batches are not supported by aggregate routes", codeInvalidRequest, nil)
+	}
+	return messages[0], nil
+}
+
+func acceptsEventStream(c *fiber.Ctx) bool {
+	return strings.Contains(c.Get(fiber.HeaderAccept), "text/event-stream")
+}
@@ -0,0 +1,524 @@
+package aggregate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+	"github.com/schnurbus/go-mcp-gateway/internal/mcpsession"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/tokenauth"
+	"github.com/schnurbus/go-mcp-gateway/internal/tokenvalidator"
+)
+
+// testServer is an aggregated MCP server. It pages its tools one at a time,
+// answers tools/call with a resource link and, if stream is set, with an
+// event stream that has a request to the client first.
+type testServer struct {
+	route           string
+	protocolVersion string
+	capabilities    map[string]any
+	tools           []string
+	resources       []string
+	stream          bool
+	registry        *mcpsession.Registry
+
+	mu        sync.Mutex
+	sessionID string
+	received  []*message
+	events    chan string   // messages of the standalone stream, nil for none
+	opened    chan struct{} // signaled when the standalone stream opened
+}
+
+func (ts *testServer) messages() []*message {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return append([]*message(nil), ts.received...)
+}
+
+func (ts *testServer) handle(c *fiber.Ctx) error {
+	var owner mcpsession.Owner
+	if principal, ok := c.Locals(tokenauth.LocalsKey).(*tokenvalidator.Principal); ok {
+		owner = mcpsession.Owner{Provider: principal.Provider, Subject: principal.Subject}
+	}
+
+	var m message
+	if c.Method() == fiber.MethodPost {
+		if err := json.Unmarshal(c.Body(), &m); err != nil {
+			return fiber.ErrBadRequest
+		}
+		if m.Method == "initialize" {
+			ts.mu.Lock()
+			ts.sessionID = "session-" + strings.Trim(ts.route, "/")
+			ts.mu.Unlock()
+			if err := ts.registry.Create(c.Context(), &mcpsession.Session{
+				SessionID: ts.sessionID,
+				Route:     c.Path(),
+				Owner:     owner,
+			}); err != nil {
+				return err
+			}
+			c.Set(mcpsession.Header, ts.sessionID)
+			return c.JSON(newResultMessage(m.ID, map[string]any{
+				"protocolVersion": ts.protocolVersion,
+				"capabilities":    ts.capabilities,
+				"serverInfo":      map[string]string{"name": ts.route, "version": "1.0.0"},
+				"instructions":    "Use " + ts.route,
+			}))
+		}
+	}
+
+	ts.mu.Lock()
+	known := ts.sessionID != "" && c.Get(mcpsession.Header) == ts.sessionID
+	ts.mu.Unlock()
+	if !known {
+		return fiber.ErrNotFound
+	}
+
+	switch c.Method() {
+	case fiber.MethodGet:
+		if ts.events == nil {
+			return fiber.ErrMethodNotAllowed
+		}
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			_, _ = w.WriteString(": open\n\n")
+			_ = w.Flush()
+			ts.opened <- struct{}{}
+			for event := range ts.events {
+				_, _ = w.WriteString("data: " + event + "\n\n")
+				if w.Flush() != nil {
+					return
+				}
+			}
+		})
+		return nil
+	case fiber.MethodDelete:
+		ts.mu.Lock()
+		ts.sessionID = ""
+		ts.mu.Unlock()
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	ts.mu.Lock()
+	ts.received = append(ts.received, &m)
+	ts.mu.Unlock()
+	if !m.isRequest() {
+		return c.SendStatus(fiber.StatusAccepted)
+	}
+
+	var response *message
+	switch m.Method {
+	case "tools/list":
+		i := 0
+		if cursor := stringMember(m.Params, "cursor"); cursor != "" {
+			if _, err := fmt.Sscan(cursor, &i); err != nil || i >= len(ts.tools) {
+				response = newErrorMessage(m.ID, codeInvalidParams, "Invalid cursor")
+				break
+			}
+		}
+		result := map[string]any{"tools": []map[string]string{{"name": ts.tools[i]}}}
+		if i+1 < len(ts.tools) {
+			result["nextCursor"] = fmt.Sprint(i + 1)
+		}
+		response = newResultMessage(m.ID, result)
+	case "resources/list":
+		resources := []map[string]string{}
+		for _, uri := range ts.resources {
+			resources = append(resources, map[string]string{"uri": uri, "name": uri})
+		}
+		response = newResultMessage(m.ID, map[string]any{"resources": resources})
+	case "resources/read":
+		response = newResultMessage(m.ID, map[string]any{"contents": []map[string]string{
+			{"uri": stringMember(m.Params, "uri"), "text": "content"},
+		}})
+	case "tools/call":
+		response = newResultMessage(m.ID, map[string]any{"content": []map[string]string{
+			{"type": "text", "text": stringMember(m.Params, "name")},
+			{"type": "resource_link", "uri": "file:///result", "name": "result"},
+		}})
+	default:
+		response = newErrorMessage(m.ID, codeMethodNotFound, "Method not found")
+	}
+
+	if !ts.stream {
+		return c.JSON(response)
+	}
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		for _, m := range []*message{
+			{JSONRPC: "2.0", ID: json.RawMessage("7"), Method: "roots/list"},
+			response,
+		} {
+			data, _ := json.Marshal(m)
+			_, _ = w.WriteString("event: message\ndata: " + string(data) + "\n\n")
+			_ = w.Flush()
+		}
+	})
+	return nil
+}
+
+// serveTestAggregate serves calc and files aggregated at /mcp. The subject of
+// the request is taken from the Authorization header.
+func serveTestAggregate(t *testing.T) (string, *testServer, *testServer, *mcpsession.Registry) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	sessions := mcpsession.NewRegistry(rdb)
+
+	calc := &testServer{
+		route:           "/calc/mcp",
+		protocolVersion: "2025-03-26",
+		capabilities:    map[string]any{"tools": map[string]any{}},
+		tools:           []string{"add", "sub"},
+		registry:        sessions,
+	}
+	files := &testServer{
+		route:           "/files/mcp",
+		protocolVersion: "2025-06-18",
+		capabilities: map[string]any{
+			"tools":     map[string]any{"listChanged": true},
+			"resources": map[string]any{"subscribe": true, "listChanged": false},
+		},
+		tools:     []string{"read"},
+		resources: []string{"file:///notes.txt"},
+		stream:    true,
+		registry:  sessions,
+		events:    make(chan string, 10),
+		opened:    make(chan struct{}, 1),
+	}
+	members := fiber.New()
+	members.All(calc.route, calc.handle)
+	members.All(files.route, files.handle)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(tokenauth.LocalsKey, &tokenvalidator.Principal{
+			Subject: strings.TrimPrefix(c.Get("Authorization"), "Bearer "),
+		})
+		return c.Next()
+	})
+	app.All("/mcp", New(Config{
+		Servers: []*config.AggregateServerConfig{
+			{Prefix: "calc", Route: calc.route},
+			{Prefix: "files", Route: files.route},
+		},
+		Routes:   members.Handler(),
+		Redis:    rdb,
+		Sessions: sessions,
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = app.Listener(ln) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+	// Ends the standalone stream, which the shutdown waits for
+	t.Cleanup(func() { close(files.events) })
+
+	return "http://" + ln.Addr().String() + "/mcp", calc, files, sessions
+}
+
+type testClient struct {
+	t          *testing.T
+	gatewayURL string
+	user       string
+	sessionID  string
+}
+
+func (tc *testClient) send(method, accept, body string) *http.Response {
+	tc.t.Helper()
+	req, _ := http.NewRequest(method, tc.gatewayURL, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+tc.user)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+	if tc.sessionID != "" {
+		req.Header.Set(mcpsession.Header, tc.sessionID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	return resp
+}
+
+// call sends a request and returns the JSON response.
+func (tc *testClient) call(body string) (int, map[string]any) {
+	tc.t.Helper()
+	resp := tc.send("POST", "application/json", body)
+	defer resp.Body.Close()
+
+	var response map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&response)
+	return resp.StatusCode, response
+}
+
+func (tc *testClient) initialize() map[string]any {
+	tc.t.Helper()
+	resp := tc.send("POST", "application/json, text/event-stream",
+		`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		tc.t.Fatalf("initialize: expected status 200, got %d", resp.StatusCode)
+	}
+	tc.sessionID = resp.Header.Get(mcpsession.Header)
+	if tc.sessionID == "" {
+		tc.t.Fatal("initialize: expected a session id")
+	}
+
+	var response map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&response)
+	if status, _ := tc.call(`{"jsonrpc":"2.0","method":"notifications/initialized"}`); status != http.StatusAccepted {
+		tc.t.Fatalf("initialized: expected status 202, got %d", status)
+	}
+	return result(tc.t, response)
+}
+
+// readEvents reads n SSE events and returns their messages.
+func readEvents(t *testing.T, r *bufio.Reader, n int) []map[string]any {
+	t.Helper()
+	var events []map[string]any
+	for len(events) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expected %d events, got %d: %v", n, len(events), err)
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			var event map[string]any
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func result(t *testing.T, response map[string]any) map[string]any {
+	t.Helper()
+	result, ok := response["result"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected a result, got %v", response)
+	}
+	return result
+}
+
+func names(items any, key string) []string {
+	var names []string
+	list, _ := items.([]any)
+	for _, item := range list {
+		object, _ := item.(map[string]any)
+		names = append(names, fmt.Sprint(object[key]))
+	}
+	return names
+}
+
+func TestNewInitialize(t *testing.T) {
+	gatewayURL, calc, files, _ := serveTestAggregate(t)
+	tc := &testClient{t: t, gatewayURL: gatewayURL, user: "alice"}
+	initResult := tc.initialize()
+
+	if initResult["protocolVersion"] != "2025-03-26" {
+		t.Errorf("expected the lowest protocol version, got %v", initResult["protocolVersion"])
+	}
+	capabilities, _ := json.Marshal(initResult["capabilities"])
+	if string(capabilities) != `{"resources":{"subscribe":true},"tools":{"listChanged":true}}` {
+		t.Errorf("unexpected capabilities %s", capabilities)
+	}
+	if initResult["instructions"] != "calc: Use /calc/mcp\n\nfiles: Use /files/mcp" {
+		t.Errorf("unexpected instructions %q", initResult["instructions"])
+	}
+	if tc.sessionID == calc.sessionID || tc.sessionID == files.sessionID {
+		t.Error("expected a session id of the aggregate route")
+	}
+	for _, server := range []*testServer{calc, files} {
+		received := server.messages()
+		if len(received) != 1 || received[0].Method != "notifications/initialized" {
+			t.Errorf("%s: expected notifications/initialized, got %v", server.route, received)
+		}
+	}
+}
+
+func TestNewList(t *testing.T) {
+	gatewayURL, _, _, _ := serveTestAggregate(t)
+	tc := &testClient{t: t, gatewayURL: gatewayURL, user: "alice"}
+	tc.initialize()
+
+	// Only calc has a second page of tools
+	_, response := tc.call(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	page := result(t, response)
+	if got := strings.Join(names(page["tools"], "name"), ","); got != "calc_add,files_read" {
+		t.Errorf("expected the prefixed tools of both servers, got %s", got)
+	}
+	cursor, _ := page["nextCursor"].(string)
+	if cursor == "" {
+		t.Fatal("expected a cursor")
+	}
+	_, response = tc.call(`{"jsonrpc":"2.0","id":2,"method":"tools/list","params":{"cursor":"` + cursor + `"}}`)
+	page = result(t, response)
+	if got := strings.Join(names(page["tools"], "name"), ","); got != "calc_sub" {
+		t.Errorf("expected the second page of calc, got %s", got)
+	}
+	if _, ok := page["nextCursor"]; ok {
+		t.Error("expected the last page")
+	}
+
+	// A server failing on a later page must not end its list
+	_, response = tc.call(`{"jsonrpc":"2.0","id":6,"method":"tools/list","params":{"cursor":"` + encodeCursor(map[string]string{"calc": "9"}) + `"}}`)
+	if errResp, ok := response["error"].(map[string]any); !ok || errResp["code"] != float64(codeInternalError) {
+		t.Errorf("expected an internal error for the failed page, got %v", response)
+	}
+
+	_, response = tc.call(`{"jsonrpc":"2.0","id":3,"method":"resources/list"}`)
+	if got := strings.Join(names(result(t, response)["resources"], "uri"), ","); got != "files+file:///notes.txt" {
+		t.Errorf("expected the prefixed resources, got %s", got)
+	}
+
+	// Servers without prompts fail, which leaves the list empty
+	_, response = tc.call(`{"jsonrpc":"2.0","id":4,"method":"prompts/list"}`)
+	if prompts, ok := result(t, response)["prompts"].([]any); !ok || len(prompts) != 0 {
+		t.Errorf("expected no prompts, got %v", response)
+	}
+
+	_, response = tc.call(`{"jsonrpc":"2.0","id":5,"method":"tools/list","params":{"cursor":"invalid"}}`)
+	if code := response["error"].(map[string]any)["code"]; code != float64(codeInvalidParams) {
+		t.Errorf("expected invalid params, got %v", response)
+	}
+}
+
+func TestNewRoute(t *testing.T) {
+	gatewayURL, calc, files, _ := serveTestAggregate(t)
+	tc := &testClient{t: t, gatewayURL: gatewayURL, user: "alice"}
+	tc.initialize()
+
+	_, response := tc.call(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"calc_add","arguments":{}}}`)
+	content := result(t, response)["content"].([]any)
+	if text := content[0].(map[string]any)["text"]; text != "add" {
+		t.Errorf("expected calc to get the unprefixed name, got %v", text)
+	}
+	if uri := content[1].(map[string]any)["uri"]; uri != "calc+file:///result" {
+		t.Errorf("expected a prefixed resource link, got %v", uri)
+	}
+
+	// Clients that accept no event stream get the response only
+	_, response = tc.call(`{"jsonrpc":"2.0","id":2,"method":"resources/read","params":{"uri":"files+file:///notes.txt"}}`)
+	contents := result(t, response)["contents"].([]any)
+	if uri := contents[0].(map[string]any)["uri"]; uri != "files+file:///notes.txt" {
+		t.Errorf("expected the prefixed uri, got %v", uri)
+	}
+	received := files.messages()
+	if uri := stringMember(received[len(received)-1].Params, "uri"); uri != "file:///notes.txt" {
+		t.Errorf("expected files to get the unprefixed uri, got %s", uri)
+	}
+
+	// Requests of the server get ids the answers find their way back with
+	resp := tc.send("POST", "application/json, text/event-stream",
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"files_read"}}`)
+	events := readEvents(t, bufio.NewReader(resp.Body), 2)
+	resp.Body.Close()
+	if events[0]["method"] != "roots/list" || events[0]["id"] != "files:7" {
+		t.Errorf("expected the request of files with a prefixed id, got %v", events[0])
+	}
+	if events[1]["id"] != float64(3) {
+		t.Errorf("expected the response, got %v", events[1])
+	}
+	if status, _ := tc.call(`{"jsonrpc":"2.0","id":"files:7","result":{"roots":[]}}`); status != http.StatusAccepted {
+		t.Errorf("expected status 202 for the answer, got %d", status)
+	}
+	received = files.messages()
+	if answer := received[len(received)-1]; !answer.isResponse() || string(answer.ID) != "7" {
+		t.Errorf("expected files to get the answer with its id, got %v", answer)
+	}
+
+	for _, tt := range []struct {
+		body string
+		code int
+	}{
+		{`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"mail_send"}}`, codeInvalidParams},
+		{`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"send"}}`, codeInvalidParams},
+		{`{"jsonrpc":"2.0","id":6,"method":"resources/read","params":{"uri":"file:///notes.txt"}}`, codeResourceNotFound},
+		{`{"jsonrpc":"2.0","id":7,"method":"sampling/createMessage"}`, codeMethodNotFound},
+	} {
+		_, response := tc.call(tt.body)
+		if code := response["error"].(map[string]any)["code"]; code != float64(tt.code) {
+			t.Errorf("%s: expected error %d, got %v", tt.body, tt.code, response)
+		}
+	}
+	if n := len(calc.messages()); n != 2 {
+		t.Errorf("expected calc to get 2 messages, got %d", n)
+	}
+}
+
+func TestNewStandaloneStream(t *testing.T) {
+	gatewayURL, _, files, _ := serveTestAggregate(t)
+	tc := &testClient{t: t, gatewayURL: gatewayURL, user: "alice"}
+	tc.initialize()
+
+	// calc has no standalone stream and is left out
+	resp := tc.send("GET", "text/event-stream", "")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	<-files.opened
+	files.events <- `{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}`
+	files.events <- `{"jsonrpc":"2.0","method":"notifications/resources/updated","params":{"uri":"file:///notes.txt"}}`
+
+	events := readEvents(t, bufio.NewReader(resp.Body), 2)
+	if events[0]["method"] != "notifications/tools/list_changed" {
+		t.Errorf("expected list changed, got %v", events[0])
+	}
+	if uri := events[1]["params"].(map[string]any)["uri"]; uri != "files+file:///notes.txt" {
+		t.Errorf("expected the prefixed uri, got %v", uri)
+	}
+}
+
+func TestNewSessionEnds(t *testing.T) {
+	gatewayURL, calc, files, sessions := serveTestAggregate(t)
+	tc := &testClient{t: t, gatewayURL: gatewayURL, user: "alice"}
+	tc.initialize()
+
+	other := &testClient{t: t, gatewayURL: gatewayURL, user: "bob", sessionID: tc.sessionID}
+	if status, _ := other.call(`{"jsonrpc":"2.0","id":1,"method":"ping"}`); status != http.StatusNotFound {
+		t.Errorf("expected status 404 for the session of another user, got %d", status)
+	}
+	if status, _ := tc.call(`[{"jsonrpc":"2.0","id":1,"method":"ping"}]`); status != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a batch, got %d", status)
+	}
+
+	// Terminating the session with one server ends the aggregate session
+	list, err := sessions.List(t.Context(), mcpsession.Owner{Subject: "alice"})
+	if err != nil || len(list) != 2 {
+		t.Fatalf("expected 2 sessions, got %v: %v", list, err)
+	}
+	if err := sessions.Delete(t.Context(), list[0]); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := tc.call(`{"jsonrpc":"2.0","id":2,"method":"ping"}`); status != http.StatusNotFound {
+		t.Errorf("expected status 404 once a session ended, got %d", status)
+	}
+
+	tc.sessionID = ""
+	tc.initialize()
+	resp := tc.send("DELETE", "application/json", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", resp.StatusCode)
+	}
+	if calc.sessionID != "" || files.sessionID != "" {
+		t.Error("expected the sessions with the servers to be deleted")
+	}
+	if status, _ := tc.call(`{"jsonrpc":"2.0","id":3,"method":"ping"}`); status != http.StatusNotFound {
+		t.Errorf("expected status 404 after DELETE, got %d", status)
+	}
+}
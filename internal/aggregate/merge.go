@@ -0,0 +1,128 @@
+package aggregate
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// The aggregate route answers initialize as this server
+const (
+	serverName    = "go-mcp-gateway"
+	serverVersion = "1.0.0"
+)
+
+// mergedCapabilities are the server capabilities the aggregate route offers if
+// one of the servers does. Their flags, like listChanged and subscribe, are
+// set if one of the servers sets them.
+var mergedCapabilities = []string{"tools", "prompts", "resources", "logging", "completions"}
+
+// initializeResult is the part of the result of initialize that is merged.
+type initializeResult struct {
+	ProtocolVersion string                     `json:"protocolVersion"`
+	Capabilities    map[string]json.RawMessage `json:"capabilities"`
+	Instructions    string                     `json:"instructions"`
+}
+
+// mergeInitialize merges the results of initialize of the servers with
+// prefixes, nil for servers that failed. The protocol version is the lowest
+// one a server agreed to, versions are dates.
+func mergeInitialize(prefixes []string, results []*initializeResult) map[string]any {
+	var protocolVersion string
+	capabilities := map[string]map[string]bool{}
+	var instructions []string
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+		if protocolVersion == "" || result.ProtocolVersion < protocolVersion {
+			protocolVersion = result.ProtocolVersion
+		}
+		for _, name := range mergedCapabilities {
+			raw, ok := result.Capabilities[name]
+			if !ok {
+				continue
+			}
+			flags := capabilities[name]
+			if flags == nil {
+				flags = map[string]bool{}
+				capabilities[name] = flags
+			}
+			var object map[string]json.RawMessage
+			_ = json.Unmarshal(raw, &object)
+			for flag, value := range object {
+				if string(value) == "true" {
+					flags[flag] = true
+				}
+			}
+		}
+		if result.Instructions != "" {
+			instructions = append(instructions, fmt.Sprintf("%s: %s", prefixes[i], result.Instructions))
+		}
+	}
+
+	merged := map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    capabilities,
+		"serverInfo":      map[string]string{"name": serverName, "version": serverVersion},
+	}
+	if len(instructions) > 0 {
+		merged["instructions"] = strings.Join(instructions, "\n\n")
+	}
+	return merged
+}
+
+// page is a page of a list of the server with prefix.
+type page struct {
+	prefix string
+	result json.RawMessage
+}
+
+// mergeList merges the pages of the list method. The cursor of the merged
+// list holds the cursors of the servers that have more items.
+func mergeList(method string, pages []page) map[string]any {
+	list := lists[method]
+	items := []json.RawMessage{}
+	cursors := map[string]string{}
+	for _, p := range pages {
+		var result struct {
+			NextCursor string `json:"nextCursor"`
+		}
+		_ = json.Unmarshal(p.result, &result)
+		if result.NextCursor != "" {
+			cursors[p.prefix] = result.NextCursor
+		}
+
+		var pageItems []json.RawMessage
+		_ = json.Unmarshal(member(p.result, list.items), &pageItems)
+		for _, item := range pageItems {
+			items = append(items, prefixMember(item, p.prefix+list.separator, list.key))
+		}
+	}
+
+	merged := map[string]any{list.items: items}
+	if len(cursors) > 0 {
+		merged["nextCursor"] = encodeCursor(cursors)
+	}
+	return merged
+}
+
+// encodeCursor returns the cursor of a merged list, the cursors of the
+// servers keyed by prefix as base64url encoded JSON.
+func encodeCursor(cursors map[string]string) string {
+	cursorJSON, _ := json.Marshal(cursors)
+	return base64.RawURLEncoding.EncodeToString(cursorJSON)
+}
+
+func decodeCursor(cursor string) (map[string]string, error) {
+	cursorJSON, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var cursors map[string]string
+	if err := json.Unmarshal(cursorJSON, &cursors); err != nil {
+		return nil, err
+	}
+	return cursors, nil
+}
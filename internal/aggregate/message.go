@@ -0,0 +1,187 @@
+package aggregate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/schnurbus/go-mcp-gateway/pkg/jsonrpc"
+)
+
+// JSON-RPC error codes of the aggregate route
+const (
+	codeParseError       = -32700
+	codeInvalidRequest   = -32600
+	codeMethodNotFound   = -32601
+	codeInvalidParams    = -32602
+	codeInternalError    = -32603
+	codeNoSession        = -32000
+	codeResourceNotFound = -32002
+)
+
+// message is a JSON-RPC message. Members stay raw, the aggregate route only
+// rewrites names, URIs and ids.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
+}
+
+func (m *message) isRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+func (m *message) isNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
+
+func (m *message) isResponse() bool {
+	return m.Method == ""
+}
+
+func newResultMessage(id json.RawMessage, result any) *message {
+	resultJSON, _ := json.Marshal(result)
+	return &message{JSONRPC: "2.0", ID: id, Result: resultJSON}
+}
+
+func newErrorMessage(id json.RawMessage, code int, text string) *message {
+	errorJSON, _ := json.Marshal(&jsonrpc.JSONRPCError{Code: code, Message: text})
+	return &message{JSONRPC: "2.0", ID: id, Error: errorJSON}
+}
+
+// parseMessages parses the body of a POST request, a single message or a
+// batch.
+func parseMessages(body []byte) ([]*message, bool, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var messages []*message
+		if err := json.Unmarshal(body, &messages); err != nil {
+			return nil, true, err
+		}
+		for _, m := range messages {
+			if m == nil {
+				return nil, true, errors.New("null message in batch")
+			}
+		}
+		return messages, true, nil
+	}
+
+	var m message
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, false, err
+	}
+	return []*message{&m}, false, nil
+}
+
+// eventReader reads the messages of a response of an aggregated route, a
+// JSON body or an event stream.
+type eventReader struct {
+	events  *bufio.Reader // nil for JSON bodies
+	pending []*message
+}
+
+func newEventReader(body io.Reader, eventStream bool) (*eventReader, error) {
+	if eventStream {
+		return &eventReader{events: bufio.NewReader(body)}, nil
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	messages, _, err := parseMessages(data)
+	if err != nil {
+		return nil, err
+	}
+	return &eventReader{pending: messages}, nil
+}
+
+// next returns the next message. Events without valid message are skipped.
+// It returns io.EOF at the end of the response.
+func (r *eventReader) next() (*message, error) {
+	if r.events == nil {
+		if len(r.pending) == 0 {
+			return nil, io.EOF
+		}
+		m := r.pending[0]
+		r.pending = r.pending[1:]
+		return m, nil
+	}
+
+	var data []byte
+	for {
+		line, err := r.events.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data = append(data, strings.TrimPrefix(value, " ")...)
+			data = append(data, '\n')
+		}
+		if line == "" && len(data) > 0 {
+			var m message
+			if json.Unmarshal(data, &m) == nil {
+				return &m, nil
+			}
+			data = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// response returns the first response, the messages before it are dropped.
+func (r *eventReader) response() (*message, error) {
+	for {
+		m, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if m.isResponse() {
+			return m, nil
+		}
+	}
+}
+
+// member returns the member at path of the JSON object raw, or nil.
+func member(raw json.RawMessage, path ...string) json.RawMessage {
+	for _, name := range path {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return nil
+		}
+		raw = object[name]
+	}
+	return raw
+}
+
+// stringMember returns the string at path of the JSON object raw, or "".
+func stringMember(raw json.RawMessage, path ...string) string {
+	var s string
+	_ = json.Unmarshal(member(raw, path...), &s)
+	return s
+}
+
+// setMember returns the JSON object raw with the member at path replaced by
+// value. The objects on the path must exist.
+func setMember(raw json.RawMessage, value json.RawMessage, path ...string) (json.RawMessage, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, err
+	}
+	if object == nil {
+		return nil, errors.New("not an object")
+	}
+	if len(path) > 1 {
+		var err error
+		if value, err = setMember(object[path[0]], value, path[1:]...); err != nil {
+			return nil, err
+		}
+	}
+	object[path[0]] = value
+	return json.Marshal(object)
+}
@@ -0,0 +1,190 @@
+package aggregate
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// The names of the tools and prompts of an aggregated server get its prefix
+// and nameSeparator, the URIs of its resources and templates its prefix and
+// uriSeparator, which makes the prefix part of the URI scheme. Its requests to
+// the client get its prefix and idSeparator in their id. Prefixes contain
+// none of the separators.
+const (
+	nameSeparator = "_"
+	uriSeparator  = "+"
+	idSeparator   = ":"
+)
+
+// lists are the list methods the aggregate route merges, with the member of
+// their result that holds the items and the member of the items that gets the
+// prefix.
+var lists = map[string]struct {
+	items     string
+	key       string
+	separator string
+}{
+	"tools/list":               {items: "tools", key: "name", separator: nameSeparator},
+	"prompts/list":             {items: "prompts", key: "name", separator: nameSeparator},
+	"resources/list":           {items: "resources", key: "uri", separator: uriSeparator},
+	"resources/templates/list": {items: "resourceTemplates", key: "uriTemplate", separator: uriSeparator},
+}
+
+// routes are the requests that go to the aggregated server whose prefix the
+// name or URI in their params has.
+var routes = map[string]struct {
+	key       string
+	separator string
+}{
+	"tools/call":            {key: "name", separator: nameSeparator},
+	"prompts/get":           {key: "name", separator: nameSeparator},
+	"resources/read":        {key: "uri", separator: uriSeparator},
+	"resources/subscribe":   {key: "uri", separator: uriSeparator},
+	"resources/unsubscribe": {key: "uri", separator: uriSeparator},
+}
+
+// route returns the prefix of the server the request m goes to, and its params
+// without the prefix. The reference of completion requests names a prompt or
+// a resource template.
+func route(m *message) (string, json.RawMessage, bool) {
+	path, separator := []string{}, ""
+	if r, ok := routes[m.Method]; ok {
+		path, separator = []string{r.key}, r.separator
+	} else if m.Method == "completion/complete" {
+		switch stringMember(m.Params, "ref", "type") {
+		case "ref/prompt":
+			path, separator = []string{"ref", "name"}, nameSeparator
+		case "ref/resource":
+			path, separator = []string{"ref", "uri"}, uriSeparator
+		}
+	}
+	if separator == "" {
+		return "", nil, false
+	}
+
+	prefix, value, ok := strings.Cut(stringMember(m.Params, path...), separator)
+	if !ok {
+		return "", nil, false
+	}
+	valueJSON, _ := json.Marshal(value)
+	params, err := setMember(m.Params, valueJSON, path...)
+	if err != nil {
+		return "", nil, false
+	}
+	return prefix, params, true
+}
+
+// fromServer rewrites the message m of the server with prefix for the client.
+// Responses answer a request with method.
+func fromServer(prefix, method string, m *message) {
+	switch {
+	case m.isResponse():
+		if m.Result != nil {
+			m.Result = rewriteResult(prefix, method, m.Result)
+		}
+	case m.isRequest():
+		m.ID = prefixID(prefix, m.ID)
+	case m.Method == "notifications/resources/updated":
+		m.Params = prefixMember(m.Params, prefix+uriSeparator, "uri")
+	case m.Method == "notifications/cancelled":
+		// The server cancels a request it sent to the client
+		if id := member(m.Params, "requestId"); id != nil {
+			if params, err := setMember(m.Params, prefixID(prefix, id), "requestId"); err == nil {
+				m.Params = params
+			}
+		}
+	}
+}
+
+// rewriteResult prefixes the resource URIs in the result of a routed request.
+func rewriteResult(prefix, method string, result json.RawMessage) json.RawMessage {
+	switch method {
+	case "tools/call":
+		return mapArray(result, "content", func(block json.RawMessage) json.RawMessage {
+			return prefixContent(prefix, block)
+		})
+	case "prompts/get":
+		return mapArray(result, "messages", func(m json.RawMessage) json.RawMessage {
+			content := member(m, "content")
+			if content == nil {
+				return m
+			}
+			if rewritten, err := setMember(m, prefixContent(prefix, content), "content"); err == nil {
+				return rewritten
+			}
+			return m
+		})
+	case "resources/read":
+		return mapArray(result, "contents", func(contents json.RawMessage) json.RawMessage {
+			return prefixMember(contents, prefix+uriSeparator, "uri")
+		})
+	default:
+		return result
+	}
+}
+
+// prefixContent prefixes the URI of resource links and embedded resources.
+func prefixContent(prefix string, block json.RawMessage) json.RawMessage {
+	switch stringMember(block, "type") {
+	case "resource_link":
+		return prefixMember(block, prefix+uriSeparator, "uri")
+	case "resource":
+		return prefixMember(block, prefix+uriSeparator, "resource", "uri")
+	default:
+		return block
+	}
+}
+
+// prefixMember returns the JSON object raw with prefix added to the string at
+// path. Objects without that string are returned as they are.
+func prefixMember(raw json.RawMessage, prefix string, path ...string) json.RawMessage {
+	value := stringMember(raw, path...)
+	if value == "" {
+		return raw
+	}
+	valueJSON, _ := json.Marshal(prefix + value)
+	rewritten, err := setMember(raw, valueJSON, path...)
+	if err != nil {
+		return raw
+	}
+	return rewritten
+}
+
+// mapArray returns the JSON object raw with f applied to the items of its
+// array name.
+func mapArray(raw json.RawMessage, name string, f func(json.RawMessage) json.RawMessage) json.RawMessage {
+	var items []json.RawMessage
+	if err := json.Unmarshal(member(raw, name), &items); err != nil || items == nil {
+		return raw
+	}
+	for i, item := range items {
+		items[i] = f(item)
+	}
+	itemsJSON, _ := json.Marshal(items)
+	rewritten, err := setMember(raw, itemsJSON, name)
+	if err != nil {
+		return raw
+	}
+	return rewritten
+}
+
+// prefixID returns the id the client gets for the request id of the server
+// with prefix, a string.
+func prefixID(prefix string, id json.RawMessage) json.RawMessage {
+	idJSON, _ := json.Marshal(prefix + idSeparator + string(id))
+	return idJSON
+}
+
+// splitID returns the prefix of the server and its id of the id the client
+// answers a request with.
+func splitID(id json.RawMessage) (string, json.RawMessage, bool) {
+	var s string
+	if err := json.Unmarshal(id, &s); err != nil {
+		return "", nil, false
+	}
+	prefix, serverID, ok := strings.Cut(s, idSeparator)
+	if !ok || !json.Valid([]byte(serverID)) {
+		return "", nil, false
+	}
+	return prefix, json.RawMessage(serverID), true
+}
@@ -0,0 +1,85 @@
+package aggregate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/mcpsession"
+)
+
+// errSessionGone is returned once an aggregated server ended its session. The
+// aggregate session ends with it, the client starts over.
+var errSessionGone = errors.New("session of an aggregated server ended")
+
+// session is an MCP session of an aggregate route. It holds a session with
+// each aggregated server that initialized.
+type session struct {
+	Route string `json:"route"` // gateway path of the aggregate route
+	mcpsession.Owner
+	Members map[string]*memberSession `json:"members"` // keyed by prefix
+}
+
+// memberSession is the session with an aggregated server.
+type memberSession struct {
+	SessionID       string `json:"session_id"` // empty for servers without sessions
+	ProtocolVersion string `json:"protocol_version"`
+}
+
+func (a *aggregator) saveSession(ctx context.Context, id string, s *session) error {
+	sessionJSON, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	if err := a.sessionStore.Set(ctx, id, sessionJSON); err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+	return nil
+}
+
+// loadSession returns the session id and extends its lifetime, and the
+// lifetime of the sessions with the aggregated servers. It returns nil for
+// unknown sessions, and errSessionGone if a session with an aggregated server
+// was terminated.
+func (a *aggregator) loadSession(ctx context.Context, id string) (*session, error) {
+	sessionJSON, err := a.sessionStore.Get(ctx, id)
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	var s session
+	if err := json.Unmarshal([]byte(sessionJSON), &s); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+	if err := a.sessionStore.Expire(ctx, id); err != nil {
+		return nil, fmt.Errorf("failed to extend session: %w", err)
+	}
+
+	// Aggregated servers a client does not use would let their session
+	// expire otherwise
+	for _, server := range a.servers {
+		ms := s.Members[server.Prefix]
+		if ms == nil || ms.SessionID == "" {
+			continue
+		}
+		record, err := a.registry.Get(ctx, server.Route, ms.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			return &s, errSessionGone
+		}
+	}
+	return &s, nil
+}
+
+func (a *aggregator) deleteSession(ctx context.Context, id string) error {
+	if err := a.sessionStore.Del(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
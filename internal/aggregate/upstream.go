@@ -0,0 +1,190 @@
+package aggregate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+	"github.com/schnurbus/go-mcp-gateway/internal/mcpsession"
+	"github.com/valyala/fasthttp"
+)
+
+// protocolVersionHeader carries the protocol version of the session.
+const protocolVersionHeader = "MCP-Protocol-Version"
+
+// origin is what the requests to the aggregated routes take over from the
+// request of the client: its credentials, which the aggregate route already
+// checked, and its locals, like the principal. Fiber reuses the request once
+// the handler returned.
+type origin struct {
+	authorization string
+	locals        map[any]any
+	remoteAddr    net.Addr
+}
+
+func newOrigin(c *fiber.Ctx) *origin {
+	o := &origin{
+		authorization: string(c.Request().Header.Peek(fiber.HeaderAuthorization)),
+		locals:        map[any]any{},
+		remoteAddr:    c.Context().RemoteAddr(),
+	}
+	c.Context().VisitUserValuesAll(func(key, value any) {
+		o.locals[key] = value
+	})
+	return o
+}
+
+// upstream is the response of an aggregated route.
+type upstream struct {
+	status      int
+	sessionID   string
+	eventStream bool
+	body        io.ReadCloser
+}
+
+func (u *upstream) close() {
+	_ = u.body.Close()
+}
+
+// send passes a request of the session ms to the route of server. The route
+// is served in-process, its handlers see the request as if the client sent
+// it. body is nil for GET and DELETE.
+func (a *aggregator) send(o *origin, server *config.AggregateServerConfig, ms *memberSession, method string, body []byte) *upstream {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.Header.SetMethod(method)
+	req.SetRequestURI(server.Route)
+	req.Header.Set(fiber.HeaderAccept, "application/json, text/event-stream")
+	if o.authorization != "" {
+		req.Header.Set(fiber.HeaderAuthorization, o.authorization)
+	}
+	if ms.SessionID != "" {
+		req.Header.Set(mcpsession.Header, ms.SessionID)
+	}
+	if ms.ProtocolVersion != "" {
+		req.Header.Set(protocolVersionHeader, ms.ProtocolVersion)
+	}
+	if body != nil {
+		req.Header.SetContentType(fiber.MIMEApplicationJSON)
+		req.SetBody(body)
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, o.remoteAddr, nil)
+	for key, value := range o.locals {
+		ctx.SetUserValue(key, value)
+	}
+	a.routes(ctx)
+
+	resp := &ctx.Response
+	mediaType, _, _ := mime.ParseMediaType(string(resp.Header.ContentType()))
+	u := &upstream{
+		status:      resp.StatusCode(),
+		sessionID:   string(resp.Header.Peek(mcpsession.Header)),
+		eventStream: mediaType == "text/event-stream",
+	}
+	// Event streams are written by a goroutine of the handler, closing the
+	// stream tells it that the client went away
+	switch stream := resp.BodyStream().(type) {
+	case nil:
+		u.body = io.NopCloser(bytes.NewReader(resp.Body()))
+	case io.ReadCloser:
+		u.body = stream
+	default:
+		u.body = io.NopCloser(stream)
+	}
+	return u
+}
+
+// exchange sends a request and checks the status of the response. A 404 for
+// a session means that the server ended it.
+func (a *aggregator) exchange(o *origin, server *config.AggregateServerConfig, ms *memberSession, method string, body []byte) (*upstream, error) {
+	u := a.send(o, server, ms, method, body)
+	if err := check(u, ms); err != nil {
+		u.close()
+		return nil, err
+	}
+	return u, nil
+}
+
+func check(u *upstream, ms *memberSession) error {
+	switch {
+	case u.status == fiber.StatusNotFound && ms.SessionID != "":
+		return errSessionGone
+	case u.status >= fiber.StatusMultipleChoices:
+		return fmt.Errorf("unexpected status %d", u.status)
+	default:
+		return nil
+	}
+}
+
+// each runs f for the aggregated servers of the session s in parallel, for
+// all servers if s is nil. It returns errSessionGone once a server ended its
+// session, the other failures are logged.
+func (a *aggregator) each(log *slog.Logger, s *session, f func(i int, server *config.AggregateServerConfig, ms *memberSession) error) error {
+	errs := make([]error, len(a.servers))
+	var wg sync.WaitGroup
+	for i, server := range a.servers {
+		ms := &memberSession{}
+		if s != nil {
+			if ms = s.Members[server.Prefix]; ms == nil {
+				continue
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = f(i, server, ms)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if errors.Is(err, errSessionGone) {
+			return err
+		}
+		if err != nil {
+			log.Warn("aggregated mcp server failed", "prefix", a.servers[i].Prefix, "route", a.servers[i].Route, "error", err)
+		}
+	}
+	return nil
+}
+
+// fanOut posts the request body returns for the prefix of each aggregated
+// server of the session s, all servers if s is nil, and returns their
+// responses. Servers body returns nil for, and servers that failed, have no
+// response.
+func (a *aggregator) fanOut(log *slog.Logger, o *origin, s *session, body func(prefix string) []byte) ([]*message, []string, error) {
+	responses := make([]*message, len(a.servers))
+	sessionIDs := make([]string, len(a.servers))
+	err := a.each(log, s, func(i int, server *config.AggregateServerConfig, ms *memberSession) error {
+		b := body(server.Prefix)
+		if b == nil {
+			return nil
+		}
+		u, err := a.exchange(o, server, ms, fiber.MethodPost, b)
+		if err != nil {
+			return err
+		}
+		defer u.close()
+
+		r, err := newEventReader(u.body, u.eventStream)
+		if err != nil {
+			return err
+		}
+		response, err := r.response()
+		if err != nil {
+			return err
+		}
+		responses[i], sessionIDs[i] = response, u.sessionID
+		return nil
+	})
+	return responses, sessionIDs, err
+}
@@ -0,0 +1,362 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/schnurbus/go-mcp-gateway/internal/store"
+	"github.com/schnurbus/go-mcp-gateway/internal/utils"
+	"github.com/schnurbus/go-mcp-gateway/internal/vault"
+)
+
+// TokenGrant describes a new pair of gateway tokens. They are mapped to the
+// upstream grant in the vault of the user and client, which the Upstream
+// fields replace if set.
+type TokenGrant struct {
+	UID                  string
+	Email                string
+	Name                 string
+	ClientID             string
+	Resource             string
+	Scope                string // space-separated gateway scopes
+	Provider             string
+	UpstreamAccessToken  string
+	UpstreamRefreshToken string
+	UpstreamExpiry       int64
+	UpstreamScopes       []string
+}
+
+// AccessToken and RefreshToken are the stored gateway tokens. They refer to
+// the upstream grant in the vault by provider, user and client.
+type AccessToken struct {
+	UID              string `json:"uid"`
+	Email            string `json:"email,omitempty"`
+	Name             string `json:"name,omitempty"`
+	ClientID         string `json:"client_id"`
+	Resource         string `json:"resource,omitempty"`
+	Scope            string `json:"scope,omitempty"`
+	Provider         string `json:"provider,omitempty"`
+	IssuedAt         int64  `json:"iat"`
+	ExpiresAt        int64  `json:"exp"`
+	RefreshTokenHash string `json:"refresh_token_hash,omitempty"`
+}
+
+type RefreshToken struct {
+	UID             string `json:"uid"`
+	Email           string `json:"email,omitempty"`
+	Name            string `json:"name,omitempty"`
+	ClientID        string `json:"client_id"`
+	Resource        string `json:"resource,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+	Provider        string `json:"provider,omitempty"`
+	IssuedAt        int64  `json:"iat"`
+	ExpiresAt       int64  `json:"exp"`
+	AccessTokenHash string `json:"access_token_hash,omitempty"`
+}
+
+type TokenResponse struct {
+	TokenType    string `json:"token_type"`
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// IssueTokens mints an access token, opaque or a signed JWT depending on the
+// configured format, and a refresh token when an upstream refresh token is
+// available, and maps both to the upstream grant in the vault. Only hashes of
+// the tokens are used as storage keys.
+func (a *Auth) IssueTokens(ctx context.Context, grant *TokenGrant) (*TokenResponse, *AuthError) {
+	now := time.Now()
+
+	vaultKey := vault.Key(grant.Provider, grant.UID, grant.ClientID)
+	if grant.UpstreamAccessToken != "" {
+		if err := a.vault.Put(ctx, vaultKey, &vault.Grant{
+			Provider:     grant.Provider,
+			AccessToken:  grant.UpstreamAccessToken,
+			RefreshToken: grant.UpstreamRefreshToken,
+			Expiry:       grant.UpstreamExpiry,
+			Scopes:       grant.UpstreamScopes,
+		}); err != nil {
+			return nil, &AuthError{
+				AuthJsonError: AuthJsonError{
+					Code:        ServerError,
+					Description: "Failed to store upstream tokens",
+				},
+			}
+		}
+	}
+	upstream, err := a.vault.Get(ctx, vaultKey)
+	if errors.Is(err, vault.ErrNotFound) {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        InvalidGrant,
+				Description: "Upstream grant not found",
+			},
+		}
+	}
+	if err != nil {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        ServerError,
+				Description: "Failed to get upstream tokens",
+			},
+		}
+	}
+	// Keep the upstream grant as long as the new refresh token
+	_ = a.vault.Touch(ctx, vaultKey)
+
+	// Never outlive an upstream access token the vault cannot refresh
+	accessTokenTTL := store.OAuthAccessTokenTTL
+	if upstream.RefreshToken == "" && upstream.Expiry > 0 {
+		if upstreamTTL := time.Unix(upstream.Expiry, 0).Sub(now); upstreamTTL > 0 && upstreamTTL < accessTokenTTL {
+			accessTokenTTL = upstreamTTL
+		}
+	}
+
+	accessToken := utils.RandString(32)
+	if a.accessTokenFormat == AccessTokenFormatJWT {
+		signed, err := a.signAccessToken(grant, now, accessTokenTTL)
+		if err != nil {
+			return nil, &AuthError{
+				AuthJsonError: AuthJsonError{
+					Code:        ServerError,
+					Description: "Failed to sign access token",
+				},
+			}
+		}
+		accessToken = signed
+	}
+	accessTokenHash := hashToken(accessToken)
+
+	var refreshToken, refreshTokenHash string
+	if upstream.RefreshToken != "" {
+		refreshToken = utils.RandString(32)
+		refreshTokenHash = hashToken(refreshToken)
+
+		refreshTokenJSON, err := json.Marshal(&RefreshToken{
+			UID:             grant.UID,
+			Email:           grant.Email,
+			Name:            grant.Name,
+			ClientID:        grant.ClientID,
+			Resource:        grant.Resource,
+			Scope:           grant.Scope,
+			Provider:        grant.Provider,
+			IssuedAt:        now.Unix(),
+			ExpiresAt:       now.Add(store.OAuthRefreshTokenTTL).Unix(),
+			AccessTokenHash: accessTokenHash,
+		})
+		if err != nil {
+			return nil, &AuthError{
+				AuthJsonError: AuthJsonError{
+					Code:        ServerError,
+					Description: "Failed to marshal refresh token",
+				},
+			}
+		}
+		if err := a.refreshTokenStore.Set(ctx, refreshTokenHash, refreshTokenJSON); err != nil {
+			return nil, &AuthError{
+				AuthJsonError: AuthJsonError{
+					Code:        ServerError,
+					Description: "Failed to store refresh token",
+				},
+			}
+		}
+	}
+
+	accessTokenJSON, err := json.Marshal(&AccessToken{
+		UID:              grant.UID,
+		Email:            grant.Email,
+		Name:             grant.Name,
+		ClientID:         grant.ClientID,
+		Resource:         grant.Resource,
+		Scope:            grant.Scope,
+		Provider:         grant.Provider,
+		IssuedAt:         now.Unix(),
+		ExpiresAt:        now.Add(accessTokenTTL).Unix(),
+		RefreshTokenHash: refreshTokenHash,
+	})
+	if err != nil {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        ServerError,
+				Description: "Failed to marshal access token",
+			},
+		}
+	}
+	if err := a.accessTokenStore.SetWithTTL(ctx, accessTokenHash, accessTokenJSON, accessTokenTTL); err != nil {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        ServerError,
+				Description: "Failed to store access token",
+			},
+		}
+	}
+	if err := a.indexClientGrant(ctx, grant.ClientID, &clientGrant{
+		UID:              grant.UID,
+		Provider:         grant.Provider,
+		AccessTokenHash:  accessTokenHash,
+		RefreshTokenHash: refreshTokenHash,
+	}); err != nil {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        ServerError,
+				Description: "Failed to index tokens",
+			},
+		}
+	}
+
+	return &TokenResponse{
+		TokenType:    "Bearer",
+		AccessToken:  accessToken,
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        grant.Scope,
+	}, nil
+}
+
+// GetAccessToken resolves a gateway access token to its upstream credentials.
+func (a *Auth) GetAccessToken(ctx context.Context, token string) (*AccessToken, *AuthError) {
+	accessTokenJSON, err := a.accessTokenStore.Get(ctx, hashToken(token))
+	if err != nil {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        InvalidGrant,
+				Description: "Unknown access token",
+			},
+		}
+	}
+
+	var accessToken AccessToken
+	if err := json.Unmarshal([]byte(accessTokenJSON), &accessToken); err != nil {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        ServerError,
+				Description: "Failed to unmarshal access token",
+			},
+		}
+	}
+
+	if time.Now().Unix() >= accessToken.ExpiresAt {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        InvalidGrant,
+				Description: "Access token is expired",
+			},
+		}
+	}
+
+	return &accessToken, nil
+}
+
+// UpstreamGrant returns the upstream grant of a gateway access token with a
+// valid upstream access token, refreshed by the vault if it is about to
+// expire.
+func (a *Auth) UpstreamGrant(ctx context.Context, accessToken *AccessToken) (*vault.Grant, *AuthError) {
+	return a.UserUpstreamGrant(ctx, accessToken.Provider, accessToken.UID, accessToken.ClientID)
+}
+
+// UserUpstreamGrant returns the upstream grant of user uid at the provider
+// called name for clientID, like UpstreamGrant.
+func (a *Auth) UserUpstreamGrant(ctx context.Context, name, uid, clientID string) (*vault.Grant, *AuthError) {
+	grant, err := a.vault.Fresh(ctx, vault.Key(name, uid, clientID))
+	if err != nil {
+		return nil, upstreamGrantError(err)
+	}
+	return grant, nil
+}
+
+// ValidateUpstreamGrant checks that the upstream grant of a refresh token is
+// still usable before new gateway tokens are issued for it.
+func (a *Auth) ValidateUpstreamGrant(ctx context.Context, refreshToken *RefreshToken) *AuthError {
+	if _, err := a.vault.Fresh(ctx, vault.Key(refreshToken.Provider, refreshToken.UID, refreshToken.ClientID)); err != nil {
+		return upstreamGrantError(err)
+	}
+	return nil
+}
+
+func upstreamGrantError(err error) *AuthError {
+	if errors.Is(err, vault.ErrNotFound) || errors.Is(err, vault.ErrInvalidGrant) {
+		return &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        InvalidGrant,
+				Description: "Upstream grant is no longer valid",
+			},
+		}
+	}
+	return &AuthError{
+		AuthJsonError: AuthJsonError{
+			Code:        TemporarilyUnavailable,
+			Description: "Failed to refresh upstream token",
+		},
+	}
+}
+
+// GetRefreshToken resolves a gateway refresh token issued to clientID. The
+// token stays valid until ConsumeRefreshToken is called, so that neither
+// another client nor a failed upstream refresh can burn it.
+func (a *Auth) GetRefreshToken(ctx context.Context, token, clientID string) (*RefreshToken, *AuthError) {
+	refreshToken := a.getRefreshToken(ctx, hashToken(token))
+	if refreshToken == nil {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        InvalidGrant,
+				Description: "Unknown refresh token",
+			},
+		}
+	}
+
+	if refreshToken.ClientID != clientID {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        InvalidGrant,
+				Description: "Refresh token was issued to another client",
+			},
+		}
+	}
+
+	return refreshToken, nil
+}
+
+// ConsumeRefreshToken invalidates a gateway refresh token and the access
+// token issued alongside it once the caller is about to issue a new pair.
+// Refresh tokens are single use: of concurrent exchanges only one succeeds.
+func (a *Auth) ConsumeRefreshToken(ctx context.Context, token string, refreshToken *RefreshToken) *AuthError {
+	if _, err := a.refreshTokenStore.GetDel(ctx, hashToken(token)); err != nil {
+		return &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        InvalidGrant,
+				Description: "Unknown refresh token",
+			},
+		}
+	}
+
+	if refreshToken.AccessTokenHash != "" {
+		_ = a.accessTokenStore.Del(ctx, refreshToken.AccessTokenHash)
+	}
+
+	return nil
+}
+
+func (a *Auth) getRefreshToken(ctx context.Context, refreshTokenHash string) *RefreshToken {
+	if refreshTokenHash == "" {
+		return nil
+	}
+
+	refreshTokenJSON, err := a.refreshTokenStore.Get(ctx, refreshTokenHash)
+	if err != nil {
+		return nil
+	}
+
+	var refreshToken RefreshToken
+	if err := json.Unmarshal([]byte(refreshTokenJSON), &refreshToken); err != nil {
+		return nil
+	}
+	return &refreshToken
+}
+
+func hashToken(token string) string {
+	return utils.S256(token)
+}
@@ -2,38 +2,82 @@ package auth
 
 import (
 	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/keyset"
 	"github.com/schnurbus/go-mcp-gateway/internal/store"
+	"github.com/schnurbus/go-mcp-gateway/internal/vault"
 )
 
+const (
+	AccessTokenFormatOpaque = "opaque"
+	AccessTokenFormatJWT    = "jwt"
+)
+
+type AuthConfig struct {
+	BaseURL              string
+	AccessTokenFormat    string
+	KeySet               *keyset.KeySet      // required for the jwt access token format
+	Resources            []string            // resource indicators clients may request tokens for
+	Scopes               map[string][]string // scopes clients may request, keyed by resource
+	Vault                *vault.Vault        // keeps the upstream tokens
+	IntrospectionClients []string            // resource servers that may introspect tokens
+}
+
 type Auth struct {
 	baseURL                           string
+	accessTokenFormat                 string
+	keySet                            *keyset.KeySet
+	resources                         []string
+	scopes                            map[string][]string
+	vault                             *vault.Vault
+	introspectionClients              []string
 	clientStore                       *store.Store // key: client_id, value: client
 	codeStore                         *store.Store // key: code, value: code
 	authorizationStore                *store.Store // key: sid, value: authorization param
+	accessTokenStore                  *store.Store // key: hashed access token, value: access token
+	refreshTokenStore                 *store.Store // key: hashed refresh token, value: refresh token
+	clientGrantStore                  *store.Store // key: client_id, value: set of grants
 	registerPath                      string
 	authorizePath                     string
 	callbackPath                      string
+	providerSelectionPath             string
 	tokenPath                         string
+	introspectionPath                 string
+	revocationPath                    string
 	supportedTokenEndpointAuthMethods []string
 	supportedGrantTypes               []string
 	supportedResponseTypes            []string
 	supportedCodeChallengeMethods     []string
 }
 
-func NewAuth(baseURL string, rdb *redis.Client) *Auth {
+func NewAuth(config *AuthConfig, rdb *redis.Client) *Auth {
 	clientStore := store.NewStore(rdb, "client", store.OAuthClientTTL)
 	codeStore := store.NewStore(rdb, "code", store.OAuthStateTTL)
 	authorizationStore := store.NewStore(rdb, "authorization", store.OAuthStateTTL)
+	accessTokenStore := store.NewStore(rdb, "access_token", store.OAuthAccessTokenTTL)
+	refreshTokenStore := store.NewStore(rdb, "refresh_token", store.OAuthRefreshTokenTTL)
+	clientGrantStore := store.NewStore(rdb, "client_grants", store.OAuthRefreshTokenTTL)
 
 	return &Auth{
-		baseURL:                           baseURL,
+		baseURL:                           config.BaseURL,
+		accessTokenFormat:                 config.AccessTokenFormat,
+		keySet:                            config.KeySet,
+		resources:                         config.Resources,
+		scopes:                            config.Scopes,
+		vault:                             config.Vault,
+		introspectionClients:              config.IntrospectionClients,
 		clientStore:                       clientStore,
 		codeStore:                         codeStore,
 		authorizationStore:                authorizationStore,
+		accessTokenStore:                  accessTokenStore,
+		refreshTokenStore:                 refreshTokenStore,
+		clientGrantStore:                  clientGrantStore,
 		registerPath:                      "/oauth/register",
 		authorizePath:                     "/oauth/authorize",
 		callbackPath:                      "/oauth/callback",
+		providerSelectionPath:             "/oauth/authorize/provider",
 		tokenPath:                         "/oauth/token",
+		introspectionPath:                 "/oauth/introspect",
+		revocationPath:                    "/oauth/revoke",
 		supportedTokenEndpointAuthMethods: []string{"client_secret_basic", "client_secret_post", "none"},
 		supportedGrantTypes:               []string{"authorization_code", "refresh_token"},
 		supportedResponseTypes:            []string{"code"},
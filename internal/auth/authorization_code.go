@@ -5,28 +5,72 @@ import (
 	"encoding/json"
 
 	"github.com/schnurbus/go-mcp-gateway/internal/utils"
+	"github.com/schnurbus/go-mcp-gateway/internal/vault"
 )
 
 type AuthorizationCodeParams struct {
-	UID              string
-	ClientID         string
-	RedirectURI      string
-	CodeChallenge    string
-	GoogleAccessToken  string
-	GoogleRefreshToken string
-	GoogleExpiry       int64
+	UID                  string
+	Email                string
+	Name                 string
+	ClientID             string
+	RedirectURI          string
+	CodeChallenge        string
+	Resource             string
+	Scope                string // gateway scopes granted to the client
+	Provider             string
+	UpstreamAccessToken  string
+	UpstreamRefreshToken string
+	UpstreamExpiry       int64
+	UpstreamScopes       []string
 }
 
 type AuthorizationCodeResult struct {
-	UID              string
-	GoogleAccessToken  string
-	GoogleRefreshToken string
-	GoogleExpiry       int64
+	UID      string
+	Email    string
+	Name     string
+	Resource string
+	Scope    string
+	Provider string
 }
 
+// GenerateAuthorizationCode issues an authorization code for params. The
+// upstream tokens go to the vault right away, the code only refers to them.
 func (a *Auth) GenerateAuthorizationCode(ctx context.Context, params *AuthorizationCodeParams) (string, *AuthError) {
+	codeData := *params
+	if codeData.UpstreamAccessToken != "" {
+		if err := a.vault.Put(ctx, vault.Key(codeData.Provider, codeData.UID, codeData.ClientID), &vault.Grant{
+			Provider:     codeData.Provider,
+			AccessToken:  codeData.UpstreamAccessToken,
+			RefreshToken: codeData.UpstreamRefreshToken,
+			Expiry:       codeData.UpstreamExpiry,
+			Scopes:       codeData.UpstreamScopes,
+		}); err != nil {
+			return "", &AuthError{
+				AuthJsonError: AuthJsonError{
+					Code:        ServerError,
+					Description: "Failed to store upstream tokens",
+				},
+			}
+		}
+		if err := a.indexClientGrant(ctx, codeData.ClientID, &clientGrant{
+			UID:      codeData.UID,
+			Provider: codeData.Provider,
+		}); err != nil {
+			return "", &AuthError{
+				AuthJsonError: AuthJsonError{
+					Code:        ServerError,
+					Description: "Failed to index upstream tokens",
+				},
+			}
+		}
+		codeData.UpstreamAccessToken = ""
+		codeData.UpstreamRefreshToken = ""
+		codeData.UpstreamExpiry = 0
+		codeData.UpstreamScopes = nil
+	}
+
 	code := utils.RandString(32)
-	codeDataJSON, err := json.Marshal(params)
+	codeDataJSON, err := json.Marshal(&codeData)
 	if err != nil {
 		return "", &AuthError{
 			AuthJsonError: AuthJsonError{
@@ -88,9 +132,11 @@ func (a *Auth) VerifyAuthorizationCode(ctx context.Context, code, clientID, redi
 	}
 
 	return &AuthorizationCodeResult{
-		UID:              storedCodeData.UID,
-		GoogleAccessToken:  storedCodeData.GoogleAccessToken,
-		GoogleRefreshToken: storedCodeData.GoogleRefreshToken,
-		GoogleExpiry:       storedCodeData.GoogleExpiry,
+		UID:      storedCodeData.UID,
+		Email:    storedCodeData.Email,
+		Name:     storedCodeData.Name,
+		Resource: storedCodeData.Resource,
+		Scope:    storedCodeData.Scope,
+		Provider: storedCodeData.Provider,
 	}, nil
 }
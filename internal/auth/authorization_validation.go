@@ -15,6 +15,11 @@ type AuthorizationParams struct {
 	State               string `query:"state"`
 	CodeChallenge       string `query:"code_challenge"`
 	CodeChallengeMethod string `query:"code_challenge_method"`
+	Resource            string `query:"resource"`
+	Scope               string `query:"scope"`
+	LoginHint           string `query:"login_hint"`
+	DomainHint          string `query:"domain_hint"`
+	Provider            string `query:"-"` // upstream provider, set once routed or chosen
 }
 
 func (a *Auth) ValidateAuthorizationClient(ctx context.Context, params *AuthorizationParams, client *Client) *AuthError {
@@ -75,5 +80,27 @@ func (a *Auth) ValidateAuthorizationParams(ctx context.Context, params *Authoriz
 		}
 	}
 
+	if !a.IsValidResource(params.Resource) {
+		return &AuthError{
+			AuthRedirectError: AuthRedirectError{
+				RedirectURI:      params.RedirectURI,
+				ErrorCode:        InvalidTarget,
+				ErrorDescription: "resource is not a known MCP server",
+				State:            params.State,
+			},
+		}
+	}
+
+	if !a.IsValidScope(params.Resource, params.Scope) {
+		return &AuthError{
+			AuthRedirectError: AuthRedirectError{
+				RedirectURI:      params.RedirectURI,
+				ErrorCode:        InvalidScope,
+				ErrorDescription: "scope is not configured for the resource",
+				State:            params.State,
+			},
+		}
+	}
+
 	return nil
 }
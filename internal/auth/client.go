@@ -12,6 +12,7 @@ import (
 type Client struct {
 	ClientID                string   `json:"client_id"`
 	ClientSecret            string   `json:"client_secret,omitempty"`
+	ClientName              string   `json:"client_name,omitempty"`
 	ClientIDIssuedAt        int64    `json:"client_id_issued_at,omitempty"`
 	ClientSecretExpiresAt   int64    `json:"client_secret_expires_at,omitempty"`
 	GrantTypes              []string `json:"grant_types,omitempty"`
@@ -22,6 +23,17 @@ type Client struct {
 	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
 	RegistrationAccessToken string   `json:"registration_access_token,omitempty"`
 	RegistrationClientURI   string   `json:"registration_client_uri,omitempty"`
+
+	// RegistrationAccessTokenHash is only stored, never returned to clients
+	RegistrationAccessTokenHash string `json:"registration_access_token_hash,omitempty"`
+}
+
+// RegistrationResponse returns a copy of the client suitable for the
+// registration and client configuration endpoints.
+func (c *Client) RegistrationResponse() *Client {
+	resp := *c
+	resp.RegistrationAccessTokenHash = ""
+	return &resp
 }
 
 func (a *Auth) SaveClient(ctx context.Context, clientID string, client *Client) error {
@@ -29,7 +41,11 @@ func (a *Auth) SaveClient(ctx context.Context, clientID string, client *Client)
 		slog.String("auth", "SaveClient"),
 	)
 
-	clientJSON, err := json.Marshal(client)
+	// The plain registration access token is only handed out once
+	stored := *client
+	stored.RegistrationAccessToken = ""
+
+	clientJSON, err := json.Marshal(&stored)
 	if err != nil {
 		return fmt.Errorf("failed to marshal client")
 	}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+)
+
+// AuthenticateClient authenticates a client calling the introspection or
+// revocation endpoint with client_secret_basic (authorization header) or
+// client_secret_post (clientID and clientSecret form parameters). Public
+// clients registered with token_endpoint_auth_method "none" only need to
+// identify themselves.
+func (a *Auth) AuthenticateClient(ctx context.Context, authorization, clientID, clientSecret string) (*Client, *AuthError) {
+	method := "client_secret_post"
+	if strings.HasPrefix(authorization, "Basic ") {
+		if clientID != "" || clientSecret != "" {
+			return nil, &AuthError{
+				AuthJsonError: AuthJsonError{
+					Code:        InvalidRequest,
+					Description: "When Authorization header is present, client_id and client_secret form parameters must not be sent",
+				},
+			}
+		}
+		id, secret, ok := parseBasicCredentials(authorization)
+		if !ok {
+			return nil, &AuthError{
+				AuthJsonError: AuthJsonError{
+					Code:        InvalidClient,
+					Description: "invalid Authorization header",
+				},
+			}
+		}
+		method = "client_secret_basic"
+		clientID = id
+		clientSecret = secret
+	}
+
+	if clientID == "" {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        InvalidClient,
+				Description: "client authentication is required",
+			},
+		}
+	}
+
+	client, authErr := a.GetClient(ctx, clientID)
+	if authErr != nil {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        InvalidClient,
+				Description: "unknown client",
+			},
+		}
+	}
+
+	if client.TokenEndpointAuthMethod == "none" {
+		return client, nil
+	}
+
+	if client.TokenEndpointAuthMethod != method ||
+		clientSecret == "" ||
+		subtle.ConstantTimeCompare([]byte(clientSecret), []byte(client.ClientSecret)) != 1 {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        InvalidClient,
+				Description: "invalid client_id and client_secret",
+			},
+		}
+	}
+
+	return client, nil
+}
+
+func parseBasicCredentials(authorization string) (string, string, bool) {
+	payload, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "Basic "))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(payload), ":")
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+)
+
+// ClientUpdateRequest is the body of an RFC 7592 client update request. It
+// carries the full client metadata along with the client credentials.
+type ClientUpdateRequest struct {
+	ClientMetadata
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// AuthenticateRegistration checks the registration access token presented in
+// the authorization header against the one issued for clientID. Unknown
+// clients and invalid tokens are indistinguishable to the caller.
+func (a *Auth) AuthenticateRegistration(ctx context.Context, clientID, authorization string) (*Client, *AuthError) {
+	invalidToken := &AuthError{
+		AuthJsonError: AuthJsonError{
+			Code:        InvalidToken,
+			Description: "invalid registration access token",
+		},
+	}
+
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return nil, invalidToken
+	}
+	token := strings.TrimPrefix(authorization, "Bearer ")
+
+	client, authErr := a.GetClient(ctx, clientID)
+	if authErr != nil {
+		return nil, invalidToken
+	}
+
+	if client.RegistrationAccessTokenHash == "" ||
+		subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(client.RegistrationAccessTokenHash)) != 1 {
+		return nil, invalidToken
+	}
+
+	return client, nil
+}
+
+// UpdateClient replaces the metadata of a registered client. Credentials,
+// issue time and the registration access token are kept.
+func (a *Auth) UpdateClient(ctx context.Context, client *Client, req *ClientUpdateRequest) (*Client, *AuthError) {
+	if req.ClientID != client.ClientID {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        InvalidRequest,
+				Description: "client_id does not match",
+			},
+		}
+	}
+	if req.ClientSecret != "" && subtle.ConstantTimeCompare([]byte(req.ClientSecret), []byte(client.ClientSecret)) != 1 {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        InvalidRequest,
+				Description: "client_secret does not match",
+			},
+		}
+	}
+
+	metadata, err := a.RegisterValidate(ctx, &req.ClientMetadata)
+	if err != nil {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        InvalidClientMetadata,
+				Description: err.Error(),
+			},
+		}
+	}
+
+	updated := *client
+	updated.ClientName = metadata.ClientName
+	updated.GrantTypes = metadata.GrantTypes
+	updated.JWKSURI = metadata.JWKSURI
+	updated.LogoURI = metadata.LogoURI
+	updated.RedirectURIs = metadata.RedirectURIs
+	updated.ResponseTypes = metadata.ResponseTypes
+	updated.TokenEndpointAuthMethod = metadata.TokenEndpointAuthMethod
+
+	if err := a.SaveClient(ctx, updated.ClientID, &updated); err != nil {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        ServerError,
+				Description: "Failed to save client",
+			},
+		}
+	}
+
+	return &updated, nil
+}
+
+// DeleteClient removes a client registration along with the gateway tokens
+// and upstream grants issued to it (RFC 7592 section 2.3). Upstream tokens
+// are left to the caller, see FindClientRevocations.
+func (a *Auth) DeleteClient(ctx context.Context, clientID string) *AuthError {
+	revocations, authErr := a.FindClientRevocations(ctx, clientID)
+	if authErr != nil {
+		return authErr
+	}
+	for _, revocation := range revocations {
+		if authErr := a.Revoke(ctx, revocation); authErr != nil {
+			return authErr
+		}
+	}
+
+	if err := a.clientStore.Del(ctx, clientID); err != nil {
+		return &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        ServerError,
+				Description: "Failed to delete client",
+			},
+		}
+	}
+	if err := a.clientGrantStore.Del(ctx, clientID); err != nil {
+		return &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        ServerError,
+				Description: "Failed to delete client grants",
+			},
+		}
+	}
+	return nil
+}
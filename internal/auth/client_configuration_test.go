@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"testing"
+)
+
+func registerTestClient(t *testing.T, a *Auth) *Client {
+	t.Helper()
+	ctx := context.Background()
+	metadata, err := a.RegisterValidate(ctx, &ClientMetadata{
+		ClientName:   "Test Client",
+		RedirectURIs: []string{"http://localhost:5000/callback"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := a.Register(ctx, metadata)
+	if err := a.SaveClient(ctx, client.ClientID, client); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestRegister_IssuesRegistrationAccessToken(t *testing.T) {
+	a := newTestAuth(t)
+	ctx := context.Background()
+	client := registerTestClient(t, a)
+
+	if client.RegistrationAccessToken == "" {
+		t.Fatal("expected registration access token")
+	}
+	if client.RegistrationClientURI != "http://localhost:8080/oauth/register/"+client.ClientID {
+		t.Errorf("unexpected registration client uri: %s", client.RegistrationClientURI)
+	}
+	if resp := client.RegistrationResponse(); resp.RegistrationAccessTokenHash != "" {
+		t.Error("registration response must not contain the token hash")
+	}
+
+	stored, authErr := a.GetClient(ctx, client.ClientID)
+	if authErr != nil {
+		t.Fatal(authErr)
+	}
+	if stored.RegistrationAccessToken != "" {
+		t.Error("plain registration access token must not be stored")
+	}
+	if stored.RegistrationAccessTokenHash == "" {
+		t.Error("registration access token hash must be stored")
+	}
+}
+
+func TestAuthenticateRegistration(t *testing.T) {
+	a := newTestAuth(t)
+	ctx := context.Background()
+	client := registerTestClient(t, a)
+	other := registerTestClient(t, a)
+
+	if _, authErr := a.AuthenticateRegistration(ctx, client.ClientID, "Bearer "+client.RegistrationAccessToken); authErr != nil {
+		t.Errorf("expected valid registration access token, got %v", authErr)
+	}
+
+	testCases := []struct {
+		name          string
+		clientID      string
+		authorization string
+	}{
+		{name: "missing token", clientID: client.ClientID, authorization: ""},
+		{name: "wrong token", clientID: client.ClientID, authorization: "Bearer wrong"},
+		{name: "token of other client", clientID: client.ClientID, authorization: "Bearer " + other.RegistrationAccessToken},
+		{name: "unknown client", clientID: "unknown", authorization: "Bearer " + client.RegistrationAccessToken},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, authErr := a.AuthenticateRegistration(ctx, tc.clientID, tc.authorization)
+			if authErr == nil || authErr.Code != InvalidToken {
+				t.Errorf("expected invalid_token, got %v", authErr)
+			}
+		})
+	}
+}
+
+func TestUpdateAndDeleteClient(t *testing.T) {
+	a := newTestAuth(t)
+	ctx := context.Background()
+	client := registerTestClient(t, a)
+	stored, _ := a.GetClient(ctx, client.ClientID)
+
+	if _, authErr := a.UpdateClient(ctx, stored, &ClientUpdateRequest{
+		ClientID:       "other",
+		ClientMetadata: ClientMetadata{RedirectURIs: []string{"http://localhost:6000/callback"}},
+	}); authErr == nil {
+		t.Error("expected error for mismatching client_id")
+	}
+
+	updated, authErr := a.UpdateClient(ctx, stored, &ClientUpdateRequest{
+		ClientID:       client.ClientID,
+		ClientSecret:   client.ClientSecret,
+		ClientMetadata: ClientMetadata{ClientName: "Renamed", RedirectURIs: []string{"http://localhost:6000/callback"}},
+	})
+	if authErr != nil {
+		t.Fatalf("failed to update client: %v", authErr)
+	}
+	if updated.ClientName != "Renamed" || updated.RedirectURIs[0] != "http://localhost:6000/callback" {
+		t.Errorf("metadata not updated: %+v", updated)
+	}
+	if updated.ClientSecret != client.ClientSecret {
+		t.Error("client secret must be kept")
+	}
+	if _, authErr := a.AuthenticateRegistration(ctx, client.ClientID, "Bearer "+client.RegistrationAccessToken); authErr != nil {
+		t.Error("registration access token must survive an update")
+	}
+
+	if authErr := a.DeleteClient(ctx, client.ClientID); authErr != nil {
+		t.Fatal(authErr)
+	}
+	if _, authErr := a.GetClient(ctx, client.ClientID); authErr == nil {
+		t.Error("client should be deleted")
+	}
+}
@@ -1,10 +1,17 @@
 package auth
 
 const (
-	InvalidClientMetadata = "invalid_client_metadata"
-	InvalidRequest        = "invalid_request"
-	UnauthorizedClient    = "unauthorized_client"
-	ServerError           = "server_error"
+	AccessDenied           = "access_denied"
+	InvalidClient          = "invalid_client"
+	InvalidClientMetadata  = "invalid_client_metadata"
+	InvalidGrant           = "invalid_grant"
+	InvalidRequest         = "invalid_request"
+	InvalidScope           = "invalid_scope"
+	InvalidTarget          = "invalid_target"
+	InvalidToken           = "invalid_token"
+	UnauthorizedClient     = "unauthorized_client"
+	ServerError            = "server_error"
+	TemporarilyUnavailable = "temporarily_unavailable"
 )
 
 type AuthError struct {
@@ -0,0 +1,41 @@
+package auth
+
+import "testing"
+
+func TestAuthorizeIntrospection(t *testing.T) {
+	a := NewAuth(&AuthConfig{
+		BaseURL:              "http://localhost:8080",
+		IntrospectionClients: []string{"resource-server"},
+	}, nil)
+
+	tests := []struct {
+		name     string
+		client   *Client
+		wantCode string
+	}{
+		{
+			name:   "listed resource server",
+			client: &Client{ClientID: "resource-server", TokenEndpointAuthMethod: "client_secret_basic"},
+		},
+		{
+			name:     "other confidential client",
+			client:   &Client{ClientID: "registered-by-anyone", TokenEndpointAuthMethod: "client_secret_basic"},
+			wantCode: AccessDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authErr := a.AuthorizeIntrospection(tt.client)
+			if tt.wantCode == "" {
+				if authErr != nil {
+					t.Errorf("expected client to be allowed, got %v", authErr)
+				}
+				return
+			}
+			if authErr == nil || authErr.Code != tt.wantCode {
+				t.Errorf("expected %s, got %v", tt.wantCode, authErr)
+			}
+		})
+	}
+}
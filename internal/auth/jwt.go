@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/schnurbus/go-mcp-gateway/internal/utils"
+)
+
+// AccessTokenType is the typ header of JWT access tokens (RFC 9068).
+const AccessTokenType = "at+jwt"
+
+// AccessTokenClaims are the claims of JWT access tokens issued by the gateway
+// (RFC 9068 profile).
+type AccessTokenClaims struct {
+	jwt.Claims
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+func (a *Auth) signAccessToken(grant *TokenGrant, now time.Time, ttl time.Duration) (string, error) {
+	return a.keySet.Sign(AccessTokenType, &AccessTokenClaims{
+		Claims: jwt.Claims{
+			Issuer:    a.baseURL,
+			Subject:   grant.UID,
+			Audience:  jwt.Audience{a.audience(grant.Resource)},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Expiry:    jwt.NewNumericDate(now.Add(ttl)),
+			ID:        utils.RandString(16),
+		},
+		ClientID: grant.ClientID,
+		Scope:    grant.Scope,
+	})
+}
+
+// IdentityAssertionTTL is the lifetime of identity assertions. They are signed
+// for every proxied request, so they only need to outlive the request.
+const IdentityAssertionTTL = time.Minute
+
+// IdentityAssertionType is the typ header of identity assertions. It tells
+// them apart from access tokens, which carry the same iss and aud.
+const IdentityAssertionType = "identity-assertion+jwt"
+
+// IdentityAssertion is the identity the gateway asserts to an MCP server.
+type IdentityAssertion struct {
+	Subject   string
+	Email     string
+	Name      string
+	ClientID  string
+	RequestID string
+	Audience  string // resource of the route
+}
+
+// IdentityAssertionClaims are the claims of identity assertions, MCP servers
+// verify them against the gateway JWKS.
+type IdentityAssertionClaims struct {
+	jwt.Claims
+	Email     string `json:"email,omitempty"`
+	Name      string `json:"name,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// SignIdentityAssertion signs a short-lived JWT asserting the identity of a
+// proxied request to the MCP server of the route.
+func (a *Auth) SignIdentityAssertion(assertion *IdentityAssertion) (string, error) {
+	if a.keySet == nil {
+		return "", errors.New("identity assertions require signing keys")
+	}
+
+	now := time.Now()
+	return a.keySet.Sign(IdentityAssertionType, &IdentityAssertionClaims{
+		Claims: jwt.Claims{
+			Issuer:    a.baseURL,
+			Subject:   assertion.Subject,
+			Audience:  jwt.Audience{assertion.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Expiry:    jwt.NewNumericDate(now.Add(IdentityAssertionTTL)),
+			ID:        utils.RandString(16),
+		},
+		Email:     assertion.Email,
+		Name:      assertion.Name,
+		ClientID:  assertion.ClientID,
+		RequestID: assertion.RequestID,
+	})
+}
+
+// audience is the resource a token is bound to, or the gateway itself for
+// tokens valid for every resource.
+func (a *Auth) audience(resource string) string {
+	if resource != "" {
+		return resource
+	}
+	return a.baseURL
+}
+
+// GetJWKS returns the public signing keys, or nil if the gateway has none.
+func (a *Auth) GetJWKS() *jose.JSONWebKeySet {
+	if a.keySet == nil {
+		return nil
+	}
+	return a.keySet.JWKS()
+}
@@ -1,5 +1,7 @@
 package auth
 
+import "net/url"
+
 func (a *Auth) GetAuthorizationPath() string {
 	return a.authorizePath
 }
@@ -16,6 +18,10 @@ func (a *Auth) GetCallbackURL() string {
 	return a.baseURL + a.callbackPath
 }
 
+func (a *Auth) GetProviderSelectionPath() string {
+	return a.providerSelectionPath
+}
+
 func (a *Auth) GetDynamicRegistrationPath() string {
 	return a.registerPath
 }
@@ -24,6 +30,14 @@ func (a *Auth) GetDynamicRegistrationURL() string {
 	return a.baseURL + a.registerPath
 }
 
+func (a *Auth) GetClientConfigurationPath() string {
+	return a.registerPath + "/:client_id"
+}
+
+func (a *Auth) GetClientConfigurationURL(clientID string) string {
+	return a.baseURL + a.registerPath + "/" + url.PathEscape(clientID)
+}
+
 func (a *Auth) GetSupportCodeChallengeMethods() []string {
 	return a.supportedCodeChallengeMethods
 }
@@ -47,3 +61,27 @@ func (a *Auth) GetTokenPath() string {
 func (a *Auth) GetTokenURL() string {
 	return a.baseURL + a.tokenPath
 }
+
+func (a *Auth) GetIntrospectionPath() string {
+	return a.introspectionPath
+}
+
+func (a *Auth) GetIntrospectionURL() string {
+	return a.baseURL + a.introspectionPath
+}
+
+func (a *Auth) GetRevocationPath() string {
+	return a.revocationPath
+}
+
+func (a *Auth) GetRevocationURL() string {
+	return a.baseURL + a.revocationPath
+}
+
+func (a *Auth) GetJWKSPath() string {
+	return "/.well-known/jwks.json"
+}
+
+func (a *Auth) GetJWKSURL() string {
+	return a.baseURL + a.GetJWKSPath()
+}
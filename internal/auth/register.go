@@ -60,6 +60,7 @@ func (a *Auth) RegisterValidate(ctx context.Context, metadata *ClientMetadata) (
 func (a *Auth) Register(ctx context.Context, metadata *ClientMetadata) *Client {
 	clientID := utils.RandString(32)
 	clientSecret := utils.RandString(32)
+	registrationAccessToken := utils.RandString(32)
 
 	var clientSecretExpiresAt int64
 	if metadata.ClientSecretExpiresAt == 0 {
@@ -71,6 +72,7 @@ func (a *Auth) Register(ctx context.Context, metadata *ClientMetadata) *Client {
 	return &Client{
 		ClientID:                clientID,
 		ClientSecret:            clientSecret,
+		ClientName:              metadata.ClientName,
 		ClientIDIssuedAt:        time.Now().Unix(),
 		ClientSecretExpiresAt:   clientSecretExpiresAt,
 		RedirectURIs:            metadata.RedirectURIs,
@@ -79,7 +81,9 @@ func (a *Auth) Register(ctx context.Context, metadata *ClientMetadata) *Client {
 		TokenEndpointAuthMethod: metadata.TokenEndpointAuthMethod,
 		JWKSURI:                 metadata.JWKSURI,
 		LogoURI:                 metadata.LogoURI,
-		RegistrationAccessToken: "",
-		RegistrationClientURI:   "",
+		RegistrationAccessToken: registrationAccessToken,
+		RegistrationClientURI:   a.GetClientConfigurationURL(clientID),
+
+		RegistrationAccessTokenHash: hashToken(registrationAccessToken),
 	}
 }
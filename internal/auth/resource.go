@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// IsValidResource reports whether resource is empty or one of the configured
+// resource indicators (RFC 8707). Resources are compared verbatim.
+func (a *Auth) IsValidResource(resource string) bool {
+	return resource == "" || slices.Contains(a.resources, resource)
+}
+
+// IsValidScope reports whether every scope of the space-separated scope is
+// configured for resource, or for any resource if resource is empty. Routes
+// enforce the scopes granted to gateway tokens, so clients must not be able
+// to ask for others.
+func (a *Auth) IsValidScope(resource, scope string) bool {
+	for _, s := range strings.Fields(scope) {
+		valid := false
+		for r, scopes := range a.scopes {
+			if (resource == "" || r == resource) && slices.Contains(scopes, s) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveResource determines the resource a token is bound to when a client
+// requests resource at the token endpoint for a grant bound to granted. A
+// grant bound to a resource can only be used for that resource; an unbound
+// grant can be narrowed to any known resource.
+func (a *Auth) ResolveResource(ctx context.Context, granted, resource string) (string, *AuthError) {
+	if resource == "" || resource == granted {
+		return granted, nil
+	}
+
+	if granted != "" || !a.IsValidResource(resource) {
+		return "", &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        InvalidTarget,
+				Description: "resource is not valid for this grant",
+			},
+		}
+	}
+
+	return resource, nil
+}
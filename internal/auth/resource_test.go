@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"testing"
+)
+
+func TestResolveResource(t *testing.T) {
+	a := newTestAuth(t)
+	a.resources = []string{"http://localhost:8080/calc/mcp", "http://localhost:8080/files/mcp"}
+
+	testCases := []struct {
+		name     string
+		granted  string
+		resource string
+		expected string
+		wantErr  bool
+	}{
+		{name: "unbound grant", expected: ""},
+		{name: "bound grant", granted: "http://localhost:8080/calc/mcp", expected: "http://localhost:8080/calc/mcp"},
+		{name: "same resource", granted: "http://localhost:8080/calc/mcp", resource: "http://localhost:8080/calc/mcp", expected: "http://localhost:8080/calc/mcp"},
+		{name: "narrow unbound grant", resource: "http://localhost:8080/files/mcp", expected: "http://localhost:8080/files/mcp"},
+		{name: "other resource", granted: "http://localhost:8080/calc/mcp", resource: "http://localhost:8080/files/mcp", wantErr: true},
+		{name: "unknown resource", resource: "http://localhost:8080/other/mcp", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resource, authErr := a.ResolveResource(context.Background(), tc.granted, tc.resource)
+			if tc.wantErr {
+				if authErr == nil || authErr.Code != InvalidTarget {
+					t.Fatalf("expected invalid_target, got %v", authErr)
+				}
+				return
+			}
+			if authErr != nil {
+				t.Fatalf("unexpected error: %v", authErr)
+			}
+			if resource != tc.expected {
+				t.Errorf("expected resource '%s', got '%s'", tc.expected, resource)
+			}
+		})
+	}
+}
+
+func TestIsValidScope(t *testing.T) {
+	a := newTestAuth(t)
+	a.scopes = map[string][]string{
+		"http://localhost:8080/calc/mcp":  {"calc:read", "calc:write"},
+		"http://localhost:8080/files/mcp": {"files:read"},
+	}
+
+	testCases := []struct {
+		name     string
+		resource string
+		scope    string
+		expected bool
+	}{
+		{name: "no scope", expected: true},
+		{name: "scopes of the resource", resource: "http://localhost:8080/calc/mcp", scope: "calc:read calc:write", expected: true},
+		{name: "scope of another resource", resource: "http://localhost:8080/calc/mcp", scope: "files:read", expected: false},
+		{name: "scopes of any resource", scope: "calc:read files:read", expected: true},
+		{name: "unconfigured scope", scope: "calc:read admin", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if valid := a.IsValidScope(tc.resource, tc.scope); valid != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, valid)
+			}
+		})
+	}
+}
+
+func TestIssueTokens_Resource(t *testing.T) {
+	a := newTestAuth(t)
+	ctx := context.Background()
+
+	tokens, authErr := a.IssueTokens(ctx, &TokenGrant{
+		UID:                 "12345",
+		ClientID:            "client-a",
+		Resource:            "http://localhost:8080/calc/mcp",
+		UpstreamAccessToken: "google-access-token",
+	})
+	if authErr != nil {
+		t.Fatalf("failed to issue tokens: %v", authErr)
+	}
+
+	accessToken, authErr := a.GetAccessToken(ctx, tokens.AccessToken)
+	if authErr != nil {
+		t.Fatalf("failed to get access token: %v", authErr)
+	}
+	if accessToken.Resource != "http://localhost:8080/calc/mcp" {
+		t.Errorf("expected token bound to resource, got '%s'", accessToken.Resource)
+	}
+	if resp := a.Introspect(ctx, tokens.AccessToken, ""); resp.Aud != "http://localhost:8080/calc/mcp" {
+		t.Errorf("expected aud to be the resource, got '%s'", resp.Aud)
+	}
+}
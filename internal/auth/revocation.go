@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/schnurbus/go-mcp-gateway/internal/vault"
+)
+
+type RevocationRequestParams struct {
+	Token         string `form:"token"`
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// Revocation describes the gateway-side state of a grant that is about to be
+// revoked and the upstream token to revoke along with it.
+type Revocation struct {
+	clientID         string
+	accessTokenHash  string
+	refreshTokenHash string
+	vaultKey         string
+	Provider         string
+	UpstreamToken    string
+}
+
+// FindRevocation resolves an access or refresh token issued to clientID to
+// the grant it belongs to. Revoking either token revokes the whole grant.
+// It returns nil for unknown tokens and tokens issued to other clients, which
+// RFC 7009 requires to be ignored.
+func (a *Auth) FindRevocation(ctx context.Context, token, tokenTypeHint, clientID string) *Revocation {
+	lookups := []func(context.Context, string) *Revocation{a.findAccessTokenRevocation, a.findRefreshTokenRevocation}
+	if tokenTypeHint == "refresh_token" {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		if revocation := lookup(ctx, token); revocation != nil {
+			if revocation.clientID != clientID {
+				return nil
+			}
+			return revocation
+		}
+	}
+
+	return nil
+}
+
+func (a *Auth) findAccessTokenRevocation(ctx context.Context, token string) *Revocation {
+	accessToken, authErr := a.GetAccessToken(ctx, token)
+	if authErr != nil {
+		return nil
+	}
+
+	revocation := &Revocation{
+		clientID:         accessToken.ClientID,
+		accessTokenHash:  hashToken(token),
+		refreshTokenHash: accessToken.RefreshTokenHash,
+		Provider:         accessToken.Provider,
+	}
+	a.findUpstreamGrant(ctx, revocation, accessToken.UID)
+
+	return revocation
+}
+
+func (a *Auth) findRefreshTokenRevocation(ctx context.Context, token string) *Revocation {
+	refreshTokenHash := hashToken(token)
+	refreshToken := a.getRefreshToken(ctx, refreshTokenHash)
+	if refreshToken == nil {
+		return nil
+	}
+
+	revocation := &Revocation{
+		clientID:         refreshToken.ClientID,
+		accessTokenHash:  refreshToken.AccessTokenHash,
+		refreshTokenHash: refreshTokenHash,
+		Provider:         refreshToken.Provider,
+	}
+	a.findUpstreamGrant(ctx, revocation, refreshToken.UID)
+
+	return revocation
+}
+
+// findUpstreamGrant adds the upstream grant in the vault to a revocation. The
+// upstream refresh token is preferred, revoking it usually revokes the whole
+// upstream grant.
+func (a *Auth) findUpstreamGrant(ctx context.Context, revocation *Revocation, uid string) {
+	key := vault.Key(revocation.Provider, uid, revocation.clientID)
+	grant, err := a.vault.Get(ctx, key)
+	if err != nil {
+		return
+	}
+
+	revocation.vaultKey = key
+	revocation.UpstreamToken = grant.RefreshToken
+	if revocation.UpstreamToken == "" {
+		revocation.UpstreamToken = grant.AccessToken
+	}
+}
+
+// clientGrant records the tokens and the upstream grant issued to a client,
+// so they can be revoked once the client is deleted.
+type clientGrant struct {
+	UID              string `json:"uid"`
+	Provider         string `json:"provider,omitempty"`
+	AccessTokenHash  string `json:"access_token_hash,omitempty"`
+	RefreshTokenHash string `json:"refresh_token_hash,omitempty"`
+}
+
+func (a *Auth) indexClientGrant(ctx context.Context, clientID string, grant *clientGrant) error {
+	grantJSON, err := json.Marshal(grant)
+	if err != nil {
+		return err
+	}
+	return a.clientGrantStore.SAdd(ctx, clientID, grantJSON)
+}
+
+// FindClientRevocations returns the revocations of every grant issued to
+// clientID. Each upstream grant is only revoked upstream once.
+func (a *Auth) FindClientRevocations(ctx context.Context, clientID string) ([]*Revocation, *AuthError) {
+	members, err := a.clientGrantStore.SMembers(ctx, clientID)
+	if err != nil {
+		return nil, &AuthError{
+			AuthJsonError: AuthJsonError{
+				Code:        ServerError,
+				Description: "Failed to get client grants",
+			},
+		}
+	}
+
+	var revocations []*Revocation
+	upstreamGrants := map[string]bool{}
+	for _, member := range members {
+		var grant clientGrant
+		if err := json.Unmarshal([]byte(member), &grant); err != nil {
+			continue
+		}
+		revocation := &Revocation{
+			clientID:         clientID,
+			accessTokenHash:  grant.AccessTokenHash,
+			refreshTokenHash: grant.RefreshTokenHash,
+			Provider:         grant.Provider,
+		}
+		a.findUpstreamGrant(ctx, revocation, grant.UID)
+		if upstreamGrants[revocation.vaultKey] {
+			revocation.UpstreamToken = ""
+		}
+		upstreamGrants[revocation.vaultKey] = true
+		revocations = append(revocations, revocation)
+	}
+	return revocations, nil
+}
+
+// Revoke deletes the gateway access and refresh token of a grant and the
+// upstream tokens in the vault.
+func (a *Auth) Revoke(ctx context.Context, revocation *Revocation) *AuthError {
+	if revocation.accessTokenHash != "" {
+		if err := a.accessTokenStore.Del(ctx, revocation.accessTokenHash); err != nil {
+			return &AuthError{
+				AuthJsonError: AuthJsonError{
+					Code:        ServerError,
+					Description: "Failed to revoke access token",
+				},
+			}
+		}
+	}
+	if revocation.refreshTokenHash != "" {
+		if err := a.refreshTokenStore.Del(ctx, revocation.refreshTokenHash); err != nil {
+			return &AuthError{
+				AuthJsonError: AuthJsonError{
+					Code:        ServerError,
+					Description: "Failed to revoke refresh token",
+				},
+			}
+		}
+	}
+	if revocation.vaultKey != "" {
+		if err := a.vault.Delete(ctx, revocation.vaultKey); err != nil {
+			return &AuthError{
+				AuthJsonError: AuthJsonError{
+					Code:        ServerError,
+					Description: "Failed to revoke upstream tokens",
+				},
+			}
+		}
+	}
+	return nil
+}
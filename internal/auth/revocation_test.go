@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/vault"
+)
+
+func newTestAuth(t *testing.T) *Auth {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	key, err := vault.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate vault key: %v", err)
+	}
+	v, err := vault.NewVault(&vault.VaultConfig{Keys: [][]byte{key}}, rdb)
+	if err != nil {
+		t.Fatalf("failed to create vault: %v", err)
+	}
+
+	return NewAuth(&AuthConfig{
+		BaseURL:           "http://localhost:8080",
+		AccessTokenFormat: AccessTokenFormatOpaque,
+		Vault:             v,
+	}, rdb)
+}
+
+func issueTestTokens(t *testing.T, a *Auth, clientID string) *TokenResponse {
+	t.Helper()
+	tokens, authErr := a.IssueTokens(context.Background(), &TokenGrant{
+		UID:                  "12345",
+		ClientID:             clientID,
+		UpstreamAccessToken:  "google-access-token",
+		UpstreamRefreshToken: "google-refresh-token",
+	})
+	if authErr != nil {
+		t.Fatalf("failed to issue tokens: %v", authErr)
+	}
+	return tokens
+}
+
+func TestRevoke_RefreshTokenRevokesGrant(t *testing.T) {
+	a := newTestAuth(t)
+	ctx := context.Background()
+	tokens := issueTestTokens(t, a, "client-a")
+
+	revocation := a.FindRevocation(ctx, tokens.RefreshToken, "refresh_token", "client-a")
+	if revocation == nil {
+		t.Fatal("expected revocation for refresh token")
+	}
+	if revocation.UpstreamToken != "google-refresh-token" {
+		t.Errorf("expected Google refresh token to be revoked upstream, got '%s'", revocation.UpstreamToken)
+	}
+
+	if authErr := a.Revoke(ctx, revocation); authErr != nil {
+		t.Fatalf("failed to revoke: %v", authErr)
+	}
+	if _, authErr := a.GetAccessToken(ctx, tokens.AccessToken); authErr == nil {
+		t.Error("access token should be revoked along with its refresh token")
+	}
+	if resp := a.Introspect(ctx, tokens.RefreshToken, "refresh_token"); resp.Active {
+		t.Error("refresh token should be inactive after revocation")
+	}
+}
+
+func TestUpstreamGrant_Vault(t *testing.T) {
+	a := newTestAuth(t)
+	ctx := context.Background()
+	tokens := issueTestTokens(t, a, "client-a")
+
+	accessToken, authErr := a.GetAccessToken(ctx, tokens.AccessToken)
+	if authErr != nil {
+		t.Fatalf("failed to get access token: %v", authErr)
+	}
+	grant, authErr := a.UpstreamGrant(ctx, accessToken)
+	if authErr != nil || grant.AccessToken != "google-access-token" {
+		t.Errorf("expected 'google-access-token', got %+v, %v", grant, authErr)
+	}
+
+	revocation := a.FindRevocation(ctx, tokens.AccessToken, "", "client-a")
+	if authErr := a.Revoke(ctx, revocation); authErr != nil {
+		t.Fatalf("failed to revoke: %v", authErr)
+	}
+	if _, authErr := a.UpstreamGrant(ctx, accessToken); authErr == nil || authErr.Code != InvalidGrant {
+		t.Errorf("expected invalid_grant after revocation, got %v", authErr)
+	}
+}
+
+func TestRevoke_AccessTokenRevokesUpstreamRefreshToken(t *testing.T) {
+	a := newTestAuth(t)
+	ctx := context.Background()
+	tokens := issueTestTokens(t, a, "client-a")
+
+	// The hint is only an optimization
+	revocation := a.FindRevocation(ctx, tokens.AccessToken, "refresh_token", "client-a")
+	if revocation == nil {
+		t.Fatal("expected revocation for access token")
+	}
+	if revocation.UpstreamToken != "google-refresh-token" {
+		t.Errorf("expected Google refresh token to be revoked upstream, got '%s'", revocation.UpstreamToken)
+	}
+
+	if authErr := a.Revoke(ctx, revocation); authErr != nil {
+		t.Fatalf("failed to revoke: %v", authErr)
+	}
+	if _, authErr := a.GetRefreshToken(ctx, tokens.RefreshToken, "client-a"); authErr == nil {
+		t.Error("refresh token should be revoked along with its access token")
+	}
+}
+
+func TestFindRevocation_IgnoresOtherClientsAndUnknownTokens(t *testing.T) {
+	a := newTestAuth(t)
+	ctx := context.Background()
+	tokens := issueTestTokens(t, a, "client-a")
+
+	if revocation := a.FindRevocation(ctx, tokens.AccessToken, "", "client-b"); revocation != nil {
+		t.Error("tokens of other clients must not be revocable")
+	}
+	if revocation := a.FindRevocation(ctx, "unknown-token", "", "client-a"); revocation != nil {
+		t.Error("unknown tokens must be ignored")
+	}
+	if _, authErr := a.GetAccessToken(ctx, tokens.AccessToken); authErr != nil {
+		t.Error("access token should still be valid")
+	}
+}
+
+func TestRefreshToken_SingleUseOnceConsumed(t *testing.T) {
+	a := newTestAuth(t)
+	ctx := context.Background()
+	tokens := issueTestTokens(t, a, "client-a")
+
+	if _, authErr := a.GetRefreshToken(ctx, tokens.RefreshToken, "client-b"); authErr == nil || authErr.Code != InvalidGrant {
+		t.Errorf("expected invalid_grant for another client, got %v", authErr)
+	}
+	// Neither another client nor a failed exchange burns the token
+	refreshToken, authErr := a.GetRefreshToken(ctx, tokens.RefreshToken, "client-a")
+	if authErr != nil {
+		t.Fatalf("refresh token should still be valid: %v", authErr)
+	}
+
+	if authErr := a.ConsumeRefreshToken(ctx, tokens.RefreshToken, refreshToken); authErr != nil {
+		t.Fatalf("failed to consume refresh token: %v", authErr)
+	}
+	if authErr := a.ConsumeRefreshToken(ctx, tokens.RefreshToken, refreshToken); authErr == nil || authErr.Code != InvalidGrant {
+		t.Errorf("expected invalid_grant for a consumed refresh token, got %v", authErr)
+	}
+	if _, authErr := a.GetRefreshToken(ctx, tokens.RefreshToken, "client-a"); authErr == nil {
+		t.Error("consumed refresh token should be invalid")
+	}
+	if _, authErr := a.GetAccessToken(ctx, tokens.AccessToken); authErr == nil {
+		t.Error("access token should be invalidated along with its refresh token")
+	}
+}
@@ -18,6 +18,7 @@ type TokenRequestParams struct {
 	CodeVerifier  string `form:"code_verifier"`
 	Authorization string `header:"Authorization"`
 	RefreshToken  string `form:"refresh_token"`
+	Resource      string `form:"resource"`
 }
 
 type RefreshTokenRequestParams struct {
@@ -25,6 +26,7 @@ type RefreshTokenRequestParams struct {
 	RefreshToken string `form:"refresh_token"`
 	ClientID     string `form:"client_id"`
 	ClientSecret string `form:"client_secret"`
+	Resource     string `form:"resource"`
 }
 
 func (a *Auth) TokenValidateParams(ctx context.Context, params *TokenRequestParams) *AuthError {
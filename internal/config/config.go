@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
@@ -19,21 +22,246 @@ type BaseConfig struct {
 	RedisPassword  string `envconfig:"REDIS_PASSWORD"`
 }
 
+// Upstream identity providers
+const (
+	ProviderDev    = "dev"
+	ProviderGitHub = "github"
+	ProviderGoogle = "google"
+	ProviderOIDC   = "oidc"
+)
+
+// OAuthProviderConfig lists the upstream providers users can sign in with.
+// With several providers, users whose email domain or client has no routing
+// rule choose one on a selection page.
+type OAuthProviderConfig struct {
+	Provider        string            `default:"google" envconfig:"OAUTH_PROVIDER"` // comma-separated
+	ProviderDomains map[string]string `envconfig:"OAUTH_PROVIDER_DOMAINS"`          // email domain:provider
+	ProviderClients map[string]string `envconfig:"OAUTH_PROVIDER_CLIENTS"`          // client_id:provider
+	Providers       []string          `ignored:"true"`
+}
+
+// OAuthGoogleConfig is required if the upstream provider is google.
 type OAuthGoogleConfig struct {
-	GoogleClientID     string `required:"true" envconfig:"OAUTH_GOOGLE_CLIENT_ID"`
-	GoogleClientSecret string `required:"true" envconfig:"OAUTH_GOOGLE_CLIENT_SECRET"`
-	GoogleRedirectURI  string `required:"true" envconfig:"OAUTH_GOOGLE_REDIRECT_URI"`
+	GoogleClientID     string `envconfig:"OAUTH_GOOGLE_CLIENT_ID"`
+	GoogleClientSecret string `envconfig:"OAUTH_GOOGLE_CLIENT_SECRET"`
+	GoogleRedirectURI  string `envconfig:"OAUTH_GOOGLE_REDIRECT_URI"`
 	GoogleScopes       string `default:"openid,profile,email" envconfig:"OAUTH_GOOGLE_SCOPES"`
 }
 
+// OAuthOIDCConfig is required if the upstream provider is oidc.
+type OAuthOIDCConfig struct {
+	OIDCIssuer             string `envconfig:"OAUTH_OIDC_ISSUER"`
+	OIDCClientID           string `envconfig:"OAUTH_OIDC_CLIENT_ID"`
+	OIDCClientSecret       string `envconfig:"OAUTH_OIDC_CLIENT_SECRET"`
+	OIDCRedirectURI        string `envconfig:"OAUTH_OIDC_REDIRECT_URI"`
+	OIDCScopes             string `default:"openid,profile,email" envconfig:"OAUTH_OIDC_SCOPES"`
+	OIDCClaimSubject       string `default:"sub" envconfig:"OAUTH_OIDC_CLAIM_SUBJECT"`
+	OIDCClaimEmail         string `default:"email" envconfig:"OAUTH_OIDC_CLAIM_EMAIL"`
+	OIDCClaimEmailVerified string `default:"email_verified" envconfig:"OAUTH_OIDC_CLAIM_EMAIL_VERIFIED"`
+	OIDCClaimName          string `default:"name" envconfig:"OAUTH_OIDC_CLAIM_NAME"`
+	OIDCDisplayName        string `default:"Single Sign-On" envconfig:"OAUTH_OIDC_DISPLAY_NAME"`
+}
+
+// OAuthGitHubConfig is required if the upstream provider is github.
+type OAuthGitHubConfig struct {
+	GitHubClientID     string `envconfig:"OAUTH_GITHUB_CLIENT_ID"`
+	GitHubClientSecret string `envconfig:"OAUTH_GITHUB_CLIENT_SECRET"`
+	GitHubRedirectURI  string `envconfig:"OAUTH_GITHUB_REDIRECT_URI"`
+	GitHubScopes       string `default:"read:user,user:email" envconfig:"OAUTH_GITHUB_SCOPES"`
+	GitHubURL          string `default:"https://github.com" envconfig:"OAUTH_GITHUB_URL"`
+	GitHubAPIURL       string `default:"https://api.github.com" envconfig:"OAUTH_GITHUB_API_URL"`
+}
+
+// OAuthDevConfig configures the development provider. It lets anyone sign in
+// as a test user and has to be enabled explicitly.
+type OAuthDevConfig struct {
+	DevEnabled bool   `default:"false" envconfig:"OAUTH_DEV_ENABLED"`
+	DevUsers   string `default:"alice@example.com,bob@example.com" envconfig:"OAUTH_DEV_USERS"`
+}
+
+// SignInPolicyConfig restricts who may sign in. All lists are comma-separated,
+// hosted domains only apply to the google provider.
+type SignInPolicyConfig struct {
+	SignInHostedDomains        string `envconfig:"SIGNIN_HOSTED_DOMAINS"`
+	SignInEmailDomains         string `envconfig:"SIGNIN_EMAIL_DOMAINS"`
+	SignInAllowedEmails        string `envconfig:"SIGNIN_ALLOWED_EMAILS"`
+	SignInDeniedEmails         string `envconfig:"SIGNIN_DENIED_EMAILS"`
+	SignInRequireEmailVerified bool   `default:"true" envconfig:"SIGNIN_REQUIRE_EMAIL_VERIFIED"`
+}
+
+type OAuthTokenConfig struct {
+	AccessTokenFormat      string `default:"opaque" envconfig:"OAUTH_ACCESS_TOKEN_FORMAT"`
+	SigningKeyFiles        string `envconfig:"OAUTH_SIGNING_KEY_FILES"`
+	IntrospectionClientIDs string `envconfig:"OAUTH_INTROSPECTION_CLIENT_IDS"` // comma-separated
+}
+
+// VaultConfig configures the vault of the upstream tokens. VaultKeys is a
+// comma-separated list of base64 encoded 32 byte keys, the first one encrypts.
+// It may only be empty in development.
+type VaultConfig struct {
+	VaultKeys          string        `envconfig:"VAULT_KEYS"`
+	VaultRefreshBefore time.Duration `default:"1m" envconfig:"VAULT_REFRESH_BEFORE"`
+}
+
+// AdminConfig enables the admin API, which is authenticated with
+// AdminAPIKey as bearer token.
+type AdminConfig struct {
+	AdminAPIKey string `envconfig:"ADMIN_API_KEY"`
+}
+
+// ProtectedResourceMetadataPath is the well-known path of the RFC 9728
+// protected resource metadata. Each proxy route publishes its own document at
+// this path suffixed with the route pattern.
+const ProtectedResourceMetadataPath = "/.well-known/oauth-protected-resource"
+
+type TokenInfoCacheConfig struct {
+	TokenInfoCacheSize        int           `default:"10000" envconfig:"TOKENINFO_CACHE_SIZE"`
+	TokenInfoCacheMaxTTL      time.Duration `default:"5m" envconfig:"TOKENINFO_CACHE_MAX_TTL"`
+	TokenInfoCacheNegativeTTL time.Duration `default:"30s" envconfig:"TOKENINFO_CACHE_NEGATIVE_TTL"`
+	TokenInfoCacheRedis       bool          `default:"false" envconfig:"TOKENINFO_CACHE_REDIS"`
+	ExpvarEnabled             bool          `default:"false" envconfig:"EXPVAR_ENABLED"`
+}
+
+// Token validator types of a proxy route
+const (
+	ValidatorGateway       = "gateway"
+	ValidatorGoogle        = "google"
+	ValidatorJWT           = "jwt"
+	ValidatorIntrospection = "introspection"
+)
+
+// ValidatorConfig selects how a proxy route validates bearer tokens.
+type ValidatorConfig struct {
+	Type             string `yaml:"type"`
+	Issuer           string `yaml:"issuer"`
+	Audience         string `yaml:"audience"` // defaults to the resource of the route
+	JWKSURL          string `yaml:"jwks_url"`
+	IntrospectionURL string `yaml:"introspection_url"`
+	ClientID         string `yaml:"client_id"`
+	ClientSecret     string `yaml:"client_secret"` // environment variables are expanded
+}
+
+// Identity claims a proxy route can forward to its MCP server
+const (
+	IdentitySubject   = "subject"
+	IdentityEmail     = "email"
+	IdentityName      = "name"
+	IdentityClientID  = "client_id"
+	IdentityRequestID = "request_id"
+)
+
+// DefaultIdentityHeaders are the identity headers of routes that do not
+// configure their own, keyed by claim.
+var DefaultIdentityHeaders = map[string]string{
+	IdentitySubject:   "X-Forwarded-User",
+	IdentityEmail:     "X-Forwarded-Email",
+	IdentityName:      "X-Forwarded-Name",
+	IdentityClientID:  "X-Forwarded-Client-Id",
+	IdentityRequestID: "X-Request-Id",
+}
+
+// DefaultIdentityAssertionHeader is the header identity assertions are sent
+// in unless the route configures its own.
+const DefaultIdentityAssertionHeader = "X-Gateway-Identity"
+
+// IdentityAssertionConfig makes a proxy route send a JWT signed by the gateway
+// with the identity of every request.
+type IdentityAssertionConfig struct {
+	Header string `yaml:"header"` // Authorization replaces the bearer token
+}
+
+// Load balancing policies of proxy routes with several targets
+const (
+	LoadBalancingRoundRobin       = "round_robin"
+	LoadBalancingLeastConnections = "least_connections"
+)
+
+// HealthCheckConfig makes the gateway probe the targets of a proxy route and
+// drain the unhealthy ones.
+type HealthCheckConfig struct {
+	Path               string        `yaml:"path"` // requested on the host of each target
+	Interval           time.Duration `yaml:"interval"`
+	Timeout            time.Duration `yaml:"timeout"`
+	UnhealthyThreshold int           `yaml:"unhealthy_threshold"` // failed checks until a target is drained
+	HealthyThreshold   int           `yaml:"healthy_threshold"`   // passed checks until it is used again
+}
+
+// Process modes of stdio routes
+const (
+	StdioModeSession = "session" // one process per MCP session
+	StdioModePool    = "pool"    // sessions share a pool of processes
+)
+
+// DefaultStdioIdleTimeout closes the MCP sessions of stdio routes that do not
+// configure their own idle timeout.
+const DefaultStdioIdleTimeout = 15 * time.Minute
+
+// StdioConfig makes a proxy route launch an MCP server that speaks JSON-RPC
+// on stdin and stdout, instead of forwarding to a target URL.
+type StdioConfig struct {
+	Command     string            `yaml:"command"`
+	Args        []string          `yaml:"args"`
+	Env         map[string]string `yaml:"env"` // values are expanded
+	Dir         string            `yaml:"dir"` // working directory
+	Mode        string            `yaml:"mode"`
+	PoolSize    int               `yaml:"pool_size"`    // processes of pool mode
+	IdleTimeout *time.Duration    `yaml:"idle_timeout"` // close sessions without requests, 0 disables
+}
+
+// aggregatePrefixRegexp matches the prefixes of aggregated MCP servers. They
+// are URI schemes as well.
+var aggregatePrefixRegexp = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// AggregateServerConfig adds the MCP server of a proxy route to an aggregate
+// route. Its tools and prompts are prefixed with Prefix and an underscore, its
+// resource URIs with Prefix and a plus.
+type AggregateServerConfig struct {
+	Prefix string `yaml:"prefix"`
+	Route  string `yaml:"route"` // pattern of the proxy route
+}
+
+// Stream durations of routes that do not configure their own
+const (
+	DefaultStreamIdleTimeout = 5 * time.Minute
+	DefaultStreamMaxDuration = time.Hour
+)
+
 type ProxyConfig struct {
-	Pattern   string
-	TargetURL *url.URL
+	Pattern               string
+	TargetURLs            []*url.URL               // replicas of the MCP server
+	Stdio                 *StdioConfig             // launched MCP server, instead of TargetURLs
+	Aggregate             []*AggregateServerConfig // MCP servers of other routes, instead of TargetURLs
+	Rewrite               string                   // path appended to the target url, see Rewrite
+	ResourcePath          string                   // static prefix of the pattern
+	LoadBalancing         string
+	HealthCheck           *HealthCheckConfig
+	Resource              string // RFC 8707 resource indicator: BaseURL + ResourcePath
+	ResourceMetadataURL   string // RFC 9728 metadata document of the resource
+	Scopes                []string
+	GoogleScopes          []string // upstream Google scopes the MCP server needs
+	ResourceDocumentation string
+	ResourcePolicyURI     string
+	ResourceTosURI        string
+	LegacyAuthErrors      bool // answer authentication errors with HTTP 200
+	Validator             ValidatorConfig
+	IdentityHeaders       map[string]string // header names keyed by identity claim
+	IdentityAssertion     *IdentityAssertionConfig
+	StreamIdleTimeout     time.Duration // close requests the MCP server is silent on
+	StreamMaxDuration     time.Duration // close event streams, clients resume them
 }
 
 type Config struct {
 	BaseConfig
+	OAuthProviderConfig
 	OAuthGoogleConfig
+	OAuthOIDCConfig
+	OAuthGitHubConfig
+	OAuthDevConfig
+	SignInPolicyConfig
+	OAuthTokenConfig
+	VaultConfig
+	TokenInfoCacheConfig
+	AdminConfig
 }
 
 func NewConfig() (*Config, []*ProxyConfig, error) {
@@ -48,10 +276,86 @@ func NewConfig() (*Config, []*ProxyConfig, error) {
 		return nil, nil, fmt.Errorf("base url must not end with a slash: %s", cfg.BaseURL)
 	}
 
+	cfg.Providers = SplitList(cfg.Provider)
+	if len(cfg.Providers) == 0 {
+		return nil, nil, fmt.Errorf("at least one provider is required")
+	}
+	for i, provider := range cfg.Providers {
+		if slices.Contains(cfg.Providers[:i], provider) {
+			return nil, nil, fmt.Errorf("provider is configured twice: %s", provider)
+		}
+		switch provider {
+		case ProviderGoogle:
+			if cfg.GoogleClientID == "" || cfg.GoogleClientSecret == "" || cfg.GoogleRedirectURI == "" {
+				return nil, nil, fmt.Errorf("google client id, secret and redirect uri are required for the google provider")
+			}
+		case ProviderOIDC:
+			if cfg.OIDCIssuer == "" || cfg.OIDCClientID == "" || cfg.OIDCRedirectURI == "" {
+				return nil, nil, fmt.Errorf("oidc issuer, client id and redirect uri are required for the oidc provider")
+			}
+		case ProviderGitHub:
+			if cfg.GitHubClientID == "" || cfg.GitHubClientSecret == "" || cfg.GitHubRedirectURI == "" {
+				return nil, nil, fmt.Errorf("github client id, secret and redirect uri are required for the github provider")
+			}
+		case ProviderDev:
+			if !cfg.DevEnabled {
+				return nil, nil, fmt.Errorf("the dev provider lets anyone sign in and must be enabled with OAUTH_DEV_ENABLED=true")
+			}
+			if len(SplitList(cfg.DevUsers)) == 0 {
+				return nil, nil, fmt.Errorf("test users are required for the dev provider")
+			}
+		default:
+			return nil, nil, fmt.Errorf("provider must be google, oidc, github or dev: %s", provider)
+		}
+	}
+	for domain, provider := range cfg.ProviderDomains {
+		if !slices.Contains(cfg.Providers, provider) {
+			return nil, nil, fmt.Errorf("provider of domain %s is not configured: %s", domain, provider)
+		}
+	}
+	for clientID, provider := range cfg.ProviderClients {
+		if !slices.Contains(cfg.Providers, provider) {
+			return nil, nil, fmt.Errorf("provider of client %s is not configured: %s", clientID, provider)
+		}
+	}
+
+	switch cfg.AccessTokenFormat {
+	case "opaque":
+	case "jwt":
+		if cfg.SigningKeyFiles == "" {
+			return nil, nil, fmt.Errorf("signing key files are required for jwt access tokens")
+		}
+	default:
+		return nil, nil, fmt.Errorf("access token format must be opaque or jwt: %s", cfg.AccessTokenFormat)
+	}
+
+	// Gateway instances share the upstream tokens, which a random key per
+	// instance would make unreadable to the others and lose on restart
+	if cfg.VaultKeys == "" && !cfg.DevEnabled {
+		return nil, nil, fmt.Errorf("vault keys are required, a random key is only generated with OAUTH_DEV_ENABLED=true")
+	}
+
 	// Load proxy settings from config.yaml if exists
 	type proxyConfig struct {
-		Pattern   string `yaml:"pattern"`
-		TargetURL string `yaml:"target_url"`
+		Pattern               string                   `yaml:"pattern"`
+		TargetURL             string                   `yaml:"target_url"`
+		TargetURLs            []string                 `yaml:"target_urls"`
+		Stdio                 *StdioConfig             `yaml:"stdio"`
+		Aggregate             []*AggregateServerConfig `yaml:"aggregate"`
+		Rewrite               string                   `yaml:"rewrite"`
+		LoadBalancing         string                   `yaml:"load_balancing"`
+		HealthCheck           *HealthCheckConfig       `yaml:"health_check"`
+		Scopes                []string                 `yaml:"scopes"`
+		GoogleScopes          []string                 `yaml:"google_scopes"`
+		ResourceDocumentation string                   `yaml:"resource_documentation"`
+		ResourcePolicyURI     string                   `yaml:"resource_policy_uri"`
+		ResourceTosURI        string                   `yaml:"resource_tos_uri"`
+		LegacyAuthErrors      bool                     `yaml:"legacy_auth_errors"`
+		Validator             *ValidatorConfig         `yaml:"validator"`
+		IdentityHeaders       map[string]string        `yaml:"identity_headers"`
+		IdentityAssertion     *IdentityAssertionConfig `yaml:"identity_assertion"`
+		StreamIdleTimeout     *time.Duration           `yaml:"stream_idle_timeout"`
+		StreamMaxDuration     *time.Duration           `yaml:"stream_max_duration"`
 	}
 
 	f, err := os.Open("config.yaml")
@@ -69,31 +373,337 @@ func NewConfig() (*Config, []*ProxyConfig, error) {
 	}
 
 	proxyConfigs := []*ProxyConfig{}
+	patterns := []*RoutePattern{}
 	for _, p := range proxies.Proxies {
-		if p.TargetURL == "" || p.Pattern == "" {
+		targets := p.TargetURLs
+		if p.TargetURL != "" {
+			targets = append([]string{p.TargetURL}, targets...)
+		}
+		if len(targets) == 0 && p.Stdio == nil && len(p.Aggregate) == 0 || p.Pattern == "" {
 			return nil, nil, fmt.Errorf("target url and pattern are required for proxy: %v", p)
 		}
-		if !strings.HasPrefix(p.TargetURL, "http") {
-			return nil, nil, fmt.Errorf("target url must start with http(s): %v", p)
+		if len(targets) > 0 && p.Stdio != nil || len(p.Aggregate) > 0 && (len(targets) > 0 || p.Stdio != nil) {
+			return nil, nil, fmt.Errorf("target url, stdio and aggregate are mutually exclusive: %v", p)
 		}
-		if strings.HasSuffix(p.TargetURL, "/") {
-			return nil, nil, fmt.Errorf("target url must not end with a slash: %v", p)
+		pattern, err := ParsePattern(p.Pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid pattern: %w: %v", err, p)
 		}
-		if !strings.HasPrefix(p.Pattern, "/") {
-			return nil, nil, fmt.Errorf("pattern must start with a slash: %v", p)
+		for i, other := range patterns {
+			if pattern.Overlaps(other) {
+				return nil, nil, fmt.Errorf("pattern overlaps %s: %v", proxies.Proxies[i].Pattern, p)
+			}
+			if pattern.ResourcePath() == other.ResourcePath() {
+				return nil, nil, fmt.Errorf("pattern has the same resource as %s: %v", proxies.Proxies[i].Pattern, p)
+			}
 		}
-		if strings.HasSuffix(p.Pattern, "/") {
-			return nil, nil, fmt.Errorf("pattern must not end with a slash: %v", p)
+		patterns = append(patterns, pattern)
+		rewrite := p.Rewrite
+		if rewrite == "" {
+			rewrite = pattern.DefaultRewrite()
 		}
-		url, err := url.Parse(p.TargetURL)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to parse target url: %w", err)
+		if err := pattern.CheckRewrite(rewrite); err != nil {
+			return nil, nil, fmt.Errorf("invalid rewrite: %w: %v", err, p)
+		}
+		targetURLs := make([]*url.URL, 0, len(targets))
+		for _, target := range targets {
+			if !strings.HasPrefix(target, "http") {
+				return nil, nil, fmt.Errorf("target url must start with http(s): %v", p)
+			}
+			if strings.HasSuffix(target, "/") {
+				return nil, nil, fmt.Errorf("target url must not end with a slash: %v", p)
+			}
+			url, err := url.Parse(target)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse target url: %w", err)
+			}
+			targetURLs = append(targetURLs, url)
+		}
+		loadBalancing := p.LoadBalancing
+		switch loadBalancing {
+		case "":
+			loadBalancing = LoadBalancingRoundRobin
+		case LoadBalancingRoundRobin, LoadBalancingLeastConnections:
+		default:
+			return nil, nil, fmt.Errorf("load balancing must be round_robin or least_connections: %v", p)
+		}
+		stdio := p.Stdio
+		if stdio != nil {
+			if stdio.Command == "" {
+				return nil, nil, fmt.Errorf("command is required for stdio: %v", p)
+			}
+			if p.Rewrite != "" || p.LoadBalancing != "" || p.HealthCheck != nil {
+				return nil, nil, fmt.Errorf("rewrite, load balancing and health checks do not apply to stdio: %v", p)
+			}
+			if p.IdentityHeaders != nil || p.IdentityAssertion != nil {
+				return nil, nil, fmt.Errorf("identity headers and assertions do not apply to stdio: %v", p)
+			}
+			switch stdio.Mode {
+			case "":
+				stdio.Mode = StdioModeSession
+			case StdioModeSession, StdioModePool:
+			default:
+				return nil, nil, fmt.Errorf("stdio mode must be session or pool: %v", p)
+			}
+			if stdio.PoolSize == 0 {
+				stdio.PoolSize = 1
+			}
+			if stdio.PoolSize < 0 {
+				return nil, nil, fmt.Errorf("stdio pool size must not be negative: %v", p)
+			}
+			if stdio.IdleTimeout == nil {
+				idleTimeout := DefaultStdioIdleTimeout
+				stdio.IdleTimeout = &idleTimeout
+			}
+			if *stdio.IdleTimeout < 0 {
+				return nil, nil, fmt.Errorf("stdio idle timeout must not be negative: %v", p)
+			}
+			for name, value := range stdio.Env {
+				stdio.Env[name] = os.ExpandEnv(value)
+			}
+		}
+		if len(p.Aggregate) > 0 {
+			if p.Rewrite != "" || p.LoadBalancing != "" || p.HealthCheck != nil || p.IdentityHeaders != nil || p.IdentityAssertion != nil {
+				return nil, nil, fmt.Errorf("rewrite, load balancing, health checks and identity apply to the aggregated routes: %v", p)
+			}
+			if pattern.ResourcePath() != p.Pattern {
+				return nil, nil, fmt.Errorf("aggregate pattern must not have parameters or a wildcard: %v", p)
+			}
+		}
+		for i, server := range p.Aggregate {
+			if server == nil || !aggregatePrefixRegexp.MatchString(server.Prefix) {
+				return nil, nil, fmt.Errorf("aggregate prefix must be lowercase letters, digits and hyphens: %v", p)
+			}
+			for _, other := range p.Aggregate[:i] {
+				if server.Prefix == other.Prefix || server.Route == other.Route {
+					return nil, nil, fmt.Errorf("aggregate prefix or route is used twice: %v", p)
+				}
+			}
+		}
+		healthCheck := p.HealthCheck
+		if healthCheck != nil {
+			if !strings.HasPrefix(healthCheck.Path, "/") {
+				return nil, nil, fmt.Errorf("health check path must start with a slash: %v", p)
+			}
+			if healthCheck.Interval == 0 {
+				healthCheck.Interval = 10 * time.Second
+			}
+			if healthCheck.Timeout == 0 {
+				healthCheck.Timeout = 2 * time.Second
+			}
+			if healthCheck.UnhealthyThreshold == 0 {
+				healthCheck.UnhealthyThreshold = 3
+			}
+			if healthCheck.HealthyThreshold == 0 {
+				healthCheck.HealthyThreshold = 2
+			}
+			if healthCheck.Interval < 0 || healthCheck.Timeout < 0 || healthCheck.UnhealthyThreshold < 0 || healthCheck.HealthyThreshold < 0 {
+				return nil, nil, fmt.Errorf("health check settings must not be negative: %v", p)
+			}
+		}
+		// Google routes accept Google access tokens besides gateway tokens,
+		// other or several upstream providers only gateway tokens
+		validator := ValidatorConfig{Type: ValidatorGoogle}
+		if len(cfg.Providers) != 1 || cfg.Providers[0] != ProviderGoogle {
+			validator.Type = ValidatorGateway
+		}
+		if p.Validator != nil {
+			validator = *p.Validator
+		}
+		switch validator.Type {
+		case ValidatorGateway:
+		case ValidatorGoogle:
+		case ValidatorJWT:
+			if validator.Issuer == "" {
+				return nil, nil, fmt.Errorf("issuer is required for jwt validator: %v", p)
+			}
+		case ValidatorIntrospection:
+			if validator.IntrospectionURL == "" {
+				return nil, nil, fmt.Errorf("introspection url is required for introspection validator: %v", p)
+			}
+		default:
+			return nil, nil, fmt.Errorf("validator type must be gateway, google, jwt or introspection: %v", p)
+		}
+		if len(p.GoogleScopes) > 0 {
+			if !slices.Contains(cfg.Providers, ProviderGoogle) {
+				return nil, nil, fmt.Errorf("google scopes require the google provider: %v", p)
+			}
+			if validator.Type != ValidatorGoogle && validator.Type != ValidatorGateway {
+				return nil, nil, fmt.Errorf("google scopes require the google or gateway validator: %v", p)
+			}
+		}
+		// An empty map forwards no identity
+		identityHeaders := p.IdentityHeaders
+		if identityHeaders == nil && stdio == nil && len(p.Aggregate) == 0 {
+			identityHeaders = DefaultIdentityHeaders
+		}
+		for claim, header := range identityHeaders {
+			switch claim {
+			case IdentitySubject, IdentityEmail, IdentityName, IdentityClientID, IdentityRequestID:
+			default:
+				return nil, nil, fmt.Errorf("identity claim must be subject, email, name, client_id or request_id: %v", p)
+			}
+			if header == "" || strings.ContainsAny(header, " \t:") {
+				return nil, nil, fmt.Errorf("invalid identity header name %q: %v", header, p)
+			}
+			if strings.EqualFold(header, "Authorization") || strings.EqualFold(header, "Host") {
+				return nil, nil, fmt.Errorf("identity header must not replace %s: %v", header, p)
+			}
+		}
+		identityAssertion := p.IdentityAssertion
+		if identityAssertion != nil {
+			if cfg.SigningKeyFiles == "" {
+				return nil, nil, fmt.Errorf("signing key files are required for identity assertions: %v", p)
+			}
+			if identityAssertion.Header == "" {
+				identityAssertion.Header = DefaultIdentityAssertionHeader
+			}
+			if strings.ContainsAny(identityAssertion.Header, " \t:") || strings.EqualFold(identityAssertion.Header, "Host") {
+				return nil, nil, fmt.Errorf("invalid identity assertion header name %q: %v", identityAssertion.Header, p)
+			}
+			for _, header := range identityHeaders {
+				if strings.EqualFold(header, identityAssertion.Header) {
+					return nil, nil, fmt.Errorf("identity assertion header %s is already an identity header: %v", header, p)
+				}
+			}
+		}
+		// Zero disables the limit
+		streamIdleTimeout := DefaultStreamIdleTimeout
+		if p.StreamIdleTimeout != nil {
+			streamIdleTimeout = *p.StreamIdleTimeout
+		}
+		streamMaxDuration := DefaultStreamMaxDuration
+		if p.StreamMaxDuration != nil {
+			streamMaxDuration = *p.StreamMaxDuration
+		}
+		if streamIdleTimeout < 0 || streamMaxDuration < 0 {
+			return nil, nil, fmt.Errorf("stream durations must not be negative: %v", p)
 		}
+		if validator.Audience == "" {
+			validator.Audience = cfg.BaseURL + pattern.ResourcePath()
+		}
+		validator.ClientSecret = os.ExpandEnv(validator.ClientSecret)
 		proxyConfigs = append(proxyConfigs, &ProxyConfig{
-			Pattern:   p.Pattern,
-			TargetURL: url,
+			Pattern:               p.Pattern,
+			TargetURLs:            targetURLs,
+			Stdio:                 stdio,
+			Aggregate:             p.Aggregate,
+			LoadBalancing:         loadBalancing,
+			HealthCheck:           healthCheck,
+			Rewrite:               rewrite,
+			ResourcePath:          pattern.ResourcePath(),
+			Resource:              cfg.BaseURL + pattern.ResourcePath(),
+			ResourceMetadataURL:   cfg.BaseURL + ProtectedResourceMetadataPath + pattern.ResourcePath(),
+			Scopes:                p.Scopes,
+			GoogleScopes:          p.GoogleScopes,
+			ResourceDocumentation: p.ResourceDocumentation,
+			ResourcePolicyURI:     p.ResourcePolicyURI,
+			ResourceTosURI:        p.ResourceTosURI,
+			LegacyAuthErrors:      p.LegacyAuthErrors,
+			Validator:             validator,
+			IdentityHeaders:       identityHeaders,
+			IdentityAssertion:     identityAssertion,
+			StreamIdleTimeout:     streamIdleTimeout,
+			StreamMaxDuration:     streamMaxDuration,
 		})
 	}
 
+	if err := resolveAggregates(proxyConfigs); err != nil {
+		return nil, nil, err
+	}
+
 	return &cfg, proxyConfigs, nil
 }
+
+// resolveAggregates checks that aggregate routes only aggregate proxy routes
+// with fixed paths. Aggregate routes without scopes publish and request the
+// scopes of the routes they aggregate.
+//
+// Aggregated routes are served behind the validator of the aggregate route,
+// their own validator and scope checks do not run. They must therefore use
+// the same validator, and the aggregate route must require all their scopes.
+func resolveAggregates(proxyConfigs []*ProxyConfig) error {
+	routes := make(map[string]*ProxyConfig, len(proxyConfigs))
+	for _, p := range proxyConfigs {
+		routes[p.Pattern] = p
+	}
+
+	for _, p := range proxyConfigs {
+		if len(p.Aggregate) == 0 {
+			continue
+		}
+		var scopes, googleScopes []string
+		for _, server := range p.Aggregate {
+			route, ok := routes[server.Route]
+			if !ok {
+				return fmt.Errorf("aggregated route %s is not configured: %v", server.Route, p)
+			}
+			if len(route.Aggregate) > 0 || route.ResourcePath != route.Pattern {
+				return fmt.Errorf("aggregated route %s must be a proxy route without parameters or wildcard: %v", server.Route, p)
+			}
+			if !sameValidator(route.Validator, p.Validator) {
+				return fmt.Errorf("aggregated route %s must use the validator of the aggregate route: %v", server.Route, p)
+			}
+			for _, scope := range route.Scopes {
+				if !slices.Contains(scopes, scope) {
+					scopes = append(scopes, scope)
+				}
+			}
+			for _, scope := range route.GoogleScopes {
+				if !slices.Contains(googleScopes, scope) {
+					googleScopes = append(googleScopes, scope)
+				}
+			}
+		}
+		if p.Scopes == nil {
+			p.Scopes = scopes
+		}
+		if p.GoogleScopes == nil {
+			p.GoogleScopes = googleScopes
+		}
+		if missing := missingScopes(p.Scopes, scopes); len(missing) > 0 {
+			return fmt.Errorf("aggregate route must require the scopes %v of the routes it aggregates: %v", missing, p)
+		}
+		if missing := missingScopes(p.GoogleScopes, googleScopes); len(missing) > 0 {
+			return fmt.Errorf("aggregate route must require the google scopes %v of the routes it aggregates: %v", missing, p)
+		}
+	}
+	return nil
+}
+
+// sameValidator reports whether tokens accepted by b are valid for a. The
+// google and gateway validators swap tokens for the Google access token, so
+// their type is enough. Routes with other validators forward the client's
+// token, which has to be meant for the same issuer and audience.
+func sameValidator(a, b ValidatorConfig) bool {
+	switch {
+	case a.Type != b.Type:
+		return false
+	case a.Type == ValidatorJWT, a.Type == ValidatorIntrospection:
+		return a == b
+	default:
+		return true
+	}
+}
+
+func missingScopes(granted, required []string) []string {
+	var missing []string
+	for _, scope := range required {
+		if !slices.Contains(granted, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// SplitList splits a comma-separated config value and trims whitespace from
+// each element. Empty elements are dropped.
+func SplitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestResolveAggregates(t *testing.T) {
+	jwt := func(audience string) ValidatorConfig {
+		return ValidatorConfig{Type: ValidatorJWT, Issuer: "https://auth.example.com", Audience: audience}
+	}
+	member := func(pattern string, validator ValidatorConfig, scopes ...string) *ProxyConfig {
+		return &ProxyConfig{Pattern: pattern, ResourcePath: pattern, Validator: validator, Scopes: scopes}
+	}
+	aggregate := func(validator ValidatorConfig, scopes []string, routes ...string) *ProxyConfig {
+		p := &ProxyConfig{Pattern: "/mcp", ResourcePath: "/mcp", Validator: validator, Scopes: scopes}
+		for _, route := range routes {
+			p.Aggregate = append(p.Aggregate, &AggregateServerConfig{Prefix: route[1:5], Route: route})
+		}
+		return p
+	}
+	google := ValidatorConfig{Type: ValidatorGoogle}
+	gateway := ValidatorConfig{Type: ValidatorGateway}
+
+	testCases := []struct {
+		name           string
+		routes         []*ProxyConfig
+		expectedErr    bool
+		expectedScopes []string
+	}{
+		{
+			name: "scopes of the members",
+			routes: []*ProxyConfig{
+				member("/calc/mcp", google, "calc"),
+				member("/file/mcp", google, "files"),
+				aggregate(google, nil, "/calc/mcp", "/file/mcp"),
+			},
+			expectedScopes: []string{"calc", "files"},
+		},
+		{
+			name: "own scopes covering the members",
+			routes: []*ProxyConfig{
+				member("/calc/mcp", google, "calc"),
+				aggregate(google, []string{"calc", "all"}, "/calc/mcp"),
+			},
+			expectedScopes: []string{"calc", "all"},
+		},
+		{
+			name: "own scopes missing a member scope",
+			routes: []*ProxyConfig{
+				member("/calc/mcp", google, "calc"),
+				member("/file/mcp", google, "files"),
+				aggregate(google, []string{"calc"}, "/calc/mcp", "/file/mcp"),
+			},
+			expectedErr: true,
+		},
+		{
+			name: "other validator type",
+			routes: []*ProxyConfig{
+				member("/calc/mcp", gateway),
+				aggregate(google, nil, "/calc/mcp"),
+			},
+			expectedErr: true,
+		},
+		{
+			name: "jwt validator for the same audience",
+			routes: []*ProxyConfig{
+				member("/calc/mcp", jwt("https://mcp.example.com")),
+				aggregate(jwt("https://mcp.example.com"), nil, "/calc/mcp"),
+			},
+		},
+		{
+			name: "jwt validator for another audience",
+			routes: []*ProxyConfig{
+				member("/calc/mcp", jwt("http://localhost:8080/calc/mcp")),
+				aggregate(jwt("http://localhost:8080/mcp"), nil, "/calc/mcp"),
+			},
+			expectedErr: true,
+		},
+		{
+			name: "unknown route",
+			routes: []*ProxyConfig{
+				aggregate(google, nil, "/calc/mcp"),
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := resolveAggregates(tc.routes)
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatal("expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if scopes := tc.routes[len(tc.routes)-1].Scopes; !slices.Equal(scopes, tc.expectedScopes) {
+				t.Errorf("expected scopes %v, got %v", tc.expectedScopes, scopes)
+			}
+		})
+	}
+}
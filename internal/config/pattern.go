@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	paramNameRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+	// rewriteRefRegexp matches the parameter and wildcard references of a
+	// rewrite rule
+	rewriteRefRegexp = regexp.MustCompile(`:[A-Za-z][A-Za-z0-9_]*|\*`)
+)
+
+// RoutePattern is a parsed proxy route pattern. Segments are static,
+// :name parameters matching one segment, or a final * wildcard matching the
+// rest of the path.
+type RoutePattern struct {
+	segments []string
+	params   []string
+	wildcard bool
+}
+
+// ParsePattern checks a route pattern.
+func ParsePattern(pattern string) (*RoutePattern, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("pattern must start with a slash")
+	}
+	if strings.HasSuffix(pattern, "/") {
+		return nil, fmt.Errorf("pattern must not end with a slash")
+	}
+
+	p := &RoutePattern{segments: strings.Split(pattern[1:], "/")}
+	for i, segment := range p.segments {
+		switch {
+		case segment == "":
+			return nil, fmt.Errorf("pattern must not contain empty segments")
+		case segment == "*":
+			if i != len(p.segments)-1 {
+				return nil, fmt.Errorf("wildcard must be the last segment")
+			}
+			p.wildcard = true
+		case strings.HasPrefix(segment, ":"):
+			name := segment[1:]
+			if !paramNameRegexp.MatchString(name) {
+				return nil, fmt.Errorf("invalid parameter name %q", name)
+			}
+			if slices.Contains(p.params, name) {
+				return nil, fmt.Errorf("parameter %s is used twice", name)
+			}
+			p.params = append(p.params, name)
+		case strings.ContainsAny(segment, ":*+?"):
+			return nil, fmt.Errorf("parameters and wildcards must be whole segments")
+		}
+	}
+
+	if p.ResourcePath() == "" {
+		return nil, fmt.Errorf("pattern must start with a static segment")
+	}
+	return p, nil
+}
+
+// ResourcePath is the static part of the pattern before the first parameter
+// or wildcard. It is the path of the resource of the route.
+func (p *RoutePattern) ResourcePath() string {
+	var path string
+	for _, segment := range p.segments {
+		if segment == "*" || strings.HasPrefix(segment, ":") {
+			break
+		}
+		path += "/" + segment
+	}
+	return path
+}
+
+// Overlaps reports whether a request path could match both patterns.
+func (p *RoutePattern) Overlaps(other *RoutePattern) bool {
+	for i := 0; ; i++ {
+		if i < len(p.segments) && p.segments[i] == "*" || i < len(other.segments) && other.segments[i] == "*" {
+			return true
+		}
+		if i == len(p.segments) || i == len(other.segments) {
+			return len(p.segments) == len(other.segments)
+		}
+
+		a, b := p.segments[i], other.segments[i]
+		if a != b && !strings.HasPrefix(a, ":") && !strings.HasPrefix(b, ":") {
+			return false
+		}
+	}
+}
+
+// DefaultRewrite is the rewrite rule of routes without one. Wildcard routes
+// append the rest of the path to the target URL, other routes forward to the
+// target URL unchanged.
+func (p *RoutePattern) DefaultRewrite() string {
+	if p.wildcard {
+		return "/*"
+	}
+	return ""
+}
+
+// CheckRewrite checks that a rewrite rule only references parameters and the
+// wildcard of the pattern.
+func (p *RoutePattern) CheckRewrite(rewrite string) error {
+	if rewrite == "" {
+		return nil
+	}
+	if !strings.HasPrefix(rewrite, "/") {
+		return fmt.Errorf("rewrite must start with a slash")
+	}
+	for _, ref := range rewriteRefRegexp.FindAllString(rewrite, -1) {
+		if ref == "*" && !p.wildcard {
+			return fmt.Errorf("rewrite references the wildcard of a pattern without one")
+		}
+		if ref != "*" && !slices.Contains(p.params, ref[1:]) {
+			return fmt.Errorf("rewrite references unknown parameter %s", ref[1:])
+		}
+	}
+	return nil
+}
+
+// Rewrite expands a rewrite rule with the values of the parameters and the
+// wildcard, as returned by value.
+func Rewrite(rewrite string, value func(name string) string) string {
+	return rewriteRefRegexp.ReplaceAllStringFunc(rewrite, func(ref string) string {
+		if ref == "*" {
+			return value("*")
+		}
+		return value(ref[1:])
+	})
+}
@@ -0,0 +1,118 @@
+package config
+
+import "testing"
+
+func TestParsePattern(t *testing.T) {
+	testCases := []struct {
+		pattern              string
+		expectedErr          bool
+		expectedResourcePath string
+		expectedRewrite      string
+	}{
+		{"/calc/mcp", false, "/calc/mcp", ""},
+		{"/tools/*", false, "/tools", "/*"},
+		{"/calc/:version/mcp", false, "/calc", ""},
+		{"calc/mcp", true, "", ""},
+		{"/calc/mcp/", true, "", ""},
+		{"/calc//mcp", true, "", ""},
+		{"/tools/*/mcp", true, "", ""},
+		{"/:tenant/mcp", true, "", ""},
+		{"/calc/:1st", true, "", ""},
+		{"/calc/:v/:v", true, "", ""},
+		{"/calc/v:version", true, "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern, func(t *testing.T) {
+			p, err := ParsePattern(tc.pattern)
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatal("expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.ResourcePath(); got != tc.expectedResourcePath {
+				t.Errorf("expected resource path %q, got %q", tc.expectedResourcePath, got)
+			}
+			if got := p.DefaultRewrite(); got != tc.expectedRewrite {
+				t.Errorf("expected default rewrite %q, got %q", tc.expectedRewrite, got)
+			}
+		})
+	}
+}
+
+func TestRoutePatternOverlaps(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"/calc/mcp", "/calc/sse", false},
+		{"/calc/mcp", "/calc/mcp/v2", false},
+		{"/calc/:version/mcp", "/calc/v2/mcp", true},
+		{"/calc/:version/mcp", "/calc/:version/sse", false},
+		{"/tools/*", "/tools/search/mcp", true},
+		{"/tools/*", "/tools", true},
+		{"/tools/*", "/calc/mcp", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.a+" "+tc.b, func(t *testing.T) {
+			a, err := ParsePattern(tc.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ParsePattern(tc.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := a.Overlaps(b); got != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+			if got := b.Overlaps(a); got != tc.expected {
+				t.Errorf("expected %v in reverse, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRoutePatternCheckRewrite(t *testing.T) {
+	testCases := []struct {
+		pattern     string
+		rewrite     string
+		expectedErr bool
+	}{
+		{"/calc/:version/mcp", "/:version/mcp", false},
+		{"/tools/*", "/servers/*", false},
+		{"/calc/mcp", "", false},
+		{"/calc/:version/mcp", "v2/mcp", true},
+		{"/calc/:version/mcp", "/:tenant/mcp", true},
+		{"/calc/:version/mcp", "/*", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+" "+tc.rewrite, func(t *testing.T) {
+			p, err := ParsePattern(tc.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = p.CheckRewrite(tc.rewrite)
+			if tc.expectedErr && err == nil {
+				t.Error("expected error, got none")
+			}
+			if !tc.expectedErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	values := map[string]string{"version": "v2", "*": "search/mcp"}
+	got := Rewrite("/:version/tools/*", func(name string) string { return values[name] })
+	if expected := "/v2/tools/search/mcp"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
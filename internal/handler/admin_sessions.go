@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/schnurbus/go-mcp-gateway/internal/auth"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+	"github.com/schnurbus/go-mcp-gateway/internal/mcpsession"
+)
+
+// sessionOwner returns the user the admin API request is about. Subjects are
+// only unique per provider, so users are addressed by both.
+func sessionOwner(c *fiber.Ctx) (mcpsession.Owner, bool) {
+	provider, err := url.PathUnescape(c.Params("provider"))
+	if err != nil || provider == "" {
+		return mcpsession.Owner{}, false
+	}
+	subject, err := url.PathUnescape(c.Params("sub"))
+	if err != nil || subject == "" {
+		return mcpsession.Owner{}, false
+	}
+	return mcpsession.Owner{Provider: provider, Subject: subject}, true
+}
+
+// HandleAdminSessionsList lists the open MCP sessions of a user.
+func (h *Handler) HandleAdminSessionsList(c *fiber.Ctx) error {
+	requestId, ok := c.Locals("requestid").(string)
+	if !ok {
+		requestId = uuid.New().String()
+	}
+	log := logger.FromContext(c.Context()).With(
+		slog.String("handler", "HandleAdminSessionsList"),
+		slog.String("request_id", requestId),
+	)
+	ctx := logger.WithContext(c.Context(), log)
+
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":       "bad_request",
+			"description": "Invalid user",
+		})
+	}
+
+	sessions, err := h.sessions.List(ctx, owner)
+	if err != nil {
+		log.Error("Failed to list sessions", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":       "server_error",
+			"description": "Failed to list sessions",
+		})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sessions": sessions,
+	})
+}
+
+// HandleAdminSessionsTerminate terminates one MCP session of a user, or all of
+// them if no session id is given.
+func (h *Handler) HandleAdminSessionsTerminate(c *fiber.Ctx) error {
+	requestId, ok := c.Locals("requestid").(string)
+	if !ok {
+		requestId = uuid.New().String()
+	}
+	log := logger.FromContext(c.Context()).With(
+		slog.String("handler", "HandleAdminSessionsTerminate"),
+		slog.String("request_id", requestId),
+	)
+	ctx := logger.WithContext(c.Context(), log)
+
+	owner, ok := sessionOwner(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":       "bad_request",
+			"description": "Invalid user",
+		})
+	}
+
+	sessions, err := h.sessions.List(ctx, owner)
+	if err != nil {
+		log.Error("Failed to list sessions", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":       "server_error",
+			"description": "Failed to list sessions",
+		})
+	}
+
+	id := c.Params("id")
+	terminated := 0
+	refused := 0
+	for _, session := range sessions {
+		if id != "" && session.ID != id {
+			continue
+		}
+		if err := h.sessions.Terminate(ctx, session, h.sessionUpstreamToken(ctx, session)); err != nil {
+			if !errors.Is(err, mcpsession.ErrNotTerminated) {
+				log.Error("Failed to terminate session", "session", session.ID, "error", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error":       "server_error",
+					"description": "Failed to terminate session",
+				})
+			}
+			log.Warn("MCP server did not terminate session", "session", session.ID, "error", err)
+			refused++
+		}
+		terminated++
+	}
+
+	if id != "" && terminated == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":       "not_found",
+			"description": "Session not found",
+		})
+	}
+
+	// The gateway rejects the sessions already, but their MCP servers may
+	// keep them alive
+	if refused > 0 {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":       "bad_gateway",
+			"description": fmt.Sprintf("MCP server did not terminate %d of %d sessions", refused, terminated),
+		})
+	}
+
+	log.Info("Terminated sessions", "provider", owner.Provider, "sub", owner.Subject, "count", terminated)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// sessionUpstreamToken returns the upstream access token of the owner of
+// session, or an empty string if the gateway does not hold one, e.g. for
+// routes with the jwt validator.
+func (h *Handler) sessionUpstreamToken(ctx context.Context, session *mcpsession.Session) string {
+	grant, authErr := h.auth.UserUpstreamGrant(ctx, session.Provider, session.Subject, session.ClientID)
+	if authErr != nil {
+		if authErr.Code != auth.InvalidGrant {
+			logger.FromContext(ctx).Warn("Failed to get upstream access token", "session", session.ID, "error", authErr.Description)
+		}
+		return ""
+	}
+	return grant.AccessToken
+}
@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+	"github.com/schnurbus/go-mcp-gateway/internal/mcpsession"
+)
+
+const testAdminAPIKey = "admin-key"
+
+// mcpServer is an MCP server that ends sessions if the DELETE request
+// carries the expected upstream access token.
+type mcpServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	deleted []string
+}
+
+func newMCPServer(t *testing.T, token string) *mcpServer {
+	t.Helper()
+	s := &mcpServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		s.mu.Lock()
+		s.deleted = append(s.deleted, r.Header.Get(mcpsession.Header))
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Deleted returns the sorted ids of the sessions the server ended.
+func (s *mcpServer) Deleted() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := slices.Clone(s.deleted)
+	slices.Sort(deleted)
+	return deleted
+}
+
+func (g *testGateway) createSession(server *mcpServer, owner mcpsession.Owner, clientID, sessionID string) *mcpsession.Session {
+	g.t.Helper()
+	session := &mcpsession.Session{
+		SessionID: sessionID,
+		Route:     "/calc/mcp",
+		Target:    server.URL,
+		Endpoint:  server.URL + "/mcp",
+		Owner:     owner,
+		ClientID:  clientID,
+	}
+	if err := g.sessions.Create(context.Background(), session); err != nil {
+		g.t.Fatal(err)
+	}
+	return session
+}
+
+func (g *testGateway) admin(method, path, apiKey string) *http.Response {
+	g.t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if apiKey != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+apiKey)
+	}
+	return g.do(req)
+}
+
+func TestHandleAdminSessionsList(t *testing.T) {
+	cfg := testConfig(config.ProviderGoogle)
+	cfg.AdminAPIKey = testAdminAPIKey
+	g := newTestGateway(t, cfg, testProxies())
+	server := newMCPServer(t, "google-access-token")
+
+	alice := mcpsession.Owner{Provider: "google", Subject: "alice"}
+	g.createSession(server, alice, "client-1", "session-1")
+	g.createSession(server, alice, "client-1", "session-2")
+	g.createSession(server, mcpsession.Owner{Provider: "github", Subject: "alice"}, "client-1", "session-3")
+	g.createSession(server, mcpsession.Owner{Provider: "google", Subject: "bob"}, "client-1", "session-4")
+
+	testCases := []struct {
+		name               string
+		path               string
+		apiKey             string
+		expectedStatus     int
+		expectedSessionIDs []string
+	}{
+		{name: "sessions of the user", path: "/admin/providers/google/users/alice/sessions", apiKey: testAdminAPIKey, expectedStatus: http.StatusOK, expectedSessionIDs: []string{"session-1", "session-2"}},
+		{name: "same subject at another provider", path: "/admin/providers/github/users/alice/sessions", apiKey: testAdminAPIKey, expectedStatus: http.StatusOK, expectedSessionIDs: []string{"session-3"}},
+		{name: "user without sessions", path: "/admin/providers/google/users/carol/sessions", apiKey: testAdminAPIKey, expectedStatus: http.StatusOK, expectedSessionIDs: []string{}},
+		{name: "missing admin key", path: "/admin/providers/google/users/alice/sessions", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong admin key", path: "/admin/providers/google/users/alice/sessions", apiKey: "other-key", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := g.admin(http.MethodGet, tc.path, tc.apiKey)
+			if resp.StatusCode != tc.expectedStatus {
+				body, _ := io.ReadAll(resp.Body)
+				t.Fatalf("expected status %d, got %d: %s", tc.expectedStatus, resp.StatusCode, body)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var list struct {
+				Sessions []*mcpsession.Session `json:"sessions"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+				t.Fatal(err)
+			}
+			sessionIDs := []string{}
+			for _, session := range list.Sessions {
+				sessionIDs = append(sessionIDs, session.SessionID)
+			}
+			slices.Sort(sessionIDs)
+			if !slices.Equal(sessionIDs, tc.expectedSessionIDs) {
+				t.Errorf("expected sessions %v, got %v", tc.expectedSessionIDs, sessionIDs)
+			}
+		})
+	}
+}
+
+func TestHandleAdminSessionsTerminate(t *testing.T) {
+	testCases := []struct {
+		name               string
+		path               func(sessions []*mcpsession.Session) string
+		apiKey             string
+		signedIn           bool
+		expectedStatus     int
+		expectedTerminated []string
+	}{
+		{
+			name:               "all sessions of the user",
+			path:               func([]*mcpsession.Session) string { return "/admin/providers/google/users/12345/sessions" },
+			apiKey:             testAdminAPIKey,
+			signedIn:           true,
+			expectedStatus:     http.StatusNoContent,
+			expectedTerminated: []string{"session-1", "session-2"},
+		},
+		{
+			name: "one session",
+			path: func(sessions []*mcpsession.Session) string {
+				return "/admin/providers/google/users/12345/sessions/" + sessions[1].ID
+			},
+			apiKey:             testAdminAPIKey,
+			signedIn:           true,
+			expectedStatus:     http.StatusNoContent,
+			expectedTerminated: []string{"session-2"},
+		},
+		{
+			name:           "unknown session",
+			path:           func([]*mcpsession.Session) string { return "/admin/providers/google/users/12345/sessions/unknown" },
+			apiKey:         testAdminAPIKey,
+			signedIn:       true,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "session of another user",
+			path: func(sessions []*mcpsession.Session) string {
+				return "/admin/providers/google/users/bob/sessions/" + sessions[0].ID
+			},
+			apiKey:         testAdminAPIKey,
+			signedIn:       true,
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:               "refused without upstream token",
+			path:               func([]*mcpsession.Session) string { return "/admin/providers/google/users/12345/sessions" },
+			apiKey:             testAdminAPIKey,
+			expectedStatus:     http.StatusBadGateway,
+			expectedTerminated: []string{"session-1", "session-2"},
+		},
+		{
+			name:           "missing admin key",
+			path:           func([]*mcpsession.Session) string { return "/admin/providers/google/users/12345/sessions" },
+			signedIn:       true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "wrong admin key",
+			path:           func([]*mcpsession.Session) string { return "/admin/providers/google/users/12345/sessions" },
+			apiKey:         "other-key",
+			signedIn:       true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig(config.ProviderGoogle)
+			cfg.AdminAPIKey = testAdminAPIKey
+			g := newTestGateway(t, cfg, testProxies())
+			ctx := context.Background()
+			server := newMCPServer(t, "google-access-token")
+
+			client := g.registerClient()
+			if tc.signedIn {
+				g.signIn(client)
+			}
+			owner := mcpsession.Owner{Provider: config.ProviderGoogle, Subject: "12345"}
+			sessions := []*mcpsession.Session{
+				g.createSession(server, owner, client.ClientID, "session-1"),
+				g.createSession(server, owner, client.ClientID, "session-2"),
+			}
+
+			resp := g.admin(http.MethodDelete, tc.path(sessions), tc.apiKey)
+			if resp.StatusCode != tc.expectedStatus {
+				body, _ := io.ReadAll(resp.Body)
+				t.Fatalf("expected status %d, got %d: %s", tc.expectedStatus, resp.StatusCode, body)
+			}
+
+			// Sessions are rejected by the gateway even if the MCP server
+			// refused to end them
+			for _, session := range sessions {
+				stored, err := g.sessions.GetByID(ctx, session.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if terminated := slices.Contains(tc.expectedTerminated, session.SessionID); terminated != (stored == nil) {
+					t.Errorf("expected session %s terminated %v, got %v", session.SessionID, terminated, stored == nil)
+				}
+			}
+
+			expectedDeleted := tc.expectedTerminated
+			if tc.expectedStatus != http.StatusNoContent {
+				expectedDeleted = nil
+			}
+			if deleted := server.Deleted(); !slices.Equal(deleted, expectedDeleted) {
+				t.Errorf("expected the mcp server to end %v, got %v", expectedDeleted, deleted)
+			}
+		})
+	}
+}
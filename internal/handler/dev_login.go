@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"html/template"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+)
+
+var devLoginTemplate = template.Must(template.New("dev_login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Development sign in</title>
+<style>
+body { font-family: system-ui, sans-serif; display: flex; justify-content: center; margin-top: 10vh; }
+main { width: 20rem; }
+button { display: block; width: 100%; margin: 0.5rem 0; padding: 0.75rem; border: 1px solid #ccc; border-radius: 0.25rem; background: none; font: inherit; cursor: pointer; }
+button:hover { background: #f4f4f4; }
+</style>
+</head>
+<body>
+<main>
+<h1>Sign in as</h1>
+<p>Development provider, do not use in production.</p>
+<form method="post">
+<input type="hidden" name="state" value="{{.State}}">
+{{range .Users}}<button type="submit" name="email" value="{{.}}">{{.}}</button>
+{{end}}</form>
+</main>
+</body>
+</html>
+`))
+
+// HandleDevLogin renders the login form of the development provider.
+func (h *Handler) HandleDevLogin(c *fiber.Ctx) error {
+	if h.devProvider == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Type("html", "utf-8")
+	return devLoginTemplate.Execute(c.Response().BodyWriter(), struct {
+		State string
+		Users []string
+	}{
+		State: c.Query("state"),
+		Users: h.devProvider.Users(),
+	})
+}
+
+// HandleDevLoginSubmit signs the session in as the chosen test user and
+// redirects to the callback like an upstream provider would.
+func (h *Handler) HandleDevLoginSubmit(c *fiber.Ctx) error {
+	requestId, ok := c.Locals("requestid").(string)
+	if !ok {
+		requestId = uuid.New().String()
+	}
+	log := logger.FromContext(c.Context()).With(
+		slog.String("handler", "HandleDevLoginSubmit"),
+		slog.String("request_id", requestId),
+	)
+	ctx := logger.WithContext(c.Context(), log)
+
+	if h.devProvider == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	sess, err := h.sessionStore.Get(c)
+	if err != nil {
+		log.Error("Could not get session", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":       "internal_server_error",
+			"description": "Could not get session",
+		})
+	}
+
+	email := c.FormValue("email")
+	callbackURL, err := h.devProvider.Login(ctx, sess.ID(), c.FormValue("state"), email)
+	if err != nil {
+		log.Warn("Failed to sign in test user", "error", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":       "bad_request",
+			"description": "Unknown test user",
+		})
+	}
+
+	log.Info("Signed in test user", "email", email)
+	return c.Redirect(callbackURL, fiber.StatusFound)
+}
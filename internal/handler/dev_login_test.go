@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider/dev"
+)
+
+// devLogin submits the login form of the development provider at location.
+func (g *testGateway) devLogin(location *url.URL, email string) *http.Response {
+	g.t.Helper()
+	form := url.Values{
+		"state": {location.Query().Get("state")},
+		"email": {email},
+	}
+	req := httptest.NewRequest(http.MethodPost, location.Path, strings.NewReader(form.Encode()))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+	return g.do(req)
+}
+
+func TestHandleDevLogin_Disabled(t *testing.T) {
+	g := newTestGateway(t, testConfig(config.ProviderGoogle), testProxies())
+	location := &url.URL{Path: dev.LoginPath, RawQuery: "state=state"}
+
+	// The server does not route to the login form without the dev provider
+	if resp := g.get(location.String()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status %d for the login form, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+	if resp := g.devLogin(location, "alice@example.com"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status %d for the login, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+
+	// Neither do the handlers if they are routed anyway
+	app := fiber.New()
+	app.Get(dev.LoginPath, g.handler.HandleDevLogin)
+	app.Post(dev.LoginPath, g.handler.HandleDevLoginSubmit)
+	g.app = app
+	if resp := g.get(location.String()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status %d from the login form handler, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+	if resp := g.devLogin(location, "alice@example.com"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status %d from the login handler, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestHandleDevLogin(t *testing.T) {
+	testCases := []struct {
+		name           string
+		email          string
+		expectedStatus int
+	}{
+		{name: "test user", email: "alice@example.com", expectedStatus: http.StatusFound},
+		{name: "unknown user", email: "mallory@example.com", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig(config.ProviderDev)
+			cfg.DevUsers = "alice@example.com,bob@example.com"
+			g := newTestGateway(t, cfg, testProxies())
+			client := g.registerClient()
+
+			location := follow(t, g.authorize(client, nil))
+			if location.String() != testBaseURL+dev.LoginPath+"?"+location.RawQuery {
+				t.Fatalf("expected redirect to the login form, got %s", location)
+			}
+
+			resp := g.get(location.Path + "?" + location.RawQuery)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected the login form, got %d", resp.StatusCode)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			for _, email := range []string{"alice@example.com", "bob@example.com"} {
+				if !strings.Contains(string(body), email) {
+					t.Errorf("expected the login form to offer %s", email)
+				}
+			}
+
+			resp = g.devLogin(location, tc.email)
+			if resp.StatusCode != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+			if tc.expectedStatus != http.StatusFound {
+				return
+			}
+
+			location = follow(t, resp)
+			if location.Path != g.auth.GetCallbackPath() {
+				t.Fatalf("expected redirect to the callback, got %s", location)
+			}
+			location = follow(t, g.get(location.Path+"?"+location.RawQuery))
+			tokens := g.exchangeCode(client, location)
+
+			accessToken, authErr := g.auth.GetAccessToken(context.Background(), tokens.AccessToken)
+			if authErr != nil {
+				t.Fatal(authErr)
+			}
+			if accessToken.Provider != config.ProviderDev || accessToken.Email != tc.email {
+				t.Errorf("expected %s signed in with the dev provider, got %s with %s", tc.email, accessToken.Email, accessToken.Provider)
+			}
+		})
+	}
+}
@@ -2,58 +2,88 @@ package handler
 
 import (
 	"context"
-	"fmt"
-	"strings"
+	"slices"
 
 	"github.com/gofiber/fiber/v2/middleware/session"
 	fiberRedis "github.com/gofiber/storage/redis/v3"
 	"github.com/redis/go-redis/v9"
 	"github.com/schnurbus/go-mcp-gateway/internal/auth"
 	"github.com/schnurbus/go-mcp-gateway/internal/config"
-	"github.com/schnurbus/go-mcp-gateway/internal/provider/google"
+	"github.com/schnurbus/go-mcp-gateway/internal/mcpsession"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider/dev"
 )
 
 type Handler struct {
-	baseURL      string
-	auth         *auth.Auth
-	oauthGoogle  *google.GoogleProvider
-	sessionStore *session.Store
+	baseURL        string
+	googleClientID string
+	auth           *auth.Auth
+	upstreams      *provider.Registry
+	providerNames  map[string]string // display names of the selection page
+	router         *provider.Router
+	policy         *provider.SignInPolicy
+	devProvider    *dev.DevProvider // nil unless the dev provider is enabled
+	sessionStore   *session.Store
+	proxies        map[string]*config.ProxyConfig // keyed by resource path
+	sessions       *mcpsession.Registry
 }
 
 func NewHandler(
 	ctx context.Context,
 	rdb *redis.Client,
-	config *config.Config,
+	cfg *config.Config,
 	auth *auth.Auth,
+	upstreams *provider.Registry,
+	proxyConfigs []*config.ProxyConfig,
+	sessions *mcpsession.Registry,
 ) (*Handler, error) {
-	// Parse scopes from comma-separated string
-	var scopes []string
-	if config.OAuthGoogleConfig.GoogleScopes != "" {
-		scopes = strings.Split(config.OAuthGoogleConfig.GoogleScopes, ",")
-		// Trim whitespace from each scope
-		for i := range scopes {
-			scopes[i] = strings.TrimSpace(scopes[i])
-		}
+	// The dev provider serves its own login form
+	var devProvider *dev.DevProvider
+	if upstream, err := upstreams.Get(config.ProviderDev); err == nil {
+		devProvider, _ = upstream.(*dev.DevProvider)
 	}
 
-	oauthGoogle, err := google.NewGoogleProvider(ctx, &google.GoogleConfig{
-		GoogleClientID:     config.OAuthGoogleConfig.GoogleClientID,
-		GoogleClientSecret: config.OAuthGoogleConfig.GoogleClientSecret,
-		GoogleRedirectURI:  config.OAuthGoogleConfig.GoogleRedirectURI,
-		GoogleScopes:       scopes,
-	}, rdb)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create oauth google provider: %w", err)
+	// Plain Google access tokens are only known if Google is an upstream
+	var googleClientID string
+	if slices.Contains(cfg.Providers, config.ProviderGoogle) {
+		googleClientID = cfg.OAuthGoogleConfig.GoogleClientID
+	}
+
+	providerNames := map[string]string{
+		config.ProviderGoogle: "Google",
+		config.ProviderGitHub: "GitHub",
+		config.ProviderOIDC:   cfg.OIDCDisplayName,
+		config.ProviderDev:    "Development",
+	}
+
+	policy := &provider.SignInPolicy{
+		HostedDomains:        config.SplitList(cfg.SignInHostedDomains),
+		EmailDomains:         config.SplitList(cfg.SignInEmailDomains),
+		AllowedEmails:        config.SplitList(cfg.SignInAllowedEmails),
+		DeniedEmails:         config.SplitList(cfg.SignInDeniedEmails),
+		RequireEmailVerified: cfg.SignInRequireEmailVerified,
 	}
 
 	sessionStore := session.New(session.Config{
 		Storage: fiberRedis.NewFromConnection(rdb),
 	})
 
+	proxies := make(map[string]*config.ProxyConfig, len(proxyConfigs))
+	for _, p := range proxyConfigs {
+		proxies[p.ResourcePath] = p
+	}
+
 	return &Handler{
-		baseURL:      config.BaseURL,
-		auth:         auth,
-		oauthGoogle:  oauthGoogle,
-		sessionStore: sessionStore,
+		baseURL:        cfg.BaseURL,
+		googleClientID: googleClientID,
+		auth:           auth,
+		upstreams:      upstreams,
+		providerNames:  providerNames,
+		router:         provider.NewRouter(cfg.Providers, cfg.ProviderDomains, cfg.ProviderClients),
+		policy:         policy,
+		devProvider:    devProvider,
+		sessionStore:   sessionStore,
+		proxies:        proxies,
+		sessions:       sessions,
 	}, nil
 }
@@ -0,0 +1,299 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/auth"
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+	"github.com/schnurbus/go-mcp-gateway/internal/mcpsession"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/adminauth"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider/dev"
+	"github.com/schnurbus/go-mcp-gateway/internal/vault"
+	"golang.org/x/oauth2"
+)
+
+const (
+	testBaseURL       = "http://localhost:8080"
+	testRedirectURI   = "http://localhost:5000/callback"
+	testCodeVerifier  = "dBjftJeZ4CVP-mJ92oAC1vUKpGgRgu1I9oe7jWQ45ro"
+	testCodeChallenge = "cueRtFRndz4gRH4Ypds1Ist6HKf7uto-ONVahiz_f_s"
+)
+
+// testProvider is an upstream provider that authenticates identity without
+// any network access and records the tokens it is asked to revoke.
+type testProvider struct {
+	name     string
+	identity *provider.Identity
+
+	mu      sync.Mutex
+	revoked []string
+}
+
+func (p *testProvider) GetAuthCodeURL(ctx context.Context, sid string) (string, error) {
+	return "https://" + p.name + ".example.com/authorize?state=" + sid, nil
+}
+
+func (p *testProvider) Callback(ctx context.Context, sid, state, code string) (*provider.AuthResult, error) {
+	if state != sid {
+		return nil, errors.New("state mismatch")
+	}
+	return &provider.AuthResult{
+		Identity:     p.identity,
+		AccessToken:  p.name + "-access-token",
+		RefreshToken: p.name + "-refresh-token",
+	}, nil
+}
+
+func (p *testProvider) RefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *testProvider) RevokeToken(ctx context.Context, token string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.revoked = append(p.revoked, token)
+	return nil
+}
+
+func (p *testProvider) Revoked() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.revoked)
+}
+
+// testGateway serves the OAuth, dev and admin endpoints of a Handler the way
+// the server does.
+type testGateway struct {
+	t         *testing.T
+	app       *fiber.App
+	handler   *Handler
+	rdb       *redis.Client
+	auth      *auth.Auth
+	vault     *vault.Vault
+	sessions  *mcpsession.Registry
+	providers map[string]*testProvider
+	cookies   []*http.Cookie
+}
+
+// newTestGateway creates a gateway for cfg. Every configured provider but dev
+// is a testProvider signing in user@example.com.
+func newTestGateway(t *testing.T, cfg *config.Config, proxies []*config.ProxyConfig) *testGateway {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	key, err := vault.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := vault.NewVault(&vault.VaultConfig{Keys: [][]byte{key}}, rdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.BaseURL = testBaseURL
+	resources := []string{}
+	scopes := map[string][]string{}
+	for _, p := range proxies {
+		resources = append(resources, p.Resource)
+		scopes[p.Resource] = append(slices.Clone(p.Scopes), p.GoogleScopes...)
+	}
+	a := auth.NewAuth(&auth.AuthConfig{
+		BaseURL:           testBaseURL,
+		AccessTokenFormat: auth.AccessTokenFormatOpaque,
+		Resources:         resources,
+		Scopes:            scopes,
+		Vault:             v,
+	}, rdb)
+
+	upstreams := provider.NewRegistry()
+	providers := map[string]*testProvider{}
+	for _, name := range cfg.Providers {
+		if name == config.ProviderDev {
+			upstreams.Register(name, dev.NewDevProvider(&dev.DevConfig{
+				Users:       config.SplitList(cfg.DevUsers),
+				LoginURL:    testBaseURL + dev.LoginPath,
+				RedirectURI: a.GetCallbackURL(),
+			}, rdb))
+			continue
+		}
+		providers[name] = &testProvider{
+			name:     name,
+			identity: &provider.Identity{Subject: "12345", Email: "user@example.com", EmailVerified: true},
+		}
+		upstreams.Register(name, providers[name])
+	}
+
+	sessions := mcpsession.NewRegistry(rdb)
+	h, err := NewHandler(context.Background(), rdb, cfg, a, upstreams, proxies, sessions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Get(a.GetClientConfigurationPath(), h.HandleOAuthClientConfigurationRead)
+	app.Put(a.GetClientConfigurationPath(), h.HandleOAuthClientConfigurationUpdate)
+	app.Delete(a.GetClientConfigurationPath(), h.HandleOAuthClientConfigurationDelete)
+	app.Get(a.GetAuthorizationPath(), h.HandleOAuthAuthorize)
+	app.Get(a.GetProviderSelectionPath(), h.HandleOAuthProviderSelection)
+	app.Get(a.GetCallbackPath(), h.HandleOAuthCallback)
+	if slices.Contains(cfg.Providers, config.ProviderDev) {
+		app.Get(dev.LoginPath, h.HandleDevLogin)
+		app.Post(dev.LoginPath, h.HandleDevLoginSubmit)
+	}
+	app.Post(a.GetTokenPath(), h.HandleOauthToken)
+	if cfg.AdminAPIKey != "" {
+		admin := app.Group("/admin", adminauth.New(cfg.AdminAPIKey))
+		admin.Get("/providers/:provider/users/:sub/sessions", h.HandleAdminSessionsList)
+		admin.Delete("/providers/:provider/users/:sub/sessions", h.HandleAdminSessionsTerminate)
+		admin.Delete("/providers/:provider/users/:sub/sessions/:id", h.HandleAdminSessionsTerminate)
+	}
+
+	return &testGateway{
+		t:         t,
+		app:       app,
+		handler:   h,
+		rdb:       rdb,
+		auth:      a,
+		vault:     v,
+		sessions:  sessions,
+		providers: providers,
+	}
+}
+
+// registerClient registers a public client redirecting to testRedirectURI.
+func (g *testGateway) registerClient() *auth.Client {
+	g.t.Helper()
+	client := g.auth.Register(context.Background(), &auth.ClientMetadata{
+		RedirectURIs:            []string{testRedirectURI},
+		GrantTypes:              []string{"authorization_code", "refresh_token"},
+		ResponseTypes:           []string{"code"},
+		TokenEndpointAuthMethod: "none",
+	})
+	if err := g.auth.SaveClient(context.Background(), client.ClientID, client); err != nil {
+		g.t.Fatal(err)
+	}
+	return client
+}
+
+// do sends req like a browser, keeping the cookies of the gateway session.
+func (g *testGateway) do(req *http.Request) *http.Response {
+	g.t.Helper()
+	for _, cookie := range g.cookies {
+		req.AddCookie(cookie)
+	}
+	resp, err := g.app.Test(req, -1)
+	if err != nil {
+		g.t.Fatal(err)
+	}
+	for _, cookie := range resp.Cookies() {
+		g.cookies = slices.DeleteFunc(g.cookies, func(c *http.Cookie) bool { return c.Name == cookie.Name })
+		g.cookies = append(g.cookies, cookie)
+	}
+	return resp
+}
+
+func (g *testGateway) get(target string) *http.Response {
+	g.t.Helper()
+	return g.do(httptest.NewRequest(http.MethodGet, target, nil))
+}
+
+// authorize starts an authorization of client with the additional query
+// parameters params.
+func (g *testGateway) authorize(client *auth.Client, params url.Values) *http.Response {
+	g.t.Helper()
+	query := url.Values{
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {"code"},
+		"state":                 {"client-state"},
+		"code_challenge":        {testCodeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+	for key, values := range params {
+		query[key] = values
+	}
+	return g.get(g.auth.GetAuthorizationPath() + "?" + query.Encode())
+}
+
+// signIn authorizes client at its only provider and exchanges the code for
+// gateway tokens.
+func (g *testGateway) signIn(client *auth.Client) *auth.TokenResponse {
+	g.t.Helper()
+	location := follow(g.t, g.authorize(client, nil))
+	location = follow(g.t, g.get(callbackPath(g.auth, location)))
+	return g.exchangeCode(client, location)
+}
+
+// exchangeCode exchanges the code of the client redirect location for gateway
+// tokens.
+func (g *testGateway) exchangeCode(client *auth.Client, location *url.URL) *auth.TokenResponse {
+	g.t.Helper()
+	code := location.Query().Get("code")
+	if code == "" {
+		g.t.Fatalf("expected code, got %s", location)
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"client_id":     {client.ClientID},
+		"code_verifier": {testCodeVerifier},
+	}
+	req := httptest.NewRequest(http.MethodPost, g.auth.GetTokenPath(), strings.NewReader(form.Encode()))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+	resp := g.do(req)
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		g.t.Fatalf("expected tokens, got %d: %s", resp.StatusCode, body)
+	}
+	var tokens auth.TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		g.t.Fatal(err)
+	}
+	return &tokens
+}
+
+// follow returns the redirect location of resp.
+func follow(t *testing.T, resp *http.Response) *url.URL {
+	t.Helper()
+	if resp.StatusCode != http.StatusFound {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected redirect, got %d: %s", resp.StatusCode, body)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+// callbackPath returns the gateway callback path for the upstream redirect
+// location of a testProvider.
+func callbackPath(a *auth.Auth, location *url.URL) string {
+	return a.GetCallbackPath() + "?code=upstream-code&state=" + url.QueryEscape(location.Query().Get("state"))
+}
+
+func testConfig(providers ...string) *config.Config {
+	cfg := &config.Config{}
+	cfg.Providers = providers
+	cfg.Provider = strings.Join(providers, ",")
+	cfg.SignInRequireEmailVerified = true
+	return cfg
+}
@@ -0,0 +1,13 @@
+package handler
+
+import "github.com/gofiber/fiber/v2"
+
+func (h *Handler) HandleJWKS(c *fiber.Ctx) error {
+	jwks := h.auth.GetJWKS()
+	if jwks == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(jwks)
+}
@@ -3,14 +3,23 @@ package handler
 import "github.com/gofiber/fiber/v2"
 
 func (h *Handler) HandleOAuthAuthorizationServerMetadata(c *fiber.Ctx) error {
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"issuer":                                h.baseURL,
-		"authorization_endpoint":                h.auth.GetAuthorizationURL(),
-		"token_endpoint":                        h.auth.GetTokenURL(),
-		"registration_endpoint":                 h.auth.GetDynamicRegistrationURL(),
-		"response_types_supported":              h.auth.GetSupportResponseTypes(),
-		"grant_types_supported":                 h.auth.GetSupportGrantTypes(),
-		"token_endpoint_auth_methods_supported": h.auth.GetSupportTokenEndpointAuthMethods(),
-		"code_challenge_methods_supported":      h.auth.GetSupportCodeChallengeMethods(),
-	})
+	metadata := fiber.Map{
+		"issuer":                                        h.baseURL,
+		"authorization_endpoint":                        h.auth.GetAuthorizationURL(),
+		"token_endpoint":                                h.auth.GetTokenURL(),
+		"registration_endpoint":                         h.auth.GetDynamicRegistrationURL(),
+		"introspection_endpoint":                        h.auth.GetIntrospectionURL(),
+		"revocation_endpoint":                           h.auth.GetRevocationURL(),
+		"response_types_supported":                      h.auth.GetSupportResponseTypes(),
+		"grant_types_supported":                         h.auth.GetSupportGrantTypes(),
+		"token_endpoint_auth_methods_supported":         h.auth.GetSupportTokenEndpointAuthMethods(),
+		"code_challenge_methods_supported":              h.auth.GetSupportCodeChallengeMethods(),
+		"introspection_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"revocation_endpoint_auth_methods_supported":    h.auth.GetSupportTokenEndpointAuthMethods(),
+	}
+	if h.auth.GetJWKS() != nil {
+		metadata["jwks_uri"] = h.auth.GetJWKSURL()
+	}
+
+	return c.Status(fiber.StatusOK).JSON(metadata)
 }
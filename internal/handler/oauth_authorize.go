@@ -7,6 +7,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/schnurbus/go-mcp-gateway/internal/auth"
 	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider"
 )
 
 func (h *Handler) HandleOAuthAuthorize(c *fiber.Ctx) error {
@@ -29,6 +30,8 @@ func (h *Handler) HandleOAuthAuthorize(c *fiber.Ctx) error {
 		})
 	}
 
+	// Read the session before saving it, Save releases it
+	rememberedProvider, _ := sess.Get(sessionProviderKey).(string)
 	sessionId := sess.ID()
 	if err := sess.Save(); err != nil {
 		log.Error("Could not save session", "sid", sessionId)
@@ -59,18 +62,21 @@ func (h *Handler) HandleOAuthAuthorize(c *fiber.Ctx) error {
 		return HandleAuthError(c, authErr)
 	}
 
+	params.Provider = h.router.Route(&provider.RouteRequest{
+		ClientID:   params.ClientID,
+		LoginHint:  params.LoginHint,
+		DomainHint: params.DomainHint,
+		Remembered: rememberedProvider,
+	})
+
 	if authErr := h.auth.StoreAuthorization(ctx, sessionId, params); authErr != nil {
 		log.Warn("Failed to store authorization", "error", authErr)
 		return HandleAuthError(c, authErr)
 	}
 
-	authCode, err := h.oauthGoogle.GetAuthCodeURL(ctx, sessionId)
-	if err != nil {
-		log.Warn("Failed to get auth code URL", "error", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get auth code URL",
-		})
+	if params.Provider == "" {
+		return h.renderProviderSelection(c)
 	}
 
-	return c.Redirect(authCode, fiber.StatusFound)
+	return h.redirectToProvider(ctx, c, sessionId, params)
 }
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+)
+
+func testProxies() []*config.ProxyConfig {
+	return []*config.ProxyConfig{
+		{
+			Pattern:      "/calc/mcp",
+			ResourcePath: "/calc/mcp",
+			Resource:     testBaseURL + "/calc/mcp",
+			Scopes:       []string{"calc:read"},
+			GoogleScopes: []string{"https://www.googleapis.com/auth/drive.readonly"},
+		},
+		{
+			Pattern:      "/files/mcp",
+			ResourcePath: "/files/mcp",
+			Resource:     testBaseURL + "/files/mcp",
+			Scopes:       []string{"files:read"},
+		},
+	}
+}
+
+func TestHandleOAuthAuthorize_Scope(t *testing.T) {
+	testCases := []struct {
+		name          string
+		resource      string
+		scope         string
+		expectedError string
+	}{
+		{name: "no scope"},
+		{name: "scope of the resource", resource: testBaseURL + "/calc/mcp", scope: "calc:read"},
+		{name: "google scope of the resource", resource: testBaseURL + "/calc/mcp", scope: "https://www.googleapis.com/auth/drive.readonly"},
+		{name: "scope of any resource", scope: "files:read"},
+		{name: "scope of another resource", resource: testBaseURL + "/calc/mcp", scope: "files:read", expectedError: "invalid_scope"},
+		{name: "unconfigured scope", scope: "calc:read admin", expectedError: "invalid_scope"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newTestGateway(t, testConfig(config.ProviderGoogle), testProxies())
+			client := g.registerClient()
+
+			params := url.Values{}
+			if tc.resource != "" {
+				params.Set("resource", tc.resource)
+			}
+			if tc.scope != "" {
+				params.Set("scope", tc.scope)
+			}
+			location := follow(t, g.authorize(client, params))
+
+			if tc.expectedError == "" {
+				if location.Host != "google.example.com" {
+					t.Errorf("expected redirect to the provider, got %s", location)
+				}
+				return
+			}
+			if location.String() != testRedirectURI+"?"+location.RawQuery {
+				t.Errorf("expected redirect to the client, got %s", location)
+			}
+			if got := location.Query().Get("error"); got != tc.expectedError {
+				t.Errorf("expected error %s, got %q", tc.expectedError, got)
+			}
+			if got := location.Query().Get("state"); got != "client-state" {
+				t.Errorf("expected the client state, got %q", got)
+			}
+		})
+	}
+}
@@ -33,7 +33,22 @@ func (h *Handler) HandleOAuthCallback(c *fiber.Ctx) error {
 	state := c.Query("state")
 	code := c.Query("code")
 
-	googleAuthResult, err := h.oauthGoogle.Callback(ctx, sessionId, state, code)
+	authParams, authErr := h.auth.GetAuthorization(ctx, sessionId)
+	if authErr != nil {
+		log.Error("Failed to get authorization", "error", authErr)
+		return HandleAuthError(c, authErr)
+	}
+
+	upstream, err := h.upstreams.Get(authParams.Provider)
+	if err != nil {
+		log.Error("Failed to get upstream provider", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":       "internal_server_error",
+			"description": "Failed to get upstream provider",
+		})
+	}
+
+	upstreamAuthResult, err := upstream.Callback(ctx, sessionId, state, code)
 	if err != nil {
 		log.Error("Failed to get user ID", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -42,26 +57,56 @@ func (h *Handler) HandleOAuthCallback(c *fiber.Ctx) error {
 		})
 	}
 
-	authParams, authErr := h.auth.GetAuthorization(ctx, sessionId)
-	if authErr != nil {
-		log.Error("Failed to get authorization", "error", authErr)
-		return HandleAuthError(c, authErr)
+	if err := h.policy.Check(upstreamAuthResult.Identity); err != nil {
+		log.Warn("Sign-in denied", "provider", authParams.Provider, "error", err)
+
+		// Do not keep an upstream grant of a user who may not sign in
+		upstreamToken := upstreamAuthResult.RefreshToken
+		if upstreamToken == "" {
+			upstreamToken = upstreamAuthResult.AccessToken
+		}
+		if err := upstream.RevokeToken(ctx, upstreamToken); err != nil {
+			log.Warn("Failed to revoke upstream token", "error", err)
+		}
+
+		return HandleAuthError(c, &auth.AuthError{
+			AuthRedirectError: auth.AuthRedirectError{
+				RedirectURI:      authParams.RedirectURI,
+				ErrorCode:        auth.AccessDenied,
+				ErrorDescription: "The user is not allowed to sign in",
+				State:            authParams.State,
+			},
+		})
 	}
 
 	authCode, authErr := h.auth.GenerateAuthorizationCode(ctx, &auth.AuthorizationCodeParams{
-		UID:              googleAuthResult.Claims.Sub,
-		ClientID:         authParams.ClientID,
-		RedirectURI:      authParams.RedirectURI,
-		CodeChallenge:    authParams.CodeChallenge,
-		GoogleAccessToken:  googleAuthResult.AccessToken,
-		GoogleRefreshToken: googleAuthResult.RefreshToken,
-		GoogleExpiry:       googleAuthResult.Expiry,
+		UID:                  upstreamAuthResult.Identity.Subject,
+		Email:                upstreamAuthResult.Identity.Email,
+		Name:                 upstreamAuthResult.Identity.Name,
+		ClientID:             authParams.ClientID,
+		RedirectURI:          authParams.RedirectURI,
+		CodeChallenge:        authParams.CodeChallenge,
+		Resource:             authParams.Resource,
+		Scope:                authParams.Scope,
+		Provider:             authParams.Provider,
+		UpstreamAccessToken:  upstreamAuthResult.AccessToken,
+		UpstreamRefreshToken: upstreamAuthResult.RefreshToken,
+		UpstreamExpiry:       upstreamAuthResult.Expiry,
+		UpstreamScopes:       upstreamAuthResult.Scopes,
 	})
 	if authErr != nil {
 		log.Error("Failed to generate authorization code", "error", authErr)
 		return HandleAuthError(c, authErr)
 	}
 
+	// Skip the provider selection next time
+	if authParams.Provider != "" {
+		sess.Set(sessionProviderKey, authParams.Provider)
+		if err := sess.Save(); err != nil {
+			log.Error("Could not save session", "sid", sessionId)
+		}
+	}
+
 	urlParams := "?code=" + authCode
 	if authParams.State != "" {
 		urlParams += "&state=" + authParams.State
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+	"github.com/schnurbus/go-mcp-gateway/internal/vault"
+)
+
+func TestHandleOAuthCallback_SignInPolicy(t *testing.T) {
+	testCases := []struct {
+		name          string
+		deniedEmails  string
+		emailVerified bool
+		expectedError string
+	}{
+		{name: "allowed", emailVerified: true},
+		{name: "denied email", deniedEmails: "user@example.com", emailVerified: true, expectedError: "access_denied"},
+		{name: "unverified email", emailVerified: false, expectedError: "access_denied"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig(config.ProviderGoogle)
+			cfg.SignInDeniedEmails = tc.deniedEmails
+			g := newTestGateway(t, cfg, testProxies())
+			upstream := g.providers[config.ProviderGoogle]
+			upstream.identity.EmailVerified = tc.emailVerified
+			client := g.registerClient()
+
+			location := follow(t, g.authorize(client, nil))
+			location = follow(t, g.get(callbackPath(g.auth, location)))
+
+			if location.Scheme+"://"+location.Host+location.Path != testRedirectURI {
+				t.Fatalf("expected redirect to the client, got %s", location)
+			}
+			if got := location.Query().Get("state"); got != "client-state" {
+				t.Errorf("expected the client state, got %q", got)
+			}
+			_, err := g.vault.Get(context.Background(), vault.Key(config.ProviderGoogle, "12345", client.ClientID))
+
+			if tc.expectedError == "" {
+				if location.Query().Get("code") == "" {
+					t.Errorf("expected code, got %s", location)
+				}
+				if revoked := upstream.Revoked(); len(revoked) != 0 {
+					t.Errorf("expected no upstream revocation, got %v", revoked)
+				}
+				if err != nil {
+					t.Errorf("expected the upstream grant to be kept, got %v", err)
+				}
+				return
+			}
+
+			if got := location.Query().Get("error"); got != tc.expectedError {
+				t.Errorf("expected error %s, got %q", tc.expectedError, got)
+			}
+			if location.Query().Get("error_description") == "" {
+				t.Error("expected error description")
+			}
+			if location.Query().Has("code") {
+				t.Errorf("expected no code, got %s", location)
+			}
+			if revoked := upstream.Revoked(); !slices.Equal(revoked, []string{"google-refresh-token"}) {
+				t.Errorf("expected the upstream refresh token to be revoked, got %v", revoked)
+			}
+			if !errors.Is(err, vault.ErrNotFound) {
+				t.Errorf("expected no upstream grant, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/schnurbus/go-mcp-gateway/internal/auth"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+)
+
+func (h *Handler) HandleOAuthClientConfigurationRead(c *fiber.Ctx) error {
+	requestId, ok := c.Locals("requestid").(string)
+	if !ok {
+		requestId = uuid.New().String()
+	}
+	log := logger.FromContext(c.Context()).With(
+		slog.String("handler", "HandleOAuthClientConfigurationRead"),
+		slog.String("request_id", requestId),
+	)
+	ctx := logger.WithContext(c.Context(), log)
+
+	client, authErr := h.auth.AuthenticateRegistration(ctx, c.Params("client_id"), c.Get(fiber.HeaderAuthorization))
+	if authErr != nil {
+		log.Warn("Failed to authenticate registration", "error", authErr)
+		return handleRegistrationAuthError(c, authErr)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(client.RegistrationResponse())
+}
+
+func (h *Handler) HandleOAuthClientConfigurationUpdate(c *fiber.Ctx) error {
+	requestId, ok := c.Locals("requestid").(string)
+	if !ok {
+		requestId = uuid.New().String()
+	}
+	log := logger.FromContext(c.Context()).With(
+		slog.String("handler", "HandleOAuthClientConfigurationUpdate"),
+		slog.String("request_id", requestId),
+	)
+	ctx := logger.WithContext(c.Context(), log)
+
+	client, authErr := h.auth.AuthenticateRegistration(ctx, c.Params("client_id"), c.Get(fiber.HeaderAuthorization))
+	if authErr != nil {
+		log.Warn("Failed to authenticate registration", "error", authErr)
+		return handleRegistrationAuthError(c, authErr)
+	}
+
+	contentType := c.Get(fiber.HeaderContentType)
+	if contentType != fiber.MIMEApplicationJSON {
+		log.Warn("Invalid content type", "content-type", contentType)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":       "bad_request",
+			"description": "Content-Type muste be application/json",
+		})
+	}
+
+	req := new(auth.ClientUpdateRequest)
+	if err := c.BodyParser(req); err != nil {
+		log.Warn("Failed to decode body", "error", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":       "bad_request",
+			"description": "Failed to decode body",
+		})
+	}
+
+	updated, authErr := h.auth.UpdateClient(ctx, client, req)
+	if authErr != nil {
+		log.Warn("Failed to update client", "error", authErr)
+		return HandleAuthError(c, authErr)
+	}
+
+	log.Info("Updated client", "client_id", updated.ClientID)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(updated.RegistrationResponse())
+}
+
+func (h *Handler) HandleOAuthClientConfigurationDelete(c *fiber.Ctx) error {
+	requestId, ok := c.Locals("requestid").(string)
+	if !ok {
+		requestId = uuid.New().String()
+	}
+	log := logger.FromContext(c.Context()).With(
+		slog.String("handler", "HandleOAuthClientConfigurationDelete"),
+		slog.String("request_id", requestId),
+	)
+	ctx := logger.WithContext(c.Context(), log)
+
+	client, authErr := h.auth.AuthenticateRegistration(ctx, c.Params("client_id"), c.Get(fiber.HeaderAuthorization))
+	if authErr != nil {
+		log.Warn("Failed to authenticate registration", "error", authErr)
+		return handleRegistrationAuthError(c, authErr)
+	}
+
+	revocations, authErr := h.auth.FindClientRevocations(ctx, client.ClientID)
+	if authErr != nil {
+		log.Error("Failed to find client grants", "error", authErr)
+		return HandleAuthError(c, authErr)
+	}
+
+	// Revoke upstream first, so the client can retry if a provider is
+	// unavailable, like the revocation endpoint does
+	for _, revocation := range revocations {
+		if revocation.UpstreamToken == "" {
+			continue
+		}
+		if upstream, err := h.upstreams.Get(revocation.Provider); err != nil {
+			log.Warn("Skipping upstream revocation", "error", err)
+		} else if err := upstream.RevokeToken(ctx, revocation.UpstreamToken); err != nil {
+			log.Error("Failed to revoke upstream token", "error", err)
+			return HandleAuthError(c, &auth.AuthError{
+				AuthJsonError: auth.AuthJsonError{
+					Code:        auth.TemporarilyUnavailable,
+					Description: "Failed to revoke upstream token",
+				},
+			})
+		}
+	}
+
+	if authErr := h.auth.DeleteClient(ctx, client.ClientID); authErr != nil {
+		log.Error("Failed to delete client", "error", authErr)
+		return HandleAuthError(c, authErr)
+	}
+
+	log.Info("Deleted client", "client_id", client.ClientID)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func handleRegistrationAuthError(c *fiber.Ctx, err *auth.AuthError) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="`+err.AuthJsonError.Code+`"`)
+	return HandleAuthError(c, err)
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/schnurbus/go-mcp-gateway/internal/auth"
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+	"github.com/schnurbus/go-mcp-gateway/internal/vault"
+)
+
+func (g *testGateway) clientConfiguration(method string, client *auth.Client, token string, body any) *http.Response {
+	g.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		bodyJSON, err := json.Marshal(body)
+		if err != nil {
+			g.t.Fatal(err)
+		}
+		reader = strings.NewReader(string(bodyJSON))
+	}
+	req := httptest.NewRequest(method, "/oauth/register/"+client.ClientID, reader)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	if body != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	return g.do(req)
+}
+
+func TestHandleOAuthClientConfiguration(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		wrongToken     bool
+		update         func(client *auth.Client) *auth.ClientUpdateRequest
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "read", method: http.MethodGet, expectedStatus: http.StatusOK},
+		{name: "read with wrong token", method: http.MethodGet, wrongToken: true, expectedStatus: http.StatusUnauthorized, expectedError: "invalid_token"},
+		{
+			name:   "update",
+			method: http.MethodPut,
+			update: func(client *auth.Client) *auth.ClientUpdateRequest {
+				return &auth.ClientUpdateRequest{
+					ClientMetadata: auth.ClientMetadata{ClientName: "Renamed", RedirectURIs: []string{testRedirectURI}},
+					ClientID:       client.ClientID,
+				}
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "update of client_id",
+			method: http.MethodPut,
+			update: func(client *auth.Client) *auth.ClientUpdateRequest {
+				return &auth.ClientUpdateRequest{
+					ClientMetadata: auth.ClientMetadata{ClientName: "Renamed", RedirectURIs: []string{testRedirectURI}},
+					ClientID:       "other-client",
+				}
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+		{
+			name:   "update with wrong token",
+			method: http.MethodPut,
+			update: func(client *auth.Client) *auth.ClientUpdateRequest {
+				return &auth.ClientUpdateRequest{
+					ClientMetadata: auth.ClientMetadata{ClientName: "Renamed", RedirectURIs: []string{testRedirectURI}},
+					ClientID:       client.ClientID,
+				}
+			},
+			wrongToken:     true,
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "invalid_token",
+		},
+		{name: "delete", method: http.MethodDelete, expectedStatus: http.StatusNoContent},
+		{name: "delete with wrong token", method: http.MethodDelete, wrongToken: true, expectedStatus: http.StatusUnauthorized, expectedError: "invalid_token"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newTestGateway(t, testConfig(config.ProviderGoogle), testProxies())
+			client := g.registerClient()
+
+			token := client.RegistrationAccessToken
+			if tc.wrongToken {
+				token = g.registerClient().RegistrationAccessToken
+			}
+			var body any
+			if tc.update != nil {
+				body = tc.update(client)
+			}
+			resp := g.clientConfiguration(tc.method, client, token, body)
+
+			if resp.StatusCode != tc.expectedStatus {
+				respBody, _ := io.ReadAll(resp.Body)
+				t.Fatalf("expected status %d, got %d: %s", tc.expectedStatus, resp.StatusCode, respBody)
+			}
+			if tc.expectedError != "" {
+				var errResp struct {
+					Error string `json:"error"`
+				}
+				if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+					t.Fatal(err)
+				}
+				if errResp.Error != tc.expectedError {
+					t.Errorf("expected error %s, got %q", tc.expectedError, errResp.Error)
+				}
+				if tc.wrongToken && !strings.Contains(resp.Header.Get(fiber.HeaderWWWAuthenticate), tc.expectedError) {
+					t.Errorf("expected WWW-Authenticate with %s, got %q", tc.expectedError, resp.Header.Get(fiber.HeaderWWWAuthenticate))
+				}
+			}
+
+			stored, authErr := g.auth.GetClient(context.Background(), client.ClientID)
+			switch {
+			case tc.method == http.MethodDelete && tc.expectedError == "":
+				if authErr == nil {
+					t.Error("expected the client to be deleted")
+				}
+			case authErr != nil:
+				t.Fatalf("expected the client to be kept, got %v", authErr)
+			case tc.method == http.MethodPut && tc.expectedError == "" && stored.ClientName != "Renamed":
+				t.Errorf("expected the client to be updated, got name %q", stored.ClientName)
+			case tc.expectedError != "" && stored.ClientName != "":
+				t.Errorf("expected the client to be unchanged, got name %q", stored.ClientName)
+			}
+		})
+	}
+}
+
+func TestHandleOAuthClientConfigurationDelete_RevokesGrants(t *testing.T) {
+	g := newTestGateway(t, testConfig(config.ProviderGoogle), testProxies())
+	ctx := context.Background()
+	client := g.registerClient()
+	first := g.signIn(client)
+	second := g.signIn(client)
+	other := g.registerClient()
+	kept := g.signIn(other)
+
+	resp := g.clientConfiguration(http.MethodDelete, client, client.RegistrationAccessToken, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+
+	for _, tokens := range []*auth.TokenResponse{first, second} {
+		if _, authErr := g.auth.GetAccessToken(ctx, tokens.AccessToken); authErr == nil {
+			t.Error("expected the access token to be revoked")
+		}
+	}
+	if _, authErr := g.auth.GetAccessToken(ctx, kept.AccessToken); authErr != nil {
+		t.Errorf("expected the access token of another client to be kept, got %v", authErr)
+	}
+
+	if _, err := g.vault.Get(ctx, vault.Key(config.ProviderGoogle, "12345", client.ClientID)); !errors.Is(err, vault.ErrNotFound) {
+		t.Errorf("expected the upstream grant to be deleted, got %v", err)
+	}
+	if _, err := g.vault.Get(ctx, vault.Key(config.ProviderGoogle, "12345", other.ClientID)); err != nil {
+		t.Errorf("expected the upstream grant of another client to be kept, got %v", err)
+	}
+
+	// Both sign-ins share one upstream grant, which is revoked once
+	if revoked := g.providers[config.ProviderGoogle].Revoked(); !slices.Equal(revoked, []string{"google-refresh-token"}) {
+		t.Errorf("expected the upstream refresh token to be revoked once, got %v", revoked)
+	}
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/schnurbus/go-mcp-gateway/internal/auth"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/googletokenvalidator"
+)
+
+func (h *Handler) HandleOAuthIntrospect(c *fiber.Ctx) error {
+	requestId, ok := c.Locals("requestid").(string)
+	if !ok {
+		requestId = uuid.New().String()
+	}
+	log := logger.FromContext(c.Context()).With(
+		slog.String("handler", "HandleOAuthIntrospect"),
+		slog.String("request_id", requestId),
+	)
+	ctx := logger.WithContext(c.Context(), log)
+
+	contentType := c.Get(fiber.HeaderContentType)
+	if !strings.HasPrefix(contentType, fiber.MIMEApplicationForm) {
+		log.Warn("Invalid content type", "content-type", contentType)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":       "bad_request",
+			"description": "Content-Type muste be application/x-www-form-urlencoded",
+		})
+	}
+
+	params := new(auth.IntrospectionRequestParams)
+	if err := c.BodyParser(params); err != nil {
+		log.Warn("Could not parse body")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":       "bad_request",
+			"description": "Invalid body",
+		})
+	}
+
+	client, authErr := h.auth.AuthenticateClient(ctx, c.Get(fiber.HeaderAuthorization), params.ClientID, params.ClientSecret)
+	if authErr != nil {
+		log.Warn("Failed to authenticate client", "error", authErr)
+		return HandleAuthError(c, authErr)
+	}
+	// Only confidential clients (resource servers) may introspect tokens
+	if client.TokenEndpointAuthMethod == "none" {
+		log.Warn("Public client tried to introspect a token", "client_id", client.ClientID)
+		return HandleAuthError(c, &auth.AuthError{
+			AuthJsonError: auth.AuthJsonError{
+				Code:        auth.InvalidClient,
+				Description: "client authentication is required",
+			},
+		})
+	}
+	if authErr := h.auth.AuthorizeIntrospection(client); authErr != nil {
+		log.Warn("Client is not allowed to introspect tokens", "client_id", client.ClientID)
+		return HandleAuthError(c, authErr)
+	}
+
+	if params.Token == "" {
+		return HandleAuthError(c, &auth.AuthError{
+			AuthJsonError: auth.AuthJsonError{
+				Code:        auth.InvalidRequest,
+				Description: "token is required",
+			},
+		})
+	}
+
+	resp := h.auth.Introspect(ctx, params.Token, params.TokenTypeHint)
+	if !resp.Active && h.googleClientID != "" {
+		resp = h.introspectGoogleToken(params.Token)
+	}
+
+	log.Info("Introspected token", "client_id", client.ClientID, "active", resp.Active)
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+// introspectGoogleToken reports plain Google access tokens issued to the
+// gateway's Google client as active.
+func (h *Handler) introspectGoogleToken(token string) *auth.IntrospectionResponse {
+	tokenInfo, err := googletokenvalidator.FetchTokenInfo(token)
+	if err != nil || tokenInfo.Aud != h.googleClientID {
+		return &auth.IntrospectionResponse{Active: false}
+	}
+
+	exp := time.Time(tokenInfo.Exp)
+	if time.Now().After(exp) {
+		return &auth.IntrospectionResponse{Active: false}
+	}
+
+	return &auth.IntrospectionResponse{
+		Active:    true,
+		Scope:     tokenInfo.Scope,
+		ClientID:  tokenInfo.Aud,
+		Username:  tokenInfo.Email,
+		TokenType: "Bearer",
+		Exp:       exp.Unix(),
+		Sub:       tokenInfo.Sub,
+		Aud:       tokenInfo.Aud,
+		Iss:       "https://accounts.google.com",
+	}
+}
@@ -1,12 +1,58 @@
 package handler
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"strings"
 
+	"github.com/gofiber/fiber/v2"
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+)
+
+// HandleOAuthProtectedResourceMetadata serves the RFC 9728 protected resource
+// metadata. The document at the bare well-known path describes the gateway
+// itself; each proxy route has its own document at the well-known path
+// suffixed with the path of its resource.
 func (h *Handler) HandleOAuthProtectedResourceMetadata(c *fiber.Ctx) error {
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"resource":                              h.baseURL,
-		"issuer":                                h.baseURL,
-		"authorization_servers":                 []string{h.baseURL},
-		"token_endpoint_auth_methods_supported": h.auth.GetSupportTokenEndpointAuthMethods(),
-	})
+	resourcePath := strings.TrimPrefix(c.Route().Path, config.ProtectedResourceMetadataPath)
+	if resourcePath == "" {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"resource":                              h.baseURL,
+			"issuer":                                h.baseURL,
+			"authorization_servers":                 []string{h.baseURL},
+			"token_endpoint_auth_methods_supported": h.auth.GetSupportTokenEndpointAuthMethods(),
+		})
+	}
+
+	p, ok := h.proxies[resourcePath]
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":       "not_found",
+			"description": "unknown resource",
+		})
+	}
+
+	// Routes validating tokens of another issuer point clients at it
+	authorizationServer := h.baseURL
+	if p.Validator.Type != config.ValidatorGoogle && p.Validator.Issuer != "" {
+		authorizationServer = p.Validator.Issuer
+	}
+
+	metadata := fiber.Map{
+		"resource":                 p.Resource,
+		"authorization_servers":    []string{authorizationServer},
+		"bearer_methods_supported": []string{"header"},
+	}
+	if len(p.Scopes) > 0 {
+		metadata["scopes_supported"] = p.Scopes
+	}
+	if p.ResourceDocumentation != "" {
+		metadata["resource_documentation"] = p.ResourceDocumentation
+	}
+	if p.ResourcePolicyURI != "" {
+		metadata["resource_policy_uri"] = p.ResourcePolicyURI
+	}
+	if p.ResourceTosURI != "" {
+		metadata["resource_tos_uri"] = p.ResourceTosURI
+	}
+
+	return c.Status(fiber.StatusOK).JSON(metadata)
 }
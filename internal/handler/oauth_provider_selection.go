@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"html/template"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/schnurbus/go-mcp-gateway/internal/auth"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider"
+)
+
+// sessionProviderKey stores the provider the user last signed in with.
+const sessionProviderKey = "provider"
+
+var providerSelectionTemplate = template.Must(template.New("provider_selection").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in</title>
+<style>
+body { font-family: system-ui, sans-serif; display: flex; justify-content: center; margin-top: 10vh; }
+main { width: 20rem; }
+a { display: block; margin: 0.5rem 0; padding: 0.75rem; border: 1px solid #ccc; border-radius: 0.25rem; color: inherit; text-align: center; text-decoration: none; }
+a:hover { background: #f4f4f4; }
+</style>
+</head>
+<body>
+<main>
+<h1>Sign in with</h1>
+{{range .Providers}}<a href="{{$.Path}}?provider={{.Name}}">{{.DisplayName}}</a>
+{{end}}</main>
+</body>
+</html>
+`))
+
+type providerOption struct {
+	Name        string
+	DisplayName string
+}
+
+// renderProviderSelection lets the user choose the upstream provider of the
+// authorization stored for the session.
+func (h *Handler) renderProviderSelection(c *fiber.Ctx) error {
+	options := make([]providerOption, 0, len(h.router.Providers()))
+	for _, name := range h.router.Providers() {
+		options = append(options, providerOption{Name: name, DisplayName: h.providerNames[name]})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Type("html", "utf-8")
+	return providerSelectionTemplate.Execute(c.Response().BodyWriter(), struct {
+		Path      string
+		Providers []providerOption
+	}{
+		Path:      h.auth.GetProviderSelectionPath(),
+		Providers: options,
+	})
+}
+
+// HandleOAuthProviderSelection continues the authorization of the session
+// with the provider the user chose.
+func (h *Handler) HandleOAuthProviderSelection(c *fiber.Ctx) error {
+	requestId, ok := c.Locals("requestid").(string)
+	if !ok {
+		requestId = uuid.New().String()
+	}
+	log := logger.FromContext(c.Context()).With(
+		slog.String("handler", "HandleOAuthProviderSelection"),
+		slog.String("request_id", requestId),
+	)
+	ctx := logger.WithContext(c.Context(), log)
+
+	sess, err := h.sessionStore.Get(c)
+	if err != nil {
+		log.Error("Could not get session", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":       "internal_server_error",
+			"description": "Could not get session",
+		})
+	}
+	sessionId := sess.ID()
+
+	name := c.Query("provider")
+	if !h.router.IsProvider(name) {
+		log.Warn("Unknown provider", "provider", name)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":       "bad_request",
+			"description": "Unknown provider",
+		})
+	}
+
+	authParams, authErr := h.auth.GetAuthorization(ctx, sessionId)
+	if authErr != nil {
+		log.Error("Failed to get authorization", "error", authErr)
+		return HandleAuthError(c, authErr)
+	}
+
+	authParams.Provider = name
+	if authErr := h.auth.StoreAuthorization(ctx, sessionId, authParams); authErr != nil {
+		log.Warn("Failed to store authorization", "error", authErr)
+		return HandleAuthError(c, authErr)
+	}
+
+	return h.redirectToProvider(ctx, c, sessionId, authParams)
+}
+
+// redirectToProvider starts the authorization of the session at the upstream
+// provider of params.
+func (h *Handler) redirectToProvider(ctx context.Context, c *fiber.Ctx, sessionId string, params *auth.AuthorizationParams) error {
+	log := logger.FromContext(ctx)
+
+	upstream, err := h.upstreams.Get(params.Provider)
+	if err != nil {
+		log.Error("Failed to get upstream provider", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get upstream provider",
+		})
+	}
+
+	var authCode string
+	if incremental, ok := upstream.(provider.IncrementalProvider); ok {
+		scopes := h.upstreamScopes(params)
+		log.Debug("Requesting upstream scopes", "scopes", scopes)
+		authCode, err = incremental.GetIncrementalAuthCodeURL(ctx, sessionId, scopes)
+	} else {
+		authCode, err = upstream.GetAuthCodeURL(ctx, sessionId)
+	}
+	if err != nil {
+		log.Warn("Failed to get auth code URL", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get auth code URL",
+		})
+	}
+
+	return c.Redirect(authCode, fiber.StatusFound)
+}
+
+// upstreamScopes returns the Google scopes to request on top of the configured
+// ones: those of the route the authorization is for, and those the client
+// asks for after an insufficient_scope challenge as far as a route needs them.
+func (h *Handler) upstreamScopes(params *auth.AuthorizationParams) []string {
+	requested := strings.Fields(params.Scope)
+
+	var scopes []string
+	for _, p := range h.proxies {
+		for _, scope := range p.GoogleScopes {
+			if (p.Resource == params.Resource || slices.Contains(requested, scope)) && !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	slices.Sort(scopes)
+	return scopes
+}
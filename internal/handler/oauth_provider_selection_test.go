@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+)
+
+func TestHandleOAuthAuthorize_ProviderChoice(t *testing.T) {
+	const defaultClientID = "github-client"
+
+	testCases := []struct {
+		name             string
+		params           url.Values
+		remembered       string // provider the user signed in with before
+		clientID         string
+		expectedProvider string // empty for the selection page
+	}{
+		{name: "selection page"},
+		{name: "login hint domain", params: url.Values{"login_hint": {"user@Example.com"}}, expectedProvider: config.ProviderGitHub},
+		{name: "login hint of another domain", params: url.Values{"login_hint": {"user@other.com"}}},
+		{name: "domain hint", params: url.Values{"domain_hint": {"example.com"}}, expectedProvider: config.ProviderGitHub},
+		{
+			name:             "login hint domain before domain hint",
+			params:           url.Values{"login_hint": {"user@corp.com"}, "domain_hint": {"example.com"}},
+			expectedProvider: config.ProviderGoogle,
+		},
+		{name: "remembered provider", remembered: config.ProviderGoogle, expectedProvider: config.ProviderGoogle},
+		{
+			name:             "domain hint before remembered provider",
+			params:           url.Values{"domain_hint": {"example.com"}},
+			remembered:       config.ProviderGoogle,
+			expectedProvider: config.ProviderGitHub,
+		},
+		{name: "client default", clientID: defaultClientID, expectedProvider: config.ProviderGitHub},
+		{
+			name:             "remembered provider before client default",
+			remembered:       config.ProviderGoogle,
+			clientID:         defaultClientID,
+			expectedProvider: config.ProviderGoogle,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig(config.ProviderGoogle, config.ProviderGitHub)
+			cfg.ProviderDomains = map[string]string{"example.com": config.ProviderGitHub, "corp.com": config.ProviderGoogle}
+			cfg.ProviderClients = map[string]string{defaultClientID: config.ProviderGitHub}
+			g := newTestGateway(t, cfg, testProxies())
+
+			client := g.registerClient()
+			if tc.clientID != "" {
+				client.ClientID = tc.clientID
+				if err := g.auth.SaveClient(context.Background(), client.ClientID, client); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if tc.remembered != "" {
+				resp := g.authorize(g.registerClient(), nil)
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("expected the selection page, got %d", resp.StatusCode)
+				}
+				location := follow(t, g.get(g.auth.GetProviderSelectionPath()+"?provider="+tc.remembered))
+				follow(t, g.get(callbackPath(g.auth, location)))
+			}
+
+			resp := g.authorize(client, tc.params)
+			if tc.expectedProvider == "" {
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("expected the selection page, got %d", resp.StatusCode)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				for _, name := range cfg.Providers {
+					if !strings.Contains(string(body), "?provider="+name) {
+						t.Errorf("expected the selection page to offer %s", name)
+					}
+				}
+				return
+			}
+			if location := follow(t, resp); location.Host != tc.expectedProvider+".example.com" {
+				t.Errorf("expected redirect to %s, got %s", tc.expectedProvider, location)
+			}
+		})
+	}
+}
+
+func TestHandleOAuthProviderSelection(t *testing.T) {
+	testCases := []struct {
+		name             string
+		provider         string
+		expectedStatus   int
+		expectedProvider string
+	}{
+		{name: "configured provider", provider: config.ProviderGitHub, expectedStatus: http.StatusFound, expectedProvider: config.ProviderGitHub},
+		{name: "unknown provider", provider: config.ProviderOIDC, expectedStatus: http.StatusBadRequest},
+		{name: "no provider", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := newTestGateway(t, testConfig(config.ProviderGoogle, config.ProviderGitHub), testProxies())
+			if resp := g.authorize(g.registerClient(), nil); resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected the selection page, got %d", resp.StatusCode)
+			}
+
+			resp := g.get(g.auth.GetProviderSelectionPath() + "?provider=" + tc.provider)
+			if resp.StatusCode != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+			if tc.expectedProvider == "" {
+				return
+			}
+			if location := follow(t, resp); location.Host != tc.expectedProvider+".example.com" {
+				t.Errorf("expected redirect to %s, got %s", tc.expectedProvider, location)
+			}
+		})
+	}
+}
@@ -57,5 +57,5 @@ func (h *Handler) HandleOAuthRegister(c *fiber.Ctx) error {
 		})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(client)
+	return c.Status(fiber.StatusOK).JSON(client.RegistrationResponse())
 }
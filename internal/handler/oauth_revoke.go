@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/schnurbus/go-mcp-gateway/internal/auth"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+)
+
+func (h *Handler) HandleOAuthRevoke(c *fiber.Ctx) error {
+	requestId, ok := c.Locals("requestid").(string)
+	if !ok {
+		requestId = uuid.New().String()
+	}
+	log := logger.FromContext(c.Context()).With(
+		slog.String("handler", "HandleOAuthRevoke"),
+		slog.String("request_id", requestId),
+	)
+	ctx := logger.WithContext(c.Context(), log)
+
+	contentType := c.Get(fiber.HeaderContentType)
+	if !strings.HasPrefix(contentType, fiber.MIMEApplicationForm) {
+		log.Warn("Invalid content type", "content-type", contentType)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":       "bad_request",
+			"description": "Content-Type muste be application/x-www-form-urlencoded",
+		})
+	}
+
+	params := new(auth.RevocationRequestParams)
+	if err := c.BodyParser(params); err != nil {
+		log.Warn("Could not parse body")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":       "bad_request",
+			"description": "Invalid body",
+		})
+	}
+
+	client, authErr := h.auth.AuthenticateClient(ctx, c.Get(fiber.HeaderAuthorization), params.ClientID, params.ClientSecret)
+	if authErr != nil {
+		log.Warn("Failed to authenticate client", "error", authErr)
+		return HandleAuthError(c, authErr)
+	}
+
+	if params.Token == "" {
+		return HandleAuthError(c, &auth.AuthError{
+			AuthJsonError: auth.AuthJsonError{
+				Code:        auth.InvalidRequest,
+				Description: "token is required",
+			},
+		})
+	}
+
+	revocation := h.auth.FindRevocation(ctx, params.Token, params.TokenTypeHint, client.ClientID)
+	if revocation == nil {
+		// Invalid tokens do not cause an error response (RFC 7009 section 2.2)
+		log.Info("Ignoring revocation of unknown token", "client_id", client.ClientID)
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	// Revoke upstream first, so the client can retry if the provider is
+	// unavailable. Tokens of providers that are no longer configured are only
+	// revoked at the gateway.
+	if revocation.UpstreamToken == "" {
+		log.Warn("No upstream token to revoke", "client_id", client.ClientID)
+	} else if upstream, err := h.upstreams.Get(revocation.Provider); err != nil {
+		log.Warn("Skipping upstream revocation", "error", err)
+	} else if err := upstream.RevokeToken(ctx, revocation.UpstreamToken); err != nil {
+		log.Error("Failed to revoke upstream token", "error", err)
+		return HandleAuthError(c, &auth.AuthError{
+			AuthJsonError: auth.AuthJsonError{
+				Code:        auth.TemporarilyUnavailable,
+				Description: "Failed to revoke upstream token",
+			},
+		})
+	}
+
+	if authErr := h.auth.Revoke(ctx, revocation); authErr != nil {
+		log.Error("Failed to revoke token", "error", authErr)
+		return HandleAuthError(c, authErr)
+	}
+
+	log.Info("Revoked token", "client_id", client.ClientID)
+	return c.SendStatus(fiber.StatusOK)
+}
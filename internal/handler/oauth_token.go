@@ -42,18 +42,13 @@ func (h *Handler) HandleOauthToken(c *fiber.Ctx) error {
 
 	switch params.GrantType {
 	case "authorization_code":
-		googleTokens, authErr := h.generateAuthorizationCode(ctx, params)
+		tokens, authErr := h.generateAuthorizationCode(ctx, params)
 		if authErr != nil {
 			log.Error("cannot generate access token", "error", authErr)
 			return HandleAuthError(c, authErr)
 		}
 
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"token_type":    "Bearer",
-			"expires_in":    googleTokens.GoogleExpiry,
-			"access_token":  googleTokens.GoogleAccessToken,
-			"refresh_token": googleTokens.GoogleRefreshToken,
-		})
+		return c.Status(fiber.StatusOK).JSON(tokens)
 	case "refresh_token":
 		var refreshTokenParams auth.RefreshTokenRequestParams
 
@@ -77,18 +72,13 @@ func (h *Handler) HandleOauthToken(c *fiber.Ctx) error {
 			refreshTokenParams.ClientSecret = clientSecret
 		}
 
-		newAccessToken, expiry, authErr := h.generateRefreshToken(ctx, &refreshTokenParams)
+		tokens, authErr := h.generateRefreshToken(ctx, &refreshTokenParams)
 		if authErr != nil {
 			log.Error("cannot generate refresh token", "error", authErr)
 			return HandleAuthError(c, authErr)
 		}
 
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"token_type":    "Bearer",
-			"expires_in":    expiry,
-			"access_token":  newAccessToken,
-			"refresh_token": params.RefreshToken,
-		})
+		return c.Status(fiber.StatusOK).JSON(tokens)
 	}
 
 	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -97,7 +87,7 @@ func (h *Handler) HandleOauthToken(c *fiber.Ctx) error {
 	})
 }
 
-func (h *Handler) generateAuthorizationCode(ctx context.Context, params *auth.TokenRequestParams) (*auth.AuthorizationCodeResult, *auth.AuthError) {
+func (h *Handler) generateAuthorizationCode(ctx context.Context, params *auth.TokenRequestParams) (*auth.TokenResponse, *auth.AuthError) {
 	if authErr := h.auth.TokenValidateParams(ctx, params); authErr != nil {
 		return nil, authErr
 	}
@@ -130,36 +120,63 @@ func (h *Handler) generateAuthorizationCode(ctx context.Context, params *auth.To
 	if authErr != nil {
 		return nil, authErr
 	}
+	resource, authErr := h.auth.ResolveResource(ctx, result.Resource, params.Resource)
+	if authErr != nil {
+		return nil, authErr
+	}
 
-	return result, nil
+	return h.auth.IssueTokens(ctx, &auth.TokenGrant{
+		UID:      result.UID,
+		Email:    result.Email,
+		Name:     result.Name,
+		ClientID: params.ClientID,
+		Resource: resource,
+		Scope:    result.Scope,
+		Provider: result.Provider,
+	})
 }
 
-func (h *Handler) generateRefreshToken(ctx context.Context, params *auth.RefreshTokenRequestParams) (string, int64, *auth.AuthError) {
+func (h *Handler) generateRefreshToken(ctx context.Context, params *auth.RefreshTokenRequestParams) (*auth.TokenResponse, *auth.AuthError) {
 	log := logger.FromContext(ctx)
 
 	if authErr := h.auth.RefreshTokenValidateParams(ctx, params); authErr != nil {
-		return "", 0, authErr
+		return nil, authErr
 	}
 
 	client, authErr := h.auth.GetClient(ctx, params.ClientID)
 	if authErr != nil {
-		return "", 0, authErr
+		return nil, authErr
 	}
 	if authErr := h.auth.RefreshTokenValidateClient(ctx, params, client); authErr != nil {
-		return "", 0, authErr
-	}
-
-	// Use Google's refresh token to get a new access token
-	newAccessToken, expiry, err := h.oauthGoogle.RefreshToken(ctx, params.RefreshToken)
-	if err != nil {
-		log.Error("Failed to refresh Google token", "error", err)
-		return "", 0, &auth.AuthError{
-			AuthJsonError: auth.AuthJsonError{
-				Code:        auth.ServerError,
-				Description: "Failed to refresh token",
-			},
-		}
+		return nil, authErr
 	}
 
-	return newAccessToken, expiry, nil
+	refreshToken, authErr := h.auth.GetRefreshToken(ctx, params.RefreshToken, client.ClientID)
+	if authErr != nil {
+		return nil, authErr
+	}
+	resource, authErr := h.auth.ResolveResource(ctx, refreshToken.Resource, params.Resource)
+	if authErr != nil {
+		return nil, authErr
+	}
+
+	// The vault refreshes the upstream access token when it is used, it only
+	// has to be still valid
+	if authErr := h.auth.ValidateUpstreamGrant(ctx, refreshToken); authErr != nil {
+		log.Error("Failed to validate upstream grant", "error", authErr.Description)
+		return nil, authErr
+	}
+	if authErr := h.auth.ConsumeRefreshToken(ctx, params.RefreshToken, refreshToken); authErr != nil {
+		return nil, authErr
+	}
+
+	return h.auth.IssueTokens(ctx, &auth.TokenGrant{
+		UID:      refreshToken.UID,
+		Email:    refreshToken.Email,
+		Name:     refreshToken.Name,
+		ClientID: client.ClientID,
+		Resource: resource,
+		Scope:    refreshToken.Scope,
+		Provider: refreshToken.Provider,
+	})
 }
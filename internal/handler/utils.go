@@ -18,12 +18,33 @@ func HandleAuthError(c *fiber.Ctx, err *auth.AuthError) error {
 		if err.AuthJsonError.Code == auth.InvalidRequest {
 			status = fiber.StatusBadRequest
 		}
+		if err.AuthJsonError.Code == auth.InvalidGrant {
+			status = fiber.StatusBadRequest
+		}
+		if err.AuthJsonError.Code == auth.InvalidTarget {
+			status = fiber.StatusBadRequest
+		}
+		if err.AuthJsonError.Code == auth.InvalidScope {
+			status = fiber.StatusBadRequest
+		}
+		if err.AuthJsonError.Code == auth.AccessDenied {
+			status = fiber.StatusForbidden
+		}
 		if err.AuthJsonError.Code == auth.UnauthorizedClient {
 			status = fiber.StatusUnauthorized
 		}
+		if err.AuthJsonError.Code == auth.InvalidClient {
+			status = fiber.StatusUnauthorized
+		}
+		if err.AuthJsonError.Code == auth.InvalidToken {
+			status = fiber.StatusUnauthorized
+		}
 		if err.AuthJsonError.Code == auth.ServerError {
 			status = fiber.StatusInternalServerError
 		}
+		if err.AuthJsonError.Code == auth.TemporarilyUnavailable {
+			status = fiber.StatusServiceUnavailable
+		}
 
 		return c.Status(status).JSON(err.AuthJsonError)
 	} else {
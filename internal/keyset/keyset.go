@@ -0,0 +1,184 @@
+package keyset
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+var (
+	ErrNoKeys         = errors.New("no signing keys configured")
+	ErrUnsupportedKey = errors.New("unsupported key type")
+	ErrUnknownKey     = errors.New("token signed by unknown key")
+	ErrUnexpectedType = errors.New("unexpected token type")
+)
+
+var supportedAlgorithms = []jose.SignatureAlgorithm{jose.RS256, jose.ES256}
+
+// KeySet holds the private keys the gateway signs JWTs with. The first key is
+// used for signing; all keys are published in the JWKS and accepted when
+// verifying, so a new key can be rolled out before the old one is retired.
+type KeySet struct {
+	keys       []jose.JSONWebKey
+	signingKey jose.SigningKey
+}
+
+// Load reads PEM encoded RSA or P-256 EC private keys from paths.
+func Load(paths []string) (*KeySet, error) {
+	var keys []jose.JSONWebKey
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key %s: %w", path, err)
+		}
+		key, err := ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+
+	return New(keys)
+}
+
+// New creates a KeySet from already parsed private keys.
+func New(keys []jose.JSONWebKey) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	signingKey := jose.SigningKey{Algorithm: jose.SignatureAlgorithm(keys[0].Algorithm), Key: keys[0]}
+	if _, err := jose.NewSigner(signingKey, nil); err != nil {
+		return nil, fmt.Errorf("failed to create signer: %w", err)
+	}
+
+	return &KeySet{
+		keys:       keys,
+		signingKey: signingKey,
+	}, nil
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS#1, PKCS#8 or SEC 1 private key
+// into a JWK with its algorithm and RFC 7638 thumbprint key id set.
+func ParsePrivateKey(data []byte) (jose.JSONWebKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return jose.JSONWebKey{}, fmt.Errorf("no PEM block found")
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return jose.JSONWebKey{}, fmt.Errorf("%w: %s", ErrUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+
+	return newJSONWebKey(key)
+}
+
+func newJSONWebKey(key any) (jose.JSONWebKey, error) {
+	var alg jose.SignatureAlgorithm
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return jose.JSONWebKey{}, fmt.Errorf("%w: RSA keys must be at least 2048 bits", ErrUnsupportedKey)
+		}
+		alg = jose.RS256
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return jose.JSONWebKey{}, fmt.Errorf("%w: EC keys must use P-256", ErrUnsupportedKey)
+		}
+		alg = jose.ES256
+	default:
+		return jose.JSONWebKey{}, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+
+	jwk := jose.JSONWebKey{
+		Key:       key,
+		Algorithm: string(alg),
+		Use:       "sig",
+	}
+	public := jwk.Public()
+	thumbprint, err := public.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return jose.JSONWebKey{}, fmt.Errorf("failed to compute key id: %w", err)
+	}
+	jwk.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	return jwk, nil
+}
+
+// Sign serializes claims into a compact JWT of type typ signed with the
+// active key. Every kind of token the gateway signs has its own typ, so one
+// cannot be passed off as another (RFC 8725 section 3.11).
+func (k *KeySet) Sign(typ string, claims any) (string, error) {
+	signer, err := jose.NewSigner(k.signingKey, (&jose.SignerOptions{}).WithType(jose.ContentType(typ)))
+	if err != nil {
+		return "", err
+	}
+	return jwt.Signed(signer).Claims(claims).Serialize()
+}
+
+// Verify checks the type and signature of token against the key set and
+// decodes its claims into dest. Registered claims (exp, iss, aud) are not
+// validated here.
+func (k *KeySet) Verify(token, typ string, dest ...any) error {
+	parsed, err := jwt.ParseSigned(token, supportedAlgorithms)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Headers) != 1 {
+		return fmt.Errorf("expected exactly one signature")
+	}
+	if !HasType(parsed.Headers[0], typ) {
+		return ErrUnexpectedType
+	}
+
+	for _, key := range k.keys {
+		if key.KeyID == parsed.Headers[0].KeyID {
+			return parsed.Claims(key.Public().Key, dest...)
+		}
+	}
+
+	return ErrUnknownKey
+}
+
+// HasType reports whether the typ header of a JWT is typ. Media types are
+// compared case-insensitively and the "application/" prefix is optional.
+func HasType(header jose.Header, typ string) bool {
+	actual, _ := header.ExtraHeaders[jose.HeaderType].(string)
+	return mediaType(actual) == mediaType(typ)
+}
+
+func mediaType(typ string) string {
+	return strings.TrimPrefix(strings.ToLower(typ), "application/")
+}
+
+// JWKS returns the public keys of the key set.
+func (k *KeySet) JWKS() *jose.JSONWebKeySet {
+	jwks := &jose.JSONWebKeySet{}
+	for _, key := range k.keys {
+		jwks.Keys = append(jwks.Keys, key.Public())
+	}
+	return jwks
+}
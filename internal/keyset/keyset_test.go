@@ -0,0 +1,151 @@
+package keyset
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+func writeRSAKey(t *testing.T, dir, name string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writeECKey(t *testing.T, dir, name string) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_SignAndVerify(t *testing.T) {
+	dir := t.TempDir()
+	testCases := []struct {
+		name string
+		path string
+		alg  string
+	}{
+		{name: "RSA", path: writeRSAKey(t, dir, "rsa.pem"), alg: "RS256"},
+		{name: "EC", path: writeECKey(t, dir, "ec.pem"), alg: "ES256"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ks, err := Load([]string{tc.path})
+			if err != nil {
+				t.Fatalf("failed to load key: %v", err)
+			}
+
+			jwks := ks.JWKS()
+			if len(jwks.Keys) != 1 {
+				t.Fatalf("expected 1 key, got %d", len(jwks.Keys))
+			}
+			if jwks.Keys[0].Algorithm != tc.alg {
+				t.Errorf("expected alg %s, got %s", tc.alg, jwks.Keys[0].Algorithm)
+			}
+			if !jwks.Keys[0].IsPublic() {
+				t.Error("JWKS must only contain public keys")
+			}
+
+			token, err := ks.Sign("at+jwt", jwt.Claims{Subject: "12345"})
+			if err != nil {
+				t.Fatalf("failed to sign: %v", err)
+			}
+
+			var claims jwt.Claims
+			if err := ks.Verify(token, "application/AT+JWT", &claims); err != nil {
+				t.Fatalf("failed to verify: %v", err)
+			}
+			if claims.Subject != "12345" {
+				t.Errorf("expected sub '12345', got '%s'", claims.Subject)
+			}
+			if err := ks.Verify(token, "JWT", &claims); !errors.Is(err, ErrUnexpectedType) {
+				t.Errorf("expected ErrUnexpectedType, got %v", err)
+			}
+		})
+	}
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := writeRSAKey(t, dir, "old.pem")
+	newKey := writeECKey(t, dir, "new.pem")
+
+	oldSet, err := Load([]string{oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := oldSet.Sign("JWT", jwt.Claims{Subject: "12345"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The new key signs, the old key is still published and accepted
+	rotated, err := Load([]string{newKey, oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated.JWKS().Keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(rotated.JWKS().Keys))
+	}
+	if err := rotated.Verify(token, "JWT", &jwt.Claims{}); err != nil {
+		t.Errorf("token signed by old key should verify: %v", err)
+	}
+
+	// Once the old key is retired its tokens are rejected
+	retired, err := Load([]string{newKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := retired.Verify(token, "JWT", &jwt.Claims{}); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey, got %v", err)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := Load(nil); !errors.Is(err, ErrNoKeys) {
+		t.Errorf("expected ErrNoKeys, got %v", err)
+	}
+
+	if _, err := Load([]string{filepath.Join(dir, "missing.pem")}); err == nil {
+		t.Error("expected error for missing file")
+	}
+
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(key)
+	path := filepath.Join(dir, "p384.pem")
+	os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600)
+	if _, err := Load([]string{path}); !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("expected ErrUnsupportedKey, got %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package mcpsession
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+	"github.com/schnurbus/go-mcp-gateway/internal/store"
+	"github.com/schnurbus/go-mcp-gateway/internal/utils"
+)
+
+// Header carries the session id of MCP Streamable HTTP requests.
+const Header = "Mcp-Session-Id"
+
+// terminateTimeout bounds the DELETE request that ends a session at the MCP
+// server.
+const terminateTimeout = 5 * time.Second
+
+// Owner is the user a session belongs to. Subjects are only unique per
+// identity provider, so the provider is part of the owner.
+type Owner struct {
+	Provider string `json:"provider"` // upstream provider or issuer, see tokenvalidator.Principal
+	Subject  string `json:"sub"`
+}
+
+func (o Owner) key() string {
+	return o.Provider + "\x00" + o.Subject
+}
+
+// Session is an MCP session a user opened through a proxy route.
+type Session struct {
+	ID        string `json:"id"`         // gateway id, see ID
+	SessionID string `json:"session_id"` // Mcp-Session-Id assigned by the MCP server
+	Route     string `json:"route"`      // gateway path of the MCP endpoint
+	Target    string `json:"target"`     // replica that created the session, the gateway replica for stdio routes
+	Endpoint  string `json:"endpoint"`   // URL of the MCP endpoint at the replica, empty for stdio routes
+	Owner
+	ClientID  string `json:"client_id,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Registry keeps track of the open MCP sessions, their replica and their user.
+// Sessions expire after store.MCPSessionTTL without requests.
+type Registry struct {
+	sessionStore *store.Store // key: id, value: session
+	userStore    *store.Store // key: owner, value: set of ids
+	client       *http.Client
+}
+
+func NewRegistry(rdb *redis.Client) *Registry {
+	return &Registry{
+		sessionStore: store.NewStore(rdb, "mcp_session", store.MCPSessionTTL),
+		userStore:    store.NewStore(rdb, "mcp_user_sessions", store.MCPSessionTTL),
+		client:       &http.Client{Timeout: terminateTimeout},
+	}
+}
+
+// ID returns the gateway id of the session sessionID of the MCP endpoint at
+// the gateway path route. Session ids are only unique per MCP server.
+func ID(route, sessionID string) string {
+	return utils.S256(route + "\x00" + sessionID)
+}
+
+// Create registers a new session.
+func (r *Registry) Create(ctx context.Context, session *Session) error {
+	session.ID = ID(session.Route, session.SessionID)
+	session.CreatedAt = time.Now().Unix()
+
+	sessionJSON, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	if err := r.sessionStore.Set(ctx, session.ID, sessionJSON); err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+	if err := r.userStore.SAdd(ctx, session.Owner.key(), session.ID); err != nil {
+		return fmt.Errorf("failed to index session: %w", err)
+	}
+	return nil
+}
+
+// Get returns the session sessionID of route and extends its lifetime. It
+// returns nil for unknown sessions.
+func (r *Registry) Get(ctx context.Context, route, sessionID string) (*Session, error) {
+	session, err := r.GetByID(ctx, ID(route, sessionID))
+	if err != nil || session == nil {
+		return nil, err
+	}
+	if err := r.sessionStore.Expire(ctx, session.ID); err != nil {
+		return nil, fmt.Errorf("failed to extend session: %w", err)
+	}
+	if err := r.userStore.Expire(ctx, session.Owner.key()); err != nil {
+		return nil, fmt.Errorf("failed to extend session index: %w", err)
+	}
+	return session, nil
+}
+
+// GetByID returns the session with the gateway id id, or nil.
+func (r *Registry) GetByID(ctx context.Context, id string) (*Session, error) {
+	sessionJSON, err := r.sessionStore.Get(ctx, id)
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal([]byte(sessionJSON), &session); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+	return &session, nil
+}
+
+// List returns the open sessions of owner.
+func (r *Registry) List(ctx context.Context, owner Owner) ([]*Session, error) {
+	ids, err := r.userStore.SMembers(ctx, owner.key())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	sessions := []*Session{}
+	for _, id := range ids {
+		session, err := r.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if session == nil {
+			// The session expired, drop it from the index
+			if err := r.userStore.SRem(ctx, owner.key(), id); err != nil {
+				return nil, fmt.Errorf("failed to prune sessions: %w", err)
+			}
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// Delete forgets session, following requests of it are rejected.
+func (r *Registry) Delete(ctx context.Context, session *Session) error {
+	if err := r.sessionStore.Del(ctx, session.ID); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if err := r.userStore.SRem(ctx, session.Owner.key(), session.ID); err != nil {
+		return fmt.Errorf("failed to unindex session: %w", err)
+	}
+	return nil
+}
+
+// ErrNotTerminated is returned by Terminate if the MCP server did not confirm
+// the end of a session.
+var ErrNotTerminated = errors.New("mcp server did not terminate the session")
+
+// Terminate deletes session and asks its MCP server to end it. The request is
+// authorized with token, the upstream access token of the owner, unless it is
+// empty. The session is deleted at the gateway even if the MCP server refuses,
+// which is reported as ErrNotTerminated. Sessions of stdio routes are ended by
+// the gateway that runs their MCP server once it notices the deletion.
+func (r *Registry) Terminate(ctx context.Context, session *Session, token string) error {
+	if err := r.Delete(ctx, session); err != nil {
+		return err
+	}
+	if session.Endpoint == "" {
+		return nil
+	}
+
+	log := logger.FromContext(ctx).With("session", session.ID, "endpoint", session.Endpoint)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, session.Endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create session termination request: %w", err)
+	}
+	req.Header.Set(Header, session.SessionID)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		log.Warn("failed to terminate session at mcp server", "error", err)
+		return fmt.Errorf("%w: %v", ErrNotTerminated, err)
+	}
+	resp.Body.Close()
+	// Sessions the MCP server already forgot are answered with 404
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		log.Warn("mcp server refused to terminate session", "status", resp.StatusCode)
+		return fmt.Errorf("%w: status %d", ErrNotTerminated, resp.StatusCode)
+	}
+	return nil
+}
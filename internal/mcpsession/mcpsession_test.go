@@ -0,0 +1,127 @@
+package mcpsession
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRegistry(t *testing.T) (*miniredis.Miniredis, *Registry) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return mr, NewRegistry(rdb)
+}
+
+func TestRegistry(t *testing.T) {
+	mr, registry := newTestRegistry(t)
+	ctx := t.Context()
+
+	alice := Owner{Provider: "google", Subject: "alice"}
+	for _, sessionID := range []string{"session-1", "session-2"} {
+		if err := registry.Create(ctx, &Session{
+			SessionID: sessionID,
+			Route:     "/calc/mcp",
+			Target:    "http://localhost:3000/mcp",
+			Owner:     alice,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The same subject at another provider is another user
+	if err := registry.Create(ctx, &Session{
+		SessionID: "session-3",
+		Route:     "/calc/mcp",
+		Target:    "http://localhost:3000/mcp",
+		Owner:     Owner{Provider: "github", Subject: "alice"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := registry.Get(ctx, "/calc/mcp", "session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session == nil || session.Owner != alice || session.ID != ID("/calc/mcp", "session-1") {
+		t.Fatalf("unexpected session %+v", session)
+	}
+	if session, _ := registry.Get(ctx, "/files/mcp", "session-1"); session != nil {
+		t.Errorf("expected session ids to be scoped to the route, got %+v", session)
+	}
+
+	// Expired sessions are pruned from the list
+	mr.Del("mcp_session:" + ID("/calc/mcp", "session-2"))
+	sessions, err := registry.List(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].SessionID != "session-1" {
+		t.Errorf("expected only session-1, got %+v", sessions)
+	}
+	if members, _ := mr.SMembers("mcp_user_sessions:" + alice.key()); len(members) != 1 {
+		t.Errorf("expected the expired session to be pruned, got %v", members)
+	}
+}
+
+func TestRegistry_Terminate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		token         string
+		status        int
+		expectedError error
+	}{
+		{name: "terminated", token: "upstream-token", status: http.StatusNoContent},
+		{name: "already ended", token: "upstream-token", status: http.StatusNotFound},
+		{name: "refused", status: http.StatusUnauthorized, expectedError: ErrNotTerminated},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, registry := newTestRegistry(t)
+			ctx := t.Context()
+
+			var deleted, authorization string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodDelete {
+					deleted = r.Header.Get(Header)
+					authorization = r.Header.Get("Authorization")
+				}
+				w.WriteHeader(tc.status)
+			}))
+			defer server.Close()
+
+			session := &Session{
+				SessionID: "session-1",
+				Route:     "/calc/mcp",
+				Target:    server.URL,
+				Endpoint:  server.URL + "/mcp",
+				Owner:     Owner{Provider: "google", Subject: "alice"},
+			}
+			if err := registry.Create(ctx, session); err != nil {
+				t.Fatal(err)
+			}
+			err := registry.Terminate(ctx, session, tc.token)
+			if !errors.Is(err, tc.expectedError) || (tc.expectedError == nil && err != nil) {
+				t.Errorf("expected error %v, got %v", tc.expectedError, err)
+			}
+
+			if deleted != "session-1" {
+				t.Errorf("expected the mcp server to be asked to end session-1, got %q", deleted)
+			}
+			if expected := "Bearer " + tc.token; tc.token != "" && authorization != expected {
+				t.Errorf("expected authorization %q, got %q", expected, authorization)
+			}
+			if tc.token == "" && authorization != "" {
+				t.Errorf("expected no authorization, got %q", authorization)
+			}
+			if session, _ := registry.Get(ctx, session.Route, session.SessionID); session != nil {
+				t.Errorf("expected the session to be deleted, got %+v", session)
+			}
+		})
+	}
+}
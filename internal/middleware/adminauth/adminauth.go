@@ -0,0 +1,33 @@
+package adminauth
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+)
+
+// New authenticates requests to the admin API with the bearer token apiKey.
+// Other tokens are answered with 401.
+func New(apiKey string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		log := logger.FromContext(c.Context()).With(
+			slog.String("middleware", "adminauth"),
+		)
+
+		token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) != 1 {
+			log.Warn("invalid admin api key", "path", c.Path())
+
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":       "invalid_token",
+				"description": "Invalid admin api key",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,44 @@
+package adminauth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestNew(t *testing.T) {
+	app := fiber.New()
+	app.Use(New("secret"))
+	app.Get("/admin/users/alice/sessions", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	testCases := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{"valid key", "Bearer secret", fiber.StatusOK},
+		{"invalid key", "Bearer secret2", fiber.StatusUnauthorized},
+		{"basic auth", "Basic secret", fiber.StatusUnauthorized},
+		{"missing key", "", fiber.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/users/alice/sessions", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("expected status %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package challenge
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/schnurbus/go-mcp-gateway/pkg/jsonrpc"
+)
+
+// RFC 6750 error codes
+const (
+	InvalidToken      = "invalid_token"
+	InsufficientScope = "insufficient_scope"
+)
+
+// Options describes how a proxy route answers requests that fail
+// authentication.
+type Options struct {
+	// ResourceMetadataURL is the RFC 9728 metadata document of the route.
+	ResourceMetadataURL string
+
+	// Scopes are the scopes required by the route.
+	Scopes []string
+
+	// LegacyErrors answers with HTTP 200 and only a JSON-RPC error body, for
+	// clients that predate the OAuth discovery of the MCP specification.
+	LegacyErrors bool
+}
+
+// Error is an authentication failure of a proxied request.
+type Error struct {
+	// Status is the HTTP status, 401 or 403 for insufficient scope.
+	Status int
+
+	// Code is the RFC 6750 error code. It is empty if the request carried no
+	// token at all.
+	Code string
+
+	// Message is the JSON-RPC error message.
+	Message string
+
+	// Data is the JSON-RPC error data.
+	Data jsonrpc.AuthErrorData
+}
+
+// Reject answers the request with a Bearer challenge pointing the client at
+// the resource metadata of the route, and a JSON-RPC error body for clients
+// that read it.
+func Reject(c *fiber.Ctx, opts Options, id any, e Error) error {
+	c.Set(fiber.HeaderWWWAuthenticate, Header(opts, e.Code))
+
+	status := e.Status
+	if opts.LegacyErrors {
+		status = fiber.StatusOK
+	}
+
+	return c.Status(status).JSON(jsonrpc.NewErrorResponse(id, e.Message, -32001, e.Data))
+}
+
+// Header builds the WWW-Authenticate header value of a Bearer challenge.
+func Header(opts Options, code string) string {
+	var params []string
+	if opts.ResourceMetadataURL != "" {
+		params = append(params, `resource_metadata="`+opts.ResourceMetadataURL+`"`)
+	}
+	if code != "" {
+		params = append(params, `error="`+code+`"`)
+	}
+	if len(opts.Scopes) > 0 {
+		params = append(params, `scope="`+strings.Join(opts.Scopes, " ")+`"`)
+	}
+
+	if len(params) == 0 {
+		return "Bearer"
+	}
+	return "Bearer " + strings.Join(params, ", ")
+}
@@ -0,0 +1,97 @@
+package gatewaytoken
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/schnurbus/go-mcp-gateway/internal/auth"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/challenge"
+	"github.com/schnurbus/go-mcp-gateway/pkg/jsonrpc"
+)
+
+// LocalsKey is the fiber.Ctx locals key under which the resolved
+// *auth.AccessToken is stored.
+const LocalsKey = "gateway_access_token"
+
+// New swaps gateway-issued access tokens for the upstream access token they
+// are mapped to, refreshed by the vault if needed, so that the token
+// validator and the proxied MCP server only ever see the upstream credential.
+// Tokens the gateway does not know are passed through unchanged.
+//
+// resource is the resource indicator of the route the middleware guards.
+// Gateway tokens bound to a different resource are rejected as described by
+// opts.
+func New(a *auth.Auth, resource string, opts challenge.Options) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		log := logger.FromContext(c.Context()).With(
+			slog.String("middleware", "gatewaytoken"),
+		)
+
+		authHeader := c.Get(fiber.HeaderAuthorization)
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			return c.Next()
+		}
+
+		accessToken, authErr := a.GetAccessToken(c.Context(), strings.TrimPrefix(authHeader, "Bearer "))
+		if authErr != nil {
+			log.Debug("not a gateway access token", "error", authErr.Description)
+			return c.Next()
+		}
+
+		if accessToken.Resource != "" && accessToken.Resource != resource {
+			log.Error("access token bound to another resource", "resource", accessToken.Resource, "route", resource)
+
+			var req jsonrpc.JSONRPCRequest
+			_ = c.BodyParser(&req)
+			return challenge.Reject(c, opts, req.ID, challenge.Error{
+				Status:  fiber.StatusUnauthorized,
+				Code:    challenge.InvalidToken,
+				Message: "Access token is not valid for this resource",
+				Data: jsonrpc.AuthErrorData{
+					Type:           "auth_error",
+					Reason:         "invalid_token",
+					RequiresReauth: true,
+				},
+			})
+		}
+
+		grant, authErr := a.UpstreamGrant(c.Context(), accessToken)
+		if authErr != nil {
+			var req jsonrpc.JSONRPCRequest
+			_ = c.BodyParser(&req)
+
+			if authErr.Code != auth.InvalidGrant {
+				log.Error("failed to get upstream access token", "error", authErr.Description)
+
+				return c.Status(fiber.StatusServiceUnavailable).JSON(
+					jsonrpc.NewErrorResponse(
+						req.ID,
+						"Upstream token temporarily unavailable",
+						-32001,
+						jsonrpc.AuthErrorData{
+							Type:   "auth_error",
+							Reason: "temporarily_unavailable",
+						}))
+			}
+
+			log.Error("upstream grant is no longer valid", "error", authErr.Description)
+			return challenge.Reject(c, opts, req.ID, challenge.Error{
+				Status:  fiber.StatusUnauthorized,
+				Code:    challenge.InvalidToken,
+				Message: "Upstream grant is no longer valid",
+				Data: jsonrpc.AuthErrorData{
+					Type:           "auth_error",
+					Reason:         "invalid_token",
+					RequiresReauth: true,
+				},
+			})
+		}
+
+		c.Locals(LocalsKey, accessToken)
+		c.Request().Header.Set(fiber.HeaderAuthorization, "Bearer "+grant.AccessToken)
+
+		return c.Next()
+	}
+}
@@ -5,14 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
-	"strings"
+	"net/url"
 	"time"
-
-	"github.com/gofiber/fiber/v2"
-	"github.com/schnurbus/go-mcp-gateway/internal/logger"
-	"github.com/schnurbus/go-mcp-gateway/pkg/jsonrpc"
 )
 
 type TokenInfoResponse struct {
@@ -30,108 +25,60 @@ type TokenInfoResponse struct {
 var (
 	ErrDecode       = errors.New("cannot decode token info")
 	ErrInvalidAud   = errors.New("invalid audience")
+	ErrInvalidToken = errors.New("invalid token")
 	ErrTokenExpired = errors.New("token is expired")
 )
 
-func New(googleClientId string) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		log := logger.FromContext(c.Context()).With(
-			slog.String("middleware", "googletokenvalidator"),
-		)
-
-		var req jsonrpc.JSONRPCRequest
-		if err := c.BodyParser(&req); err != nil {
-			log.Error("failed to parse request body", "error", err)
-		}
-
-		authHeader := c.Get(fiber.HeaderAuthorization)
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			log.Error("missing authorization header", "request-id", req.ID, "method", req.Method)
+// TokenInfoURL is Google's tokeninfo endpoint. It is a variable so tests can
+// point it at a local server.
+var TokenInfoURL = "https://www.googleapis.com/oauth2/v3/tokeninfo"
 
-			return c.Status(fiber.StatusOK).JSON(
-				jsonrpc.NewErrorResponse(
-					req.ID,
-					"Authentication token missing",
-					-32001,
-					jsonrpc.AuthErrorData{
-						Type:   "auth_error",
-						Reason: "missing_token",
-					}))
-		}
-
-		accessToken := strings.TrimPrefix(authHeader, "Bearer ")
-		isValid, err := validateGoogleToken(accessToken, googleClientId)
-		if err != nil || !isValid {
-			log.Error("invalid authorization token", "error", err)
-			if errors.Is(err, ErrInvalidAud) || errors.Is(err, ErrDecode) {
-				return c.Status(fiber.StatusOK).JSON(
-					jsonrpc.NewErrorResponse(
-						req.ID,
-						err.Error(),
-						-32001,
-						jsonrpc.AuthErrorData{
-							Type:           "auth_error",
-							Reason:         "invalid_token",
-							RequiresReauth: true,
-						}))
-			}
-			if errors.Is(err, ErrTokenExpired) {
-				return c.Status(fiber.StatusOK).JSON(
-					jsonrpc.NewErrorResponse(
-						req.ID,
-						err.Error(),
-						-32001,
-						jsonrpc.AuthErrorData{
-							Type:           "auth_error",
-							Reason:         "token_expired",
-							RequiresReauth: true,
-						}))
-			}
-			return c.Status(fiber.StatusOK).JSON(
-				jsonrpc.NewErrorResponse(
-					req.ID,
-					err.Error(),
-					-32001,
-					jsonrpc.AuthErrorData{
-						Type:           "auth_error",
-						Reason:         "invalid_token",
-						RequiresReauth: true,
-					}))
-		}
-		return c.Next()
-	}
-}
-
-func validateGoogleToken(token, googleClientId string) (bool, error) {
-	const validationURL = "https://www.googleapis.com/oauth2/v3/tokeninfo?access_token="
-
-	resp, err := http.Get(validationURL + token)
+// FetchTokenInfo asks Google's tokeninfo endpoint about an access token. It
+// returns ErrInvalidToken if Google does not know the token. Audience and
+// expiry are not checked.
+func FetchTokenInfo(token string) (*TokenInfoResponse, error) {
+	resp, err := http.Get(TokenInfoURL + "?access_token=" + url.QueryEscape(token))
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusOK {
 		tokenInfo := new(TokenInfoResponse)
 		if err := json.NewDecoder(resp.Body).Decode(tokenInfo); err != nil {
-			return false, ErrDecode
+			return nil, ErrDecode
 		}
+		return tokenInfo, nil
+	}
 
-		if tokenInfo.Aud != googleClientId {
-			return false, ErrInvalidAud
-		}
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrInvalidToken
+	}
 
-		if time.Now().After(time.Time(tokenInfo.Exp)) {
-			return false, ErrTokenExpired
-		}
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	return nil, fmt.Errorf("unexpected status code from Google: %d, body: %s", resp.StatusCode, string(bodyBytes))
+}
 
-		return true, nil
+func validateGoogleToken(token, googleClientId string) (bool, error) {
+	tokenInfo, err := FetchTokenInfo(token)
+	if err != nil {
+		return false, err
 	}
+	if err := CheckTokenInfo(tokenInfo, googleClientId); err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
-	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
-		return false, nil
+// CheckTokenInfo checks audience and expiry of a Google access token.
+func CheckTokenInfo(tokenInfo *TokenInfoResponse, googleClientId string) error {
+	if tokenInfo.Aud != googleClientId {
+		return ErrInvalidAud
 	}
 
-	bodyBytes, _ := io.ReadAll(resp.Body)
-	return false, fmt.Errorf("unexpected status code from Google: %d, body: %s", resp.StatusCode, string(bodyBytes))
+	if time.Now().After(time.Time(tokenInfo.Exp)) {
+		return ErrTokenExpired
+	}
+
+	return nil
 }
@@ -0,0 +1,175 @@
+package googletokenvalidator
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/schnurbus/go-mcp-gateway/internal/store"
+	"github.com/schnurbus/go-mcp-gateway/internal/utils"
+	"golang.org/x/sync/singleflight"
+)
+
+// cacheStats are published under "tokeninfo_cache" on the expvar endpoint.
+var cacheStats = expvar.NewMap("tokeninfo_cache")
+
+// CacheConfig configures the tokeninfo cache.
+type CacheConfig struct {
+	// Size is the number of tokens kept in memory.
+	Size int
+
+	// MaxTTL bounds how long a valid token is cached, and thereby how long a
+	// token revoked at Google is still accepted. Tokens are never cached
+	// beyond their expiry.
+	MaxTTL time.Duration
+
+	// NegativeTTL is how long tokens rejected by Google are remembered.
+	NegativeTTL time.Duration
+
+	// Store optionally shares results between gateway instances.
+	Store *store.Store
+}
+
+// Cache caches Google tokeninfo lookups keyed by a hash of the token.
+// Concurrent lookups of the same token share a single request to Google.
+type Cache struct {
+	mu          sync.Mutex
+	size        int
+	maxTTL      time.Duration
+	negativeTTL time.Duration
+	entries     map[string]*list.Element
+	lru         *list.List
+	store       *store.Store
+	group       singleflight.Group
+}
+
+type cacheEntry struct {
+	Key       string             `json:"-"`
+	TokenInfo *TokenInfoResponse `json:"token_info,omitempty"` // nil if Google rejected the token
+	ExpiresAt time.Time          `json:"expires_at"`
+}
+
+func NewCache(config *CacheConfig) *Cache {
+	return &Cache{
+		size:        config.Size,
+		maxTTL:      config.MaxTTL,
+		negativeTTL: config.NegativeTTL,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+		store:       config.Store,
+	}
+}
+
+// TokenInfo returns the token info of token from the cache or, on a miss,
+// from Google. Like FetchTokenInfo it returns ErrInvalidToken for tokens
+// Google does not know.
+func (c *Cache) TokenInfo(ctx context.Context, token string) (*TokenInfoResponse, error) {
+	key := utils.S256(token)
+
+	if entry := c.get(ctx, key); entry != nil {
+		cacheStats.Add("hits", 1)
+		if entry.TokenInfo == nil {
+			cacheStats.Add("negative_hits", 1)
+			return nil, ErrInvalidToken
+		}
+		return entry.TokenInfo, nil
+	}
+	cacheStats.Add("misses", 1)
+
+	v, err, _ := c.group.Do(key, func() (any, error) {
+		cacheStats.Add("lookups", 1)
+		tokenInfo, err := FetchTokenInfo(token)
+		switch {
+		case err == nil:
+			expiresAt := time.Time(tokenInfo.Exp)
+			if maxExpiresAt := time.Now().Add(c.maxTTL); c.maxTTL > 0 && expiresAt.After(maxExpiresAt) {
+				expiresAt = maxExpiresAt
+			}
+			c.set(ctx, &cacheEntry{Key: key, TokenInfo: tokenInfo, ExpiresAt: expiresAt})
+		case errors.Is(err, ErrInvalidToken):
+			if c.negativeTTL > 0 {
+				c.set(ctx, &cacheEntry{Key: key, ExpiresAt: time.Now().Add(c.negativeTTL)})
+			}
+		}
+		return tokenInfo, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*TokenInfoResponse), nil
+}
+
+func (c *Cache) get(ctx context.Context, key string) *cacheEntry {
+	now := time.Now()
+
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		if now.Before(entry.ExpiresAt) {
+			c.lru.MoveToFront(elem)
+			c.mu.Unlock()
+			return entry
+		}
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+
+	if c.store == nil {
+		return nil
+	}
+
+	entryJSON, err := c.store.Get(ctx, key)
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal([]byte(entryJSON), &entry); err != nil || !now.Before(entry.ExpiresAt) {
+		return nil
+	}
+	entry.Key = key
+	c.add(&entry)
+	return &entry
+}
+
+func (c *Cache) set(ctx context.Context, entry *cacheEntry) {
+	ttl := time.Until(entry.ExpiresAt)
+	if ttl <= 0 {
+		return
+	}
+
+	c.add(entry)
+
+	if c.store == nil {
+		return
+	}
+	if entryJSON, err := json.Marshal(entry); err == nil {
+		_ = c.store.SetWithTTL(ctx, entry.Key, entryJSON, ttl)
+	}
+}
+
+func (c *Cache) add(entry *cacheEntry) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[entry.Key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[entry.Key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).Key)
+	}
+}
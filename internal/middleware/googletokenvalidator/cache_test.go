@@ -0,0 +1,135 @@
+package googletokenvalidator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/store"
+)
+
+// newTokenInfoServer fakes Google's tokeninfo endpoint. Only "valid-token" is
+// known to it. The returned counter tracks the number of lookups.
+func newTokenInfoServer(t *testing.T) *atomic.Int32 {
+	t.Helper()
+	var lookups atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		if r.URL.Query().Get("access_token") != "valid-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"aud": "test-client-id",
+			"sub": "12345",
+			"exp": strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10),
+		})
+	}))
+	t.Cleanup(mockServer.Close)
+
+	originalURL := TokenInfoURL
+	TokenInfoURL = mockServer.URL
+	t.Cleanup(func() { TokenInfoURL = originalURL })
+
+	return &lookups
+}
+
+func TestCache_TokenInfo(t *testing.T) {
+	lookups := newTokenInfoServer(t)
+	cache := NewCache(&CacheConfig{Size: 10, MaxTTL: time.Minute, NegativeTTL: time.Minute})
+	ctx := context.Background()
+
+	for range 3 {
+		tokenInfo, err := cache.TokenInfo(ctx, "valid-token")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if tokenInfo.Sub != "12345" {
+			t.Errorf("expected sub '12345', got '%s'", tokenInfo.Sub)
+		}
+	}
+	for range 3 {
+		if _, err := cache.TokenInfo(ctx, "invalid-token"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("expected ErrInvalidToken, got %v", err)
+		}
+	}
+
+	if n := lookups.Load(); n != 2 {
+		t.Errorf("expected 2 lookups at Google, got %d", n)
+	}
+}
+
+func TestCache_Singleflight(t *testing.T) {
+	lookups := newTokenInfoServer(t)
+	cache := NewCache(&CacheConfig{Size: 10, MaxTTL: time.Minute})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.TokenInfo(context.Background(), "valid-token"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := lookups.Load(); n != 1 {
+		t.Errorf("expected concurrent requests to share 1 lookup, got %d", n)
+	}
+}
+
+func TestCache_Eviction(t *testing.T) {
+	lookups := newTokenInfoServer(t)
+	cache := NewCache(&CacheConfig{Size: 1, MaxTTL: time.Minute, NegativeTTL: time.Minute})
+	ctx := context.Background()
+
+	cache.TokenInfo(ctx, "valid-token")
+	cache.TokenInfo(ctx, "invalid-token")
+	cache.TokenInfo(ctx, "valid-token")
+
+	if n := lookups.Load(); n != 3 {
+		t.Errorf("expected evicted token to be looked up again, got %d lookups", n)
+	}
+}
+
+func TestCache_Redis(t *testing.T) {
+	lookups := newTokenInfoServer(t)
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	ctx := context.Background()
+
+	// Two gateway instances sharing Redis
+	first := NewCache(&CacheConfig{Size: 10, MaxTTL: time.Minute, Store: store.NewStore(rdb, "tokeninfo", time.Hour)})
+	second := NewCache(&CacheConfig{Size: 10, MaxTTL: time.Minute, Store: store.NewStore(rdb, "tokeninfo", time.Hour)})
+
+	if _, err := first.TokenInfo(ctx, "valid-token"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tokenInfo, err := second.TokenInfo(ctx, "valid-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tokenInfo.Aud != "test-client-id" {
+		t.Errorf("expected aud 'test-client-id', got '%s'", tokenInfo.Aud)
+	}
+	if time.Time(tokenInfo.Exp).Before(time.Now()) {
+		t.Error("expected exp to survive the round trip through Redis")
+	}
+
+	if n := lookups.Load(); n != 1 {
+		t.Errorf("expected 1 lookup at Google, got %d", n)
+	}
+}
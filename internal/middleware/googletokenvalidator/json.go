@@ -23,6 +23,10 @@ func (jt *JsonTimestamp) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+func (jt JsonTimestamp) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatInt(time.Time(jt).Unix(), 10)), nil
+}
+
 func (jb *JsonBool) UnmarshalJSON(b []byte) error {
 	s := strings.Trim(string(b), `"`)
 
@@ -0,0 +1,134 @@
+package identity
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/schnurbus/go-mcp-gateway/internal/auth"
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/gatewaytoken"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/tokenauth"
+	"github.com/schnurbus/go-mcp-gateway/internal/tokenvalidator"
+	"github.com/schnurbus/go-mcp-gateway/pkg/jsonrpc"
+)
+
+// Config configures the identity headers of a proxy route.
+type Config struct {
+	// Headers are the header names the identity claims are forwarded in,
+	// keyed by config.Identity* claim. Claims not listed are not forwarded.
+	Headers map[string]string
+
+	// Assertion sends a signed identity assertion with every request. Nil
+	// sends none.
+	Assertion *AssertionConfig
+}
+
+// AssertionConfig configures the identity assertions of a proxy route.
+type AssertionConfig struct {
+	// Auth signs the assertions.
+	Auth *auth.Auth
+
+	// Audience is the resource of the route.
+	Audience string
+
+	// Header is the header the assertion is sent in. Authorization sends it
+	// as bearer token in place of the upstream token.
+	Header string
+}
+
+// headerValueReplacer drops line breaks, so claims cannot inject headers.
+var headerValueReplacer = strings.NewReplacer("\r", "", "\n", "")
+
+// New forwards the identity of the validated token to the MCP server, so it
+// does not have to look up the user itself. It runs after tokenauth. Client
+// supplied copies of the identity headers are always removed, the MCP server
+// can trust them. With an assertion configured, the identity is also sent as a
+// JWT signed by the gateway, which MCP servers verify against the gateway JWKS.
+func New(cfg Config) fiber.Handler {
+	replaceToken := cfg.Assertion != nil && strings.EqualFold(cfg.Assertion.Header, fiber.HeaderAuthorization)
+
+	return func(c *fiber.Ctx) error {
+		log := logger.FromContext(c.Context()).With(
+			slog.String("middleware", "identity"),
+		)
+
+		for _, header := range cfg.Headers {
+			if len(c.Request().Header.Peek(header)) > 0 {
+				log.Warn("removing client supplied identity header", "header", header)
+			}
+			c.Request().Header.Del(header)
+		}
+		if cfg.Assertion != nil && !replaceToken {
+			c.Request().Header.Del(cfg.Assertion.Header)
+		}
+
+		principal, ok := c.Locals(tokenauth.LocalsKey).(*tokenvalidator.Principal)
+		if !ok {
+			return c.Next()
+		}
+
+		for claim, header := range cfg.Headers {
+			if value := claimValue(c, principal, claim); value != "" {
+				c.Request().Header.Set(header, headerValueReplacer.Replace(value))
+			}
+		}
+
+		if cfg.Assertion == nil {
+			return c.Next()
+		}
+
+		assertion, err := cfg.Assertion.Auth.SignIdentityAssertion(&auth.IdentityAssertion{
+			Subject:   principal.Subject,
+			Email:     principal.Email,
+			Name:      claimValue(c, principal, config.IdentityName),
+			ClientID:  claimValue(c, principal, config.IdentityClientID),
+			RequestID: claimValue(c, principal, config.IdentityRequestID),
+			Audience:  cfg.Assertion.Audience,
+		})
+		if err != nil {
+			log.Error("failed to sign identity assertion", "error", err)
+
+			var req jsonrpc.JSONRPCRequest
+			_ = c.BodyParser(&req)
+			return c.Status(fiber.StatusInternalServerError).JSON(
+				jsonrpc.NewErrorResponse(req.ID, "Internal error", -32603, nil))
+		}
+		if replaceToken {
+			c.Request().Header.Set(fiber.HeaderAuthorization, "Bearer "+assertion)
+		} else {
+			c.Request().Header.Set(cfg.Assertion.Header, assertion)
+		}
+
+		return c.Next()
+	}
+}
+
+func claimValue(c *fiber.Ctx, principal *tokenvalidator.Principal, claim string) string {
+	switch claim {
+	case config.IdentitySubject:
+		return principal.Subject
+	case config.IdentityEmail:
+		return principal.Email
+	case config.IdentityName:
+		// Google tokeninfo has no name, the swapped gateway token may have one
+		if principal.Name == "" {
+			if accessToken, ok := c.Locals(gatewaytoken.LocalsKey).(*auth.AccessToken); ok {
+				return accessToken.Name
+			}
+		}
+		return principal.Name
+	case config.IdentityClientID:
+		// The tokeninfo of a swapped gateway token names the gateway's own
+		// Google client, the gateway token the MCP client
+		if accessToken, ok := c.Locals(gatewaytoken.LocalsKey).(*auth.AccessToken); ok {
+			return accessToken.ClientID
+		}
+		return principal.ClientID
+	case config.IdentityRequestID:
+		requestId, _ := c.Locals("requestid").(string)
+		return requestId
+	}
+	return ""
+}
@@ -0,0 +1,216 @@
+package identity
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/schnurbus/go-mcp-gateway/internal/auth"
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+	"github.com/schnurbus/go-mcp-gateway/internal/keyset"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/gatewaytoken"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/tokenauth"
+	"github.com/schnurbus/go-mcp-gateway/internal/tokenvalidator"
+)
+
+func TestNew(t *testing.T) {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("requestid", "request-1")
+		if c.Get("Authorization") == "Bearer valid" {
+			c.Locals(tokenauth.LocalsKey, &tokenvalidator.Principal{
+				Subject:  "12345",
+				Email:    "alice@example.com",
+				Name:     "Alice\r\nX-Injected: yes",
+				ClientID: "client-a",
+			})
+		}
+		if c.Get("Authorization") == "Bearer swapped" {
+			c.Locals(gatewaytoken.LocalsKey, &auth.AccessToken{UID: "12345", Name: "Alice", ClientID: "client-a"})
+			c.Locals(tokenauth.LocalsKey, &tokenvalidator.Principal{
+				Subject:  "12345",
+				ClientID: "gateway.apps.googleusercontent.com",
+			})
+		}
+		return c.Next()
+	})
+	app.Use(New(Config{
+		Headers: map[string]string{
+			config.IdentitySubject:   "X-Forwarded-User",
+			config.IdentityName:      "X-Forwarded-Name",
+			config.IdentityClientID:  "X-Client",
+			config.IdentityRequestID: "X-Request-Id",
+		},
+	}))
+	app.Get("/mcp", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"user":      c.Get("X-Forwarded-User"),
+			"name":      c.Get("X-Forwarded-Name"),
+			"client":    c.Get("X-Client"),
+			"request":   c.Get("X-Request-Id"),
+			"email":     c.Get("X-Forwarded-Email"),
+			"injected":  c.Get("X-Injected"),
+			"forwarded": c.Get("X-Forwarded-User") != "",
+		})
+	})
+
+	testCases := []struct {
+		name          string
+		authorization string
+		expected      string
+	}{
+		{
+			name:          "validated token",
+			authorization: "Bearer valid",
+			expected:      `{"client":"client-a","email":"","forwarded":true,"injected":"","name":"AliceX-Injected: yes","request":"request-1","user":"12345"}`,
+		},
+		{
+			name:          "swapped gateway token",
+			authorization: "Bearer swapped",
+			expected:      `{"client":"client-a","email":"","forwarded":true,"injected":"","name":"Alice","request":"request-1","user":"12345"}`,
+		},
+		{
+			name:     "spoofed headers without token",
+			expected: `{"client":"","email":"","forwarded":false,"injected":"","name":"","request":"","user":""}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/mcp", nil)
+			req.Header.Set("X-Forwarded-User", "admin")
+			req.Header.Set("X-Client", "trusted-client")
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := make([]byte, 512)
+			n, _ := resp.Body.Read(body)
+			if got := string(body[:n]); got != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func newTestKeySet(t *testing.T) *keyset.KeySet {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := keyset.ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := keyset.New([]jose.JSONWebKey{jwk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func TestNewAssertion(t *testing.T) {
+	ks := newTestKeySet(t)
+	a := auth.NewAuth(&auth.AuthConfig{
+		BaseURL: "http://localhost:8080",
+		KeySet:  ks,
+	}, nil)
+
+	testCases := []struct {
+		name          string
+		header        string
+		authorization string
+	}{
+		{
+			name:          "accompanies the upstream token",
+			header:        "X-Gateway-Identity",
+			authorization: "Bearer upstream",
+		},
+		{
+			name:   "replaces the upstream token",
+			header: "Authorization",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				c.Locals("requestid", "request-1")
+				c.Locals(tokenauth.LocalsKey, &tokenvalidator.Principal{
+					Subject:  "12345",
+					Email:    "alice@example.com",
+					ClientID: "client-a",
+				})
+				return c.Next()
+			})
+			app.Use(New(Config{
+				Assertion: &AssertionConfig{
+					Auth:     a,
+					Audience: "http://localhost:8080/calc/mcp",
+					Header:   tc.header,
+				},
+			}))
+			app.Get("/mcp", func(c *fiber.Ctx) error {
+				return c.JSON(fiber.Map{
+					"authorization": c.Get("Authorization"),
+					"assertion":     c.Get(tc.header),
+				})
+			})
+
+			req := httptest.NewRequest("GET", "/mcp", nil)
+			req.Header.Set("Authorization", "Bearer upstream")
+			req.Header.Set("X-Gateway-Identity", "spoofed")
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got struct {
+				Authorization string `json:"authorization"`
+				Assertion     string `json:"assertion"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if tc.authorization != "" && got.Authorization != tc.authorization {
+				t.Errorf("expected authorization %s, got %s", tc.authorization, got.Authorization)
+			}
+
+			var claims auth.IdentityAssertionClaims
+			if err := ks.Verify(strings.TrimPrefix(got.Assertion, "Bearer "), auth.IdentityAssertionType, &claims); err != nil {
+				t.Fatalf("failed to verify assertion %q: %v", got.Assertion, err)
+			}
+			if err := claims.Validate(jwt.Expected{
+				Issuer:      "http://localhost:8080",
+				Subject:     "12345",
+				AnyAudience: jwt.Audience{"http://localhost:8080/calc/mcp"},
+				Time:        time.Now(),
+			}); err != nil {
+				t.Error(err)
+			}
+			if claims.Email != "alice@example.com" || claims.ClientID != "client-a" || claims.RequestID != "request-1" {
+				t.Errorf("unexpected claims %+v", claims)
+			}
+		})
+	}
+}
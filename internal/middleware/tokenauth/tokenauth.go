@@ -0,0 +1,136 @@
+package tokenauth
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/challenge"
+	"github.com/schnurbus/go-mcp-gateway/internal/tokenvalidator"
+	"github.com/schnurbus/go-mcp-gateway/pkg/jsonrpc"
+)
+
+// LocalsKey is the fiber.Ctx locals key under which the validated
+// *tokenvalidator.Principal is stored.
+const LocalsKey = "principal"
+
+// Config configures the token authentication of a proxy route.
+type Config struct {
+	// Validator validates the bearer token.
+	Validator tokenvalidator.TokenValidator
+
+	// Challenge configures the error responses. Its scopes are required to
+	// be granted to the token.
+	Challenge challenge.Options
+
+	// UpstreamScopes are required to be granted to the upstream Google access
+	// token the MCP server receives.
+	UpstreamScopes []string
+}
+
+// New authenticates proxied requests with the bearer token validator of the
+// route. Missing and invalid tokens are answered with 401, tokens lacking a
+// required scope or upstream scope with 403, and requests whose token could
+// not be checked with 503.
+func New(cfg Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		log := logger.FromContext(c.Context()).With(
+			slog.String("middleware", "tokenauth"),
+		)
+
+		var req jsonrpc.JSONRPCRequest
+		if err := c.BodyParser(&req); err != nil {
+			log.Debug("failed to parse request body", "error", err)
+		}
+
+		authHeader := c.Get(fiber.HeaderAuthorization)
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			log.Error("missing authorization header", "request-id", req.ID, "method", req.Method)
+
+			return challenge.Reject(c, cfg.Challenge, req.ID, challenge.Error{
+				Status:  fiber.StatusUnauthorized,
+				Message: "Authentication token missing",
+				Data: jsonrpc.AuthErrorData{
+					Type:   "auth_error",
+					Reason: "missing_token",
+				},
+			})
+		}
+
+		principal, err := cfg.Validator.Validate(c.Context(), strings.TrimPrefix(authHeader, "Bearer "))
+		if err != nil && !errors.Is(err, tokenvalidator.ErrInvalidToken) && !errors.Is(err, tokenvalidator.ErrTokenExpired) {
+			log.Error("failed to validate authorization token", "error", err)
+
+			return c.Status(fiber.StatusServiceUnavailable).JSON(
+				jsonrpc.NewErrorResponse(
+					req.ID,
+					"Token validation temporarily unavailable",
+					-32001,
+					jsonrpc.AuthErrorData{
+						Type:   "auth_error",
+						Reason: "temporarily_unavailable",
+					}))
+		}
+		if err != nil {
+			log.Error("invalid authorization token", "error", err)
+
+			reason := "invalid_token"
+			if errors.Is(err, tokenvalidator.ErrTokenExpired) {
+				reason = "token_expired"
+			}
+			return challenge.Reject(c, cfg.Challenge, req.ID, challenge.Error{
+				Status:  fiber.StatusUnauthorized,
+				Code:    challenge.InvalidToken,
+				Message: err.Error(),
+				Data: jsonrpc.AuthErrorData{
+					Type:           "auth_error",
+					Reason:         reason,
+					RequiresReauth: true,
+				},
+			})
+		}
+
+		if !principal.HasScopes(cfg.Challenge.Scopes) {
+			log.Error("insufficient scope", "sub", principal.Subject, "scopes", principal.Scopes)
+
+			return challenge.Reject(c, cfg.Challenge, req.ID, challenge.Error{
+				Status:  fiber.StatusForbidden,
+				Code:    challenge.InsufficientScope,
+				Message: "insufficient scope",
+				Data: jsonrpc.AuthErrorData{
+					Type:           "auth_error",
+					Reason:         "insufficient_scope",
+					RequiresReauth: true,
+				},
+			})
+		}
+
+		// The challenge names the missing upstream scopes, so the client can
+		// authorize them incrementally
+		if missing := principal.MissingUpstreamScopes(cfg.UpstreamScopes); len(missing) > 0 {
+			log.Error("insufficient upstream scope", "sub", principal.Subject, "missing", missing)
+
+			opts := cfg.Challenge
+			opts.Scopes = missing
+			return challenge.Reject(c, opts, req.ID, challenge.Error{
+				Status:  fiber.StatusForbidden,
+				Code:    challenge.InsufficientScope,
+				Message: "insufficient upstream scope",
+				Data: jsonrpc.AuthErrorData{
+					Type:           "auth_error",
+					Reason:         "insufficient_scope",
+					RequiresReauth: true,
+				},
+			})
+		}
+
+		c.Locals(LocalsKey, principal)
+		if principal.UpstreamToken != "" {
+			c.Request().Header.Set(fiber.HeaderAuthorization, "Bearer "+principal.UpstreamToken)
+		}
+
+		return c.Next()
+	}
+}
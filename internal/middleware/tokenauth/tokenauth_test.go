@@ -0,0 +1,118 @@
+package tokenauth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/challenge"
+	"github.com/schnurbus/go-mcp-gateway/internal/tokenvalidator"
+)
+
+type fakeValidator map[string]*tokenvalidator.Principal
+
+func (v fakeValidator) Validate(ctx context.Context, token string) (*tokenvalidator.Principal, error) {
+	switch token {
+	case "expired-token":
+		return nil, tokenvalidator.ErrTokenExpired
+	case "unavailable":
+		return nil, errors.New("connection refused")
+	}
+	if principal, ok := v[token]; ok {
+		return principal, nil
+	}
+	return nil, tokenvalidator.ErrInvalidToken
+}
+
+func TestNew(t *testing.T) {
+	validator := fakeValidator{
+		"reader":   {Subject: "12345", Scopes: []string{"mcp:read"}},
+		"writer":   {Subject: "12345", Scopes: []string{"mcp:read", "mcp:write"}, UpstreamScopes: []string{"openid", "drive.readonly"}},
+		"no-drive": {Subject: "12345", Scopes: []string{"mcp:read", "mcp:write"}, UpstreamScopes: []string{"openid"}},
+	}
+
+	app := fiber.New()
+	app.Use(New(Config{
+		Validator: validator,
+		Challenge: challenge.Options{
+			ResourceMetadataURL: "http://localhost:8080/.well-known/oauth-protected-resource/calc/mcp",
+			Scopes:              []string{"mcp:write"},
+		},
+		UpstreamScopes: []string{"drive.readonly"},
+	}))
+	app.Post("/calc/mcp", func(c *fiber.Ctx) error {
+		principal := c.Locals(LocalsKey).(*tokenvalidator.Principal)
+		return c.SendString(principal.Subject)
+	})
+
+	testCases := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+		expectedHeader string
+	}{
+		{
+			name:           "valid token",
+			authorization:  "Bearer writer",
+			expectedStatus: fiber.StatusOK,
+		},
+		{
+			name:           "missing token",
+			expectedStatus: fiber.StatusUnauthorized,
+			expectedHeader: `Bearer resource_metadata="http://localhost:8080/.well-known/oauth-protected-resource/calc/mcp", scope="mcp:write"`,
+		},
+		{
+			name:           "invalid token",
+			authorization:  "Bearer unknown",
+			expectedStatus: fiber.StatusUnauthorized,
+			expectedHeader: `Bearer resource_metadata="http://localhost:8080/.well-known/oauth-protected-resource/calc/mcp", error="invalid_token", scope="mcp:write"`,
+		},
+		{
+			name:           "expired token",
+			authorization:  "Bearer expired-token",
+			expectedStatus: fiber.StatusUnauthorized,
+			expectedHeader: `Bearer resource_metadata="http://localhost:8080/.well-known/oauth-protected-resource/calc/mcp", error="invalid_token", scope="mcp:write"`,
+		},
+		{
+			name:           "insufficient scope",
+			authorization:  "Bearer reader",
+			expectedStatus: fiber.StatusForbidden,
+			expectedHeader: `Bearer resource_metadata="http://localhost:8080/.well-known/oauth-protected-resource/calc/mcp", error="insufficient_scope", scope="mcp:write"`,
+		},
+		{
+			name:           "insufficient upstream scope",
+			authorization:  "Bearer no-drive",
+			expectedStatus: fiber.StatusForbidden,
+			expectedHeader: `Bearer resource_metadata="http://localhost:8080/.well-known/oauth-protected-resource/calc/mcp", error="insufficient_scope", scope="drive.readonly"`,
+		},
+		{
+			name:           "validator unavailable",
+			authorization:  "Bearer unavailable",
+			expectedStatus: fiber.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/calc/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"test"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("expected status %d, got %d", tc.expectedStatus, resp.StatusCode)
+			}
+			if got := resp.Header.Get(fiber.HeaderWWWAuthenticate); got != tc.expectedHeader {
+				t.Errorf("expected WWW-Authenticate '%s', got '%s'", tc.expectedHeader, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package dev
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider"
+	"github.com/schnurbus/go-mcp-gateway/internal/store"
+	"github.com/schnurbus/go-mcp-gateway/internal/utils"
+	"golang.org/x/oauth2"
+)
+
+// LoginPath serves the login form of the development provider.
+const LoginPath = "/oauth/dev/login"
+
+// accessTokenTTL is the lifetime of the upstream access tokens, so refreshes
+// can be exercised.
+const accessTokenTTL = time.Hour
+
+var _ provider.Provider = (*DevProvider)(nil)
+
+type DevConfig struct {
+	Users       []string // email addresses of the test users
+	LoginURL    string   // BaseURL + LoginPath
+	RedirectURI string
+}
+
+// DevProvider is an identity provider for local development and CI. Anyone
+// can sign in as any of the configured test users without a password, it
+// must never be enabled in production.
+type DevProvider struct {
+	users             []string
+	loginURL          string
+	redirectURI       string
+	flowStore         *provider.FlowStore
+	loginStore        *store.Store // key: sid, value: login
+	refreshTokenStore *store.Store // key: refresh token, value: email
+}
+
+type login struct {
+	Code  string `json:"code"`
+	Email string `json:"email"`
+}
+
+func NewDevProvider(config *DevConfig, rdb *redis.Client) *DevProvider {
+	return &DevProvider{
+		users:             config.Users,
+		loginURL:          config.LoginURL,
+		redirectURI:       config.RedirectURI,
+		flowStore:         provider.NewFlowStore(rdb, "dev"),
+		loginStore:        store.NewStore(rdb, "dev_login", store.OAuthStateTTL),
+		refreshTokenStore: store.NewStore(rdb, "dev_refresh_token", store.OAuthRefreshTokenTTL),
+	}
+}
+
+// Users returns the email addresses of the test users.
+func (p *DevProvider) Users() []string {
+	return p.users
+}
+
+func (p *DevProvider) GetAuthCodeURL(ctx context.Context, sid string) (string, error) {
+	flow, err := p.flowStore.Begin(ctx, sid)
+	if err != nil {
+		return "", err
+	}
+
+	return p.loginURL + "?state=" + url.QueryEscape(flow.State), nil
+}
+
+// Login signs the session sid in as the test user email and returns the
+// callback URL the login form redirects to.
+func (p *DevProvider) Login(ctx context.Context, sid, state, email string) (string, error) {
+	if !slices.Contains(p.users, email) {
+		return "", fmt.Errorf("unknown test user: %s", email)
+	}
+
+	code := utils.RandString(32)
+	loginJSON, err := json.Marshal(&login{Code: code, Email: email})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal login: %w", err)
+	}
+	if err := p.loginStore.Set(ctx, sid, loginJSON); err != nil {
+		return "", fmt.Errorf("failed to store login: %w", err)
+	}
+
+	return p.redirectURI + "?state=" + url.QueryEscape(state) + "&code=" + url.QueryEscape(code), nil
+}
+
+func (p *DevProvider) Callback(ctx context.Context, sid, state, code string) (*provider.AuthResult, error) {
+	if _, err := p.flowStore.Complete(ctx, sid, state); err != nil {
+		return nil, err
+	}
+
+	loginJSON, err := p.loginStore.GetDel(ctx, sid)
+	if err != nil {
+		return nil, fmt.Errorf("could not get login from store: %w", err)
+	}
+	var l login
+	if err := json.Unmarshal([]byte(loginJSON), &l); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal login: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(l.Code), []byte(code)) != 1 {
+		return nil, fmt.Errorf("invalid code")
+	}
+
+	refreshToken := utils.RandString(32)
+	if err := p.refreshTokenStore.Set(ctx, refreshToken, l.Email); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	name, _, _ := strings.Cut(l.Email, "@")
+	return &provider.AuthResult{
+		Identity: &provider.Identity{
+			Subject:       l.Email,
+			Email:         l.Email,
+			EmailVerified: true,
+			Name:          name,
+		},
+		AccessToken:  "dev-" + utils.RandString(32),
+		RefreshToken: refreshToken,
+		Expiry:       time.Now().Add(accessTokenTTL).Unix(),
+	}, nil
+}
+
+func (p *DevProvider) RefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	if _, err := p.refreshTokenStore.Get(ctx, refreshToken); err != nil {
+		return nil, fmt.Errorf("%w: unknown refresh token", provider.ErrInvalidGrant)
+	}
+
+	return &oauth2.Token{
+		AccessToken:  "dev-" + utils.RandString(32),
+		RefreshToken: refreshToken,
+		Expiry:       time.Now().Add(accessTokenTTL),
+	}, nil
+}
+
+func (p *DevProvider) RevokeToken(ctx context.Context, token string) error {
+	return p.refreshTokenStore.Del(ctx, token)
+}
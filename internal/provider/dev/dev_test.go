@@ -0,0 +1,107 @@
+package dev
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestProvider(t *testing.T) *DevProvider {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	return NewDevProvider(&DevConfig{
+		Users:       []string{"alice@example.com", "bob@example.com"},
+		LoginURL:    "http://localhost:8080" + LoginPath,
+		RedirectURI: "http://localhost:8080/oauth/callback",
+	}, rdb)
+}
+
+// signIn walks through the login form and returns the state and code of the
+// callback.
+func signIn(t *testing.T, p *DevProvider, sid, email string) (string, string) {
+	t.Helper()
+	ctx := context.Background()
+
+	authCodeURL, err := p.GetAuthCodeURL(ctx, sid)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(authCodeURL, "http://localhost:8080"+LoginPath+"?") {
+		t.Fatalf("expected login form URL, got '%s'", authCodeURL)
+	}
+	state := mustParse(t, authCodeURL).Query().Get("state")
+
+	callbackURL, err := p.Login(ctx, sid, state, email)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	query := mustParse(t, callbackURL).Query()
+	if query.Get("state") != state {
+		t.Fatalf("expected state '%s', got '%s'", state, query.Get("state"))
+	}
+	return state, query.Get("code")
+}
+
+func mustParse(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("failed to parse URL: %v", err)
+	}
+	return u
+}
+
+func TestDevProvider_Flow(t *testing.T) {
+	p := newTestProvider(t)
+	ctx := context.Background()
+
+	state, code := signIn(t, p, "sid", "alice@example.com")
+	result, err := p.Callback(ctx, "sid", state, code)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Identity.Subject != "alice@example.com" || !result.Identity.EmailVerified || result.Identity.Name != "alice" {
+		t.Errorf("unexpected identity: %+v", result.Identity)
+	}
+	if result.AccessToken == "" || result.RefreshToken == "" || result.Expiry == 0 {
+		t.Errorf("expected tokens and expiry, got %+v", result)
+	}
+
+	if _, err := p.RefreshToken(ctx, result.RefreshToken); err != nil {
+		t.Errorf("unexpected refresh error: %v", err)
+	}
+	if err := p.RevokeToken(ctx, result.RefreshToken); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := p.RefreshToken(ctx, result.RefreshToken); err == nil {
+		t.Error("revoked refresh token should not refresh")
+	}
+}
+
+func TestDevProvider_UnknownUser(t *testing.T) {
+	p := newTestProvider(t)
+	ctx := context.Background()
+
+	if _, err := p.GetAuthCodeURL(ctx, "sid"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := p.Login(ctx, "sid", "state", "mallory@example.com"); err == nil {
+		t.Error("expected error for unknown test user")
+	}
+}
+
+func TestDevProvider_CallbackInvalidCode(t *testing.T) {
+	p := newTestProvider(t)
+
+	state, _ := signIn(t, p, "sid", "bob@example.com")
+	if _, err := p.Callback(context.Background(), "sid", state, "wrong-code"); err == nil {
+		t.Error("expected error for invalid code")
+	}
+}
@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/store"
+	"github.com/schnurbus/go-mcp-gateway/internal/utils"
+)
+
+// FlowStore keeps the state, nonce and PKCE code verifier of pending upstream
+// authorizations, keyed by session id.
+type FlowStore struct {
+	stateStore *store.Store // key: sid, value: state
+	nonceStore *store.Store // key: sid, value: nonce
+	codeStore  *store.Store // key: sid, value: code verifier
+}
+
+// Flow is a pending upstream authorization.
+type Flow struct {
+	State         string
+	Nonce         string
+	CodeVerifier  string
+	CodeChallenge string // S256 challenge of CodeVerifier
+}
+
+// NewFlowStore creates a FlowStore whose keys are namespaced with prefix,
+// e.g. "google" stores state under "google_state".
+func NewFlowStore(rdb *redis.Client, prefix string) *FlowStore {
+	return &FlowStore{
+		stateStore: store.NewStore(rdb, prefix+"_state", store.OAuthStateTTL),
+		nonceStore: store.NewStore(rdb, prefix+"_nonce", store.OAuthStateTTL),
+		codeStore:  store.NewStore(rdb, prefix+"_code", store.OAuthStateTTL),
+	}
+}
+
+// Begin generates and stores a new flow for the session sid.
+func (f *FlowStore) Begin(ctx context.Context, sid string) (*Flow, error) {
+	codeVerifier := utils.RandString(96)
+	hashedCodeVerifier := sha256.Sum256([]byte(codeVerifier))
+	flow := &Flow{
+		State:         utils.RandString(16),
+		Nonce:         utils.RandString(16),
+		CodeVerifier:  codeVerifier,
+		CodeChallenge: base64.RawURLEncoding.EncodeToString(hashedCodeVerifier[:]),
+	}
+
+	if err := f.stateStore.Set(ctx, sid, flow.State); err != nil {
+		return nil, err
+	}
+	if err := f.nonceStore.Set(ctx, sid, flow.Nonce); err != nil {
+		return nil, err
+	}
+	if err := f.codeStore.Set(ctx, sid, flow.CodeVerifier); err != nil {
+		return nil, err
+	}
+
+	return flow, nil
+}
+
+// Complete consumes the flow of the session sid and checks that state
+// matches it. Each flow can be completed once.
+func (f *FlowStore) Complete(ctx context.Context, sid, state string) (*Flow, error) {
+	savedState, err := f.stateStore.GetDel(ctx, sid)
+	if err != nil {
+		return nil, fmt.Errorf("could not get state from store: %w", err)
+	}
+	codeVerifier, err := f.codeStore.GetDel(ctx, sid)
+	if err != nil {
+		return nil, fmt.Errorf("could not get code verifier from store: %w", err)
+	}
+	nonce, err := f.nonceStore.GetDel(ctx, sid)
+	if err != nil {
+		return nil, fmt.Errorf("could not get nonce from store: %w", err)
+	}
+
+	if savedState != state {
+		return nil, fmt.Errorf("invalid state: %s", state)
+	}
+
+	return &Flow{
+		State:        savedState,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+	}, nil
+}
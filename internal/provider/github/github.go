@@ -0,0 +1,222 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider"
+	"golang.org/x/oauth2"
+)
+
+var _ provider.Provider = (*GitHubProvider)(nil)
+
+type GitHubConfig struct {
+	GitHubClientID     string
+	GitHubClientSecret string
+	GitHubRedirectURI  string
+	GitHubScopes       []string
+
+	// GitHubURL and GitHubAPIURL default to github.com. They point the
+	// provider at GitHub Enterprise Server.
+	GitHubURL    string
+	GitHubAPIURL string
+}
+
+// GitHubProvider authenticates users with GitHub's OAuth web flow. GitHub is
+// not an OpenID Connect provider, the user is read from the REST API.
+type GitHubProvider struct {
+	flowStore   *provider.FlowStore
+	oauthConfig *oauth2.Config
+	apiURL      string
+	httpClient  *http.Client
+}
+
+type GitHubUser struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type GitHubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+func NewGitHubProvider(ctx context.Context, config *GitHubConfig, rdb *redis.Client) (*GitHubProvider, error) {
+	githubURL := config.GitHubURL
+	if githubURL == "" {
+		githubURL = "https://github.com"
+	}
+	apiURL := config.GitHubAPIURL
+	if apiURL == "" {
+		apiURL = "https://api.github.com"
+	}
+
+	scopes := config.GitHubScopes
+	if len(scopes) == 0 {
+		scopes = []string{"read:user", "user:email"}
+	}
+
+	return &GitHubProvider{
+		flowStore: provider.NewFlowStore(rdb, "github"),
+		oauthConfig: &oauth2.Config{
+			ClientID:     config.GitHubClientID,
+			ClientSecret: config.GitHubClientSecret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:   githubURL + "/login/oauth/authorize",
+				TokenURL:  githubURL + "/login/oauth/access_token",
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+			Scopes:      scopes,
+			RedirectURL: config.GitHubRedirectURI,
+		},
+		apiURL:     apiURL,
+		httpClient: http.DefaultClient,
+	}, nil
+}
+
+func (p *GitHubProvider) GetAuthCodeURL(ctx context.Context, sid string) (string, error) {
+	flow, err := p.flowStore.Begin(ctx, sid)
+	if err != nil {
+		return "", err
+	}
+
+	return p.oauthConfig.AuthCodeURL(flow.State,
+		oauth2.SetAuthURLParam("code_challenge", flow.CodeChallenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), nil
+}
+
+func (p *GitHubProvider) Callback(ctx context.Context, sid, state, code string) (*provider.AuthResult, error) {
+	flow, err := p.flowStore.Complete(ctx, sid, state)
+	if err != nil {
+		return nil, err
+	}
+
+	oauth2Tok, err := p.oauthConfig.Exchange(
+		ctx,
+		code,
+		oauth2.SetAuthURLParam("code_verifier", flow.CodeVerifier),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	var user GitHubUser
+	if err := p.get(ctx, oauth2Tok.AccessToken, "/user", &user); err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	identity := &provider.Identity{
+		Subject: strconv.FormatInt(user.ID, 10),
+		Name:    user.Login,
+	}
+
+	// The profile email is optional and may be unverified, use the primary
+	// email address instead
+	var emails []GitHubEmail
+	if err := p.get(ctx, oauth2Tok.AccessToken, "/user/emails", &emails); err != nil {
+		return nil, fmt.Errorf("failed to get user emails: %w", err)
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+			break
+		}
+	}
+
+	// Tokens of OAuth apps do not expire
+	var expiry int64
+	if !oauth2Tok.Expiry.IsZero() {
+		expiry = oauth2Tok.Expiry.Unix()
+	}
+
+	return &provider.AuthResult{
+		Identity:     identity,
+		AccessToken:  oauth2Tok.AccessToken,
+		RefreshToken: oauth2Tok.RefreshToken,
+		Expiry:       expiry,
+	}, nil
+}
+
+// RefreshToken refreshes expiring user tokens of GitHub Apps. Tokens of
+// OAuth apps do not expire and come without refresh token.
+func (p *GitHubProvider) RefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	tokenSource := p.oauthConfig.TokenSource(ctx, &oauth2.Token{
+		RefreshToken: refreshToken,
+	})
+
+	newToken, err := tokenSource.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	return newToken, nil
+}
+
+// RevokeToken deletes the user's authorization of the app, which revokes all
+// of its tokens. Refresh tokens cannot be revoked on their own, GitHub
+// invalidates them together with the grant.
+func (p *GitHubProvider) RevokeToken(ctx context.Context, token string) error {
+	log := logger.FromContext(ctx)
+
+	body, err := json.Marshal(map[string]string{"access_token": token})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, p.apiURL+"/applications/"+p.oauthConfig.ClientID+"/grant", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create revoke request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(p.oauthConfig.ClientID, p.oauthConfig.ClientSecret)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// 404 and 422 are returned for tokens GitHub no longer knows
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusNotFound, http.StatusUnprocessableEntity:
+		log.Info("Revoked GitHub grant", "status", resp.StatusCode)
+		return nil
+	}
+
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("unexpected status code from GitHub: %d, body: %s", resp.StatusCode, string(bodyBytes))
+}
+
+func (p *GitHubProvider) get(ctx context.Context, accessToken, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.apiURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code from GitHub: %d, body: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
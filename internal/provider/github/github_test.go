@@ -0,0 +1,174 @@
+package github
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeGitHub is a local stand-in for GitHub's OAuth endpoints and REST API.
+type fakeGitHub struct {
+	mu            sync.Mutex
+	codeChallenge string
+	grants        map[string]bool // access tokens of authorized grants
+}
+
+func newFakeGitHub(t *testing.T) (*fakeGitHub, *httptest.Server) {
+	t.Helper()
+	fake := &fakeGitHub{grants: map[string]bool{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		hash := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("client_secret") != "test-client-secret" || r.FormValue("code") != "github-code" ||
+			base64.RawURLEncoding.EncodeToString(hash[:]) != fake.codeChallenge {
+			json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code"})
+			return
+		}
+		fake.grants["gho_token"] = true
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "gho_token",
+			"token_type":   "bearer",
+			"scope":        "read:user,user:email",
+		})
+	})
+	mux.HandleFunc("GET /api/user", func(w http.ResponseWriter, r *http.Request) {
+		if !fake.authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": 583231, "login": "octocat", "name": "The Octocat", "email": nil})
+	})
+	mux.HandleFunc("GET /api/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		if !fake.authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode([]map[string]any{
+			{"email": "octocat@users.noreply.github.com", "primary": false, "verified": true},
+			{"email": "octocat@github.com", "primary": true, "verified": true},
+		})
+	})
+	mux.HandleFunc("DELETE /api/applications/test-client-id/grant", func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		if id, secret, ok := r.BasicAuth(); !ok || id != "test-client-id" || secret != "test-client-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body struct {
+			AccessToken string `json:"access_token"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if !fake.grants[body.AccessToken] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(fake.grants, body.AccessToken)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func (f *fakeGitHub) authorized(r *http.Request) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return r.Header.Get("Authorization") == "Bearer gho_token" && f.grants["gho_token"]
+}
+
+func newTestProvider(t *testing.T, server *httptest.Server) *GitHubProvider {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	p, err := NewGitHubProvider(context.Background(), &GitHubConfig{
+		GitHubClientID:     "test-client-id",
+		GitHubClientSecret: "test-client-secret",
+		GitHubRedirectURI:  "http://localhost:8080/oauth/callback",
+		GitHubURL:          server.URL,
+		GitHubAPIURL:       server.URL + "/api",
+	}, rdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestGitHubProvider_Flow(t *testing.T) {
+	fake, server := newFakeGitHub(t)
+	p := newTestProvider(t, server)
+	ctx := context.Background()
+
+	authCodeURL, err := p.GetAuthCodeURL(ctx, "sid")
+	if err != nil {
+		t.Fatalf("failed to get auth code url: %v", err)
+	}
+	u, _ := url.Parse(authCodeURL)
+	if u.Query().Get("scope") != "read:user user:email" {
+		t.Errorf("unexpected scope '%s'", u.Query().Get("scope"))
+	}
+	fake.codeChallenge = u.Query().Get("code_challenge")
+
+	result, err := p.Callback(ctx, "sid", u.Query().Get("state"), "github-code")
+	if err != nil {
+		t.Fatalf("callback failed: %v", err)
+	}
+	if result.Identity.Subject != "583231" || result.Identity.Name != "octocat" {
+		t.Errorf("unexpected identity: %+v", result.Identity)
+	}
+	if result.Identity.Email != "octocat@github.com" || !result.Identity.EmailVerified {
+		t.Errorf("expected verified primary email, got %+v", result.Identity)
+	}
+	if result.AccessToken != "gho_token" || result.RefreshToken != "" || result.Expiry != 0 {
+		t.Errorf("unexpected upstream tokens: %+v", result)
+	}
+}
+
+func TestGitHubProvider_CallbackInvalidCode(t *testing.T) {
+	fake, server := newFakeGitHub(t)
+	p := newTestProvider(t, server)
+	ctx := context.Background()
+
+	authCodeURL, _ := p.GetAuthCodeURL(ctx, "sid")
+	u, _ := url.Parse(authCodeURL)
+	fake.codeChallenge = u.Query().Get("code_challenge")
+
+	if _, err := p.Callback(ctx, "sid", u.Query().Get("state"), "wrong-code"); err == nil {
+		t.Error("expected error for invalid code")
+	}
+}
+
+func TestGitHubProvider_RevokeToken(t *testing.T) {
+	fake, server := newFakeGitHub(t)
+	p := newTestProvider(t, server)
+	ctx := context.Background()
+	fake.grants["gho_token"] = true
+
+	if err := p.RevokeToken(ctx, "gho_token"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.grants["gho_token"] {
+		t.Error("expected grant to be revoked")
+	}
+
+	// Revoking an already revoked token succeeds
+	if err := p.RevokeToken(ctx, "gho_token"); err != nil {
+		t.Errorf("expected already revoked token to succeed, got %v", err)
+	}
+}
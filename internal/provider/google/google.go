@@ -2,15 +2,17 @@ package google
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/base64"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/redis/go-redis/v9"
 	"github.com/schnurbus/go-mcp-gateway/internal/logger"
-	"github.com/schnurbus/go-mcp-gateway/internal/store"
-	"github.com/schnurbus/go-mcp-gateway/internal/utils"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider"
 	"golang.org/x/oauth2"
 )
 
@@ -19,20 +21,28 @@ type GoogleConfig struct {
 	GoogleClientSecret string
 	GoogleRedirectURI  string
 	GoogleScopes       []string
+
+	// GoogleHostedDomain is passed as hd hint to preselect Workspace accounts
+	// of the domain, "*" for any Workspace account. It restricts nothing.
+	GoogleHostedDomain string
 }
 
+var _ provider.IncrementalProvider = (*GoogleProvider)(nil)
+
 type GoogleProvider struct {
-	googleStateStore *store.Store // key: sid, value: google state
-	googleNonceStore *store.Store // key: sid, value: google nonce
-	googleCodeStore  *store.Store // key: sid, value: google code
-	oidcConfig       *oauth2.Config
-	verifier         *oidc.IDTokenVerifier
+	flowStore    *provider.FlowStore
+	oidcConfig   *oauth2.Config
+	verifier     *oidc.IDTokenVerifier
+	revokeURL    string
+	hostedDomain string
 }
 
 type GoogleClaims struct {
 	Sub               string   `json:"sub"`
 	Name              string   `json:"name"`
 	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	Hd                string   `json:"hd"`
 	Ver               int      `json:"ver"`
 	Iss               string   `json:"iss"`
 	Aud               string   `json:"aud"`
@@ -47,19 +57,8 @@ type GoogleClaims struct {
 	AtHash            string   `json:"at_hash"`
 }
 
-type GoogleAuthResult struct {
-	Claims       *GoogleClaims
-	AccessToken  string
-	RefreshToken string
-	Expiry       int64 // Unix timestamp
-}
-
 func NewGoogleProvider(ctx context.Context, config *GoogleConfig, rdb *redis.Client) (*GoogleProvider, error) {
-	googleStateStore := store.NewStore(rdb, "google_state", store.OAuthStateTTL)
-	googleNonceStore := store.NewStore(rdb, "google_nonce", store.OAuthStateTTL)
-	googleCodeStore := store.NewStore(rdb, "google_code", store.OAuthStateTTL)
-
-	provider, err := oidc.NewProvider(ctx, "https://accounts.google.com")
+	oidcProvider, err := oidc.NewProvider(ctx, "https://accounts.google.com")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create oidc provider: %w", err)
 	}
@@ -72,75 +71,75 @@ func NewGoogleProvider(ctx context.Context, config *GoogleConfig, rdb *redis.Cli
 	oidcConfig := &oauth2.Config{
 		ClientID:     config.GoogleClientID,
 		ClientSecret: config.GoogleClientSecret,
-		Endpoint:     provider.Endpoint(),
+		Endpoint:     oidcProvider.Endpoint(),
 		Scopes:       scopes,
 		RedirectURL:  config.GoogleRedirectURI,
 	}
 
-	verifier := provider.Verifier(&oidc.Config{ClientID: config.GoogleClientID})
+	verifier := oidcProvider.Verifier(&oidc.Config{ClientID: config.GoogleClientID})
 
 	return &GoogleProvider{
-		googleStateStore: googleStateStore,
-		googleNonceStore: googleNonceStore,
-		googleCodeStore:  googleCodeStore,
-		oidcConfig:       oidcConfig,
-		verifier:         verifier,
+		flowStore:    provider.NewFlowStore(rdb, "google"),
+		oidcConfig:   oidcConfig,
+		verifier:     verifier,
+		revokeURL:    "https://oauth2.googleapis.com/revoke",
+		hostedDomain: config.GoogleHostedDomain,
 	}, nil
 }
 
 func (p *GoogleProvider) GetAuthCodeURL(ctx context.Context, sid string) (string, error) {
-	log := logger.FromContext(ctx)
-	state := utils.RandString(16)
-	nonce := utils.RandString(16)
-	codeVerifier := utils.RandString(96)
-	hashedCodeVerifier := sha256.Sum256([]byte(codeVerifier))
-	codeChallenge := base64.RawURLEncoding.EncodeToString(hashedCodeVerifier[:])
-
-	log.Info("Saving state", "sid", sid, "state", state)
-	if err := p.googleStateStore.Set(ctx, sid, state); err != nil {
-		return "", err
-	}
+	return p.GetIncrementalAuthCodeURL(ctx, sid, nil)
+}
 
-	if err := p.googleNonceStore.Set(ctx, sid, nonce); err != nil {
-		return "", err
-	}
+// GetIncrementalAuthCodeURL requests scopes on top of the configured ones.
+// Google's incremental authorization only asks the user for scopes not
+// granted to the gateway before.
+func (p *GoogleProvider) GetIncrementalAuthCodeURL(ctx context.Context, sid string, scopes []string) (string, error) {
+	log := logger.FromContext(ctx)
 
-	if err := p.googleCodeStore.Set(ctx, sid, codeVerifier); err != nil {
+	flow, err := p.flowStore.Begin(ctx, sid)
+	if err != nil {
 		return "", err
 	}
+	log.Info("Saved state", "sid", sid, "state", flow.State)
 
-	return p.oidcConfig.AuthCodeURL(state,
-		oidc.Nonce(nonce),
-		oauth2.SetAuthURLParam("code_challenge", codeChallenge),
+	opts := []oauth2.AuthCodeOption{
+		oidc.Nonce(flow.Nonce),
+		oauth2.SetAuthURLParam("code_challenge", flow.CodeChallenge),
 		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
 		oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("include_granted_scopes", "true"),
 		// oauth2.ApprovalForce,
-	), nil
+	}
+	if p.hostedDomain != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("hd", p.hostedDomain))
+	}
+	if len(scopes) > 0 {
+		requested := slices.Clone(p.oidcConfig.Scopes)
+		for _, scope := range scopes {
+			if !slices.Contains(requested, scope) {
+				requested = append(requested, scope)
+			}
+		}
+		opts = append(opts, oauth2.SetAuthURLParam("scope", strings.Join(requested, " ")))
+	}
+
+	return p.oidcConfig.AuthCodeURL(flow.State, opts...), nil
 }
 
-func (p *GoogleProvider) Callback(ctx context.Context, sid, state, code string) (*GoogleAuthResult, error) {
+func (p *GoogleProvider) Callback(ctx context.Context, sid, state, code string) (*provider.AuthResult, error) {
 	log := logger.FromContext(ctx)
 
-	savedState, err := p.googleStateStore.GetDel(ctx, sid)
-	if err != nil {
-		log.Error("could not get state from store", "sid", sid)
-		return nil, err
-	}
-
-	codeVerifier, err := p.googleCodeStore.GetDel(ctx, sid)
+	flow, err := p.flowStore.Complete(ctx, sid, state)
 	if err != nil {
-		log.Error("could not get code from store", "sid", sid)
+		log.Error("could not complete flow", "sid", sid, "error", err)
 		return nil, err
 	}
 
-	if savedState != state {
-		return nil, fmt.Errorf("invalid state: %s", savedState)
-	}
-
 	oauth2Tok, err := p.oidcConfig.Exchange(
 		ctx,
 		code,
-		oauth2.SetAuthURLParam("code_verifier", codeVerifier),
+		oauth2.SetAuthURLParam("code_verifier", flow.CodeVerifier),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange code: %w", err)
@@ -161,24 +160,29 @@ func (p *GoogleProvider) Callback(ctx context.Context, sid, state, code string)
 		return nil, fmt.Errorf("failed to parse claims: %w", err)
 	}
 
-	nonce, err := p.googleNonceStore.GetDel(ctx, sid)
-	if err != nil {
-		return nil, err
-	}
-
-	if claims.Nonce != nonce {
+	if claims.Nonce != flow.Nonce {
 		return nil, fmt.Errorf("invalid nonce: %s", claims.Nonce)
 	}
 
-	return &GoogleAuthResult{
-		Claims:       &claims,
+	// With incremental authorization the scopes of earlier grants are included
+	scope, _ := oauth2Tok.Extra("scope").(string)
+
+	return &provider.AuthResult{
+		Identity: &provider.Identity{
+			Subject:       claims.Sub,
+			Email:         claims.Email,
+			EmailVerified: claims.EmailVerified,
+			Name:          claims.Name,
+			HostedDomain:  claims.Hd,
+		},
 		AccessToken:  oauth2Tok.AccessToken,
 		RefreshToken: oauth2Tok.RefreshToken,
 		Expiry:       oauth2Tok.Expiry.Unix(),
+		Scopes:       strings.Fields(scope),
 	}, nil
 }
 
-func (p *GoogleProvider) RefreshToken(ctx context.Context, refreshToken string) (string, int64, error) {
+func (p *GoogleProvider) RefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
 	log := logger.FromContext(ctx)
 
 	tokenSource := p.oidcConfig.TokenSource(ctx, &oauth2.Token{
@@ -188,9 +192,36 @@ func (p *GoogleProvider) RefreshToken(ctx context.Context, refreshToken string)
 	newToken, err := tokenSource.Token()
 	if err != nil {
 		log.Error("failed to refresh token", "error", err)
-		return "", 0, fmt.Errorf("failed to refresh token: %w", err)
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
 	}
 
 	log.Info("Successfully refreshed Google token")
-	return newToken.AccessToken, newToken.Expiry.Unix(), nil
+	return newToken, nil
+}
+
+// RevokeToken revokes a Google access or refresh token. Revoking a refresh
+// token also invalidates all access tokens of the same grant. Tokens Google
+// no longer knows are treated as revoked.
+func (p *GoogleProvider) RevokeToken(ctx context.Context, token string) error {
+	log := logger.FromContext(ctx)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.revokeURL, strings.NewReader(url.Values{"token": {token}}.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create revoke request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusBadRequest {
+		log.Info("Revoked Google token", "status", resp.StatusCode)
+		return nil
+	}
+
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("unexpected status code from Google: %d, body: %s", resp.StatusCode, string(bodyBytes))
 }
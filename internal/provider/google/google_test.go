@@ -0,0 +1,165 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider"
+	"golang.org/x/oauth2"
+)
+
+// fakeGoogle is a local stand-in for Google's token and revocation endpoints.
+type fakeGoogle struct {
+	mu            sync.Mutex
+	refreshTokens map[string]bool
+	revokeStatus  int
+}
+
+func newFakeGoogle(t *testing.T) (*fakeGoogle, *httptest.Server) {
+	t.Helper()
+	fake := &fakeGoogle{
+		refreshTokens: map[string]bool{"refresh-token": true},
+		revokeStatus:  http.StatusOK,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("grant_type") != "refresh_token" || !fake.refreshTokens[r.FormValue("refresh_token")] {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "new-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3599,
+		})
+	})
+	mux.HandleFunc("POST /revoke", func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		if fake.revokeStatus != http.StatusOK {
+			w.WriteHeader(fake.revokeStatus)
+			return
+		}
+		if !fake.refreshTokens[r.FormValue("token")] {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_token"})
+			return
+		}
+		delete(fake.refreshTokens, r.FormValue("token"))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func newTestProvider(server *httptest.Server) *GoogleProvider {
+	return &GoogleProvider{
+		oidcConfig: &oauth2.Config{
+			ClientID:     "test-client-id",
+			ClientSecret: "test-client-secret",
+			Endpoint: oauth2.Endpoint{
+				TokenURL:  server.URL + "/token",
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+		},
+		revokeURL: server.URL + "/revoke",
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	_, server := newFakeGoogle(t)
+	p := newTestProvider(server)
+
+	token, err := p.RefreshToken(context.Background(), "refresh-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token.AccessToken != "new-access-token" {
+		t.Errorf("expected 'new-access-token', got '%s'", token.AccessToken)
+	}
+	if token.Expiry.IsZero() {
+		t.Error("expected expiry to be set")
+	}
+	// Google keeps the refresh token
+	if token.RefreshToken != "refresh-token" {
+		t.Errorf("expected 'refresh-token', got '%s'", token.RefreshToken)
+	}
+
+	if _, err := p.RefreshToken(context.Background(), "unknown-refresh-token"); err == nil {
+		t.Error("expected error for unknown refresh token")
+	}
+}
+
+func TestGetIncrementalAuthCodeURL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	p := &GoogleProvider{
+		flowStore: provider.NewFlowStore(rdb, "google"),
+		oidcConfig: &oauth2.Config{
+			ClientID: "test-client-id",
+			Endpoint: oauth2.Endpoint{AuthURL: "https://accounts.google.com/o/oauth2/v2/auth"},
+			Scopes:   []string{"openid", "email"},
+		},
+	}
+
+	authURL, err := p.GetIncrementalAuthCodeURL(context.Background(), "sid", []string{"email", "drive.readonly"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("failed to parse auth URL: %v", err)
+	}
+	if got := u.Query().Get("scope"); got != "openid email drive.readonly" {
+		t.Errorf("expected 'openid email drive.readonly', got '%s'", got)
+	}
+	if got := u.Query().Get("include_granted_scopes"); got != "true" {
+		t.Errorf("expected include_granted_scopes 'true', got '%s'", got)
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	fake, server := newFakeGoogle(t)
+	p := newTestProvider(server)
+	ctx := context.Background()
+
+	if err := p.RevokeToken(ctx, "refresh-token"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.refreshTokens["refresh-token"] {
+		t.Error("refresh token should be revoked at Google")
+	}
+	if _, err := p.RefreshToken(ctx, "refresh-token"); err == nil {
+		t.Error("revoked refresh token should not refresh")
+	}
+
+	// Revoking an already revoked token succeeds
+	if err := p.RevokeToken(ctx, "refresh-token"); err != nil {
+		t.Errorf("expected already revoked token to succeed, got %v", err)
+	}
+}
+
+func TestRevokeToken_Unavailable(t *testing.T) {
+	fake, server := newFakeGoogle(t)
+	fake.revokeStatus = http.StatusServiceUnavailable
+	p := newTestProvider(server)
+
+	if err := p.RevokeToken(context.Background(), "refresh-token"); err == nil {
+		t.Error("expected error when Google is unavailable")
+	}
+}
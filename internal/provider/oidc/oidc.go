@@ -0,0 +1,271 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider"
+	"golang.org/x/oauth2"
+)
+
+var _ provider.Provider = (*OIDCProvider)(nil)
+
+// ClaimMapping names the ID token claims the user identity is read from.
+// Empty names fall back to the standard OIDC claims.
+type ClaimMapping struct {
+	Subject       string
+	Email         string
+	EmailVerified string
+	Name          string
+}
+
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	Scopes       []string
+	Claims       ClaimMapping
+}
+
+// OIDCProvider authenticates users with any OpenID Connect provider that
+// supports discovery, e.g. Keycloak, Okta, Entra ID or Authentik.
+type OIDCProvider struct {
+	flowStore  *provider.FlowStore
+	oidcConfig *oauth2.Config
+	verifier   *gooidc.IDTokenVerifier
+	claims     ClaimMapping
+	revokeURL  string // empty if the provider does not support revocation
+	revokeAuth string // client authentication method at the revocation endpoint
+}
+
+// providerMetadata are discovery fields go-oidc does not expose.
+type providerMetadata struct {
+	RevocationEndpoint                     string   `json:"revocation_endpoint"`
+	RevocationEndpointAuthMethodsSupported []string `json:"revocation_endpoint_auth_methods_supported"`
+	TokenEndpointAuthMethodsSupported      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// revocationAuthMethod picks one client authentication method supported by
+// the revocation endpoint. RFC 8414 defaults to client_secret_basic, clients
+// without secret only identify themselves.
+func (m *providerMetadata) revocationAuthMethod(clientSecret string) string {
+	if clientSecret == "" {
+		return "none"
+	}
+	methods := m.RevocationEndpointAuthMethodsSupported
+	if len(methods) == 0 {
+		methods = m.TokenEndpointAuthMethodsSupported
+	}
+	if len(methods) > 0 && !slices.Contains(methods, "client_secret_basic") && slices.Contains(methods, "client_secret_post") {
+		return "client_secret_post"
+	}
+	return "client_secret_basic"
+}
+
+func NewOIDCProvider(ctx context.Context, config *OIDCConfig, rdb *redis.Client) (*OIDCProvider, error) {
+	oidcProvider, err := gooidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create oidc provider: %w", err)
+	}
+
+	var metadata providerMetadata
+	if err := oidcProvider.Claims(&metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse provider metadata: %w", err)
+	}
+
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{gooidc.ScopeOpenID, "profile", "email"}
+	}
+
+	claims := config.Claims
+	if claims.Subject == "" {
+		claims.Subject = "sub"
+	}
+	if claims.Email == "" {
+		claims.Email = "email"
+	}
+	if claims.EmailVerified == "" {
+		claims.EmailVerified = "email_verified"
+	}
+	if claims.Name == "" {
+		claims.Name = "name"
+	}
+
+	return &OIDCProvider{
+		flowStore: provider.NewFlowStore(rdb, "oidc"),
+		oidcConfig: &oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Endpoint:     oidcProvider.Endpoint(),
+			Scopes:       scopes,
+			RedirectURL:  config.RedirectURI,
+		},
+		verifier:   oidcProvider.Verifier(&gooidc.Config{ClientID: config.ClientID}),
+		claims:     claims,
+		revokeURL:  metadata.RevocationEndpoint,
+		revokeAuth: metadata.revocationAuthMethod(config.ClientSecret),
+	}, nil
+}
+
+func (p *OIDCProvider) GetAuthCodeURL(ctx context.Context, sid string) (string, error) {
+	flow, err := p.flowStore.Begin(ctx, sid)
+	if err != nil {
+		return "", err
+	}
+
+	return p.oidcConfig.AuthCodeURL(flow.State,
+		gooidc.Nonce(flow.Nonce),
+		oauth2.SetAuthURLParam("code_challenge", flow.CodeChallenge),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), nil
+}
+
+func (p *OIDCProvider) Callback(ctx context.Context, sid, state, code string) (*provider.AuthResult, error) {
+	flow, err := p.flowStore.Complete(ctx, sid, state)
+	if err != nil {
+		return nil, err
+	}
+
+	oauth2Tok, err := p.oidcConfig.Exchange(
+		ctx,
+		code,
+		oauth2.SetAuthURLParam("code_verifier", flow.CodeVerifier),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	rawIDToken, ok := oauth2Tok.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("failed to get id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify id_token: %w", err)
+	}
+	if idToken.Nonce != flow.Nonce {
+		return nil, fmt.Errorf("invalid nonce: %s", idToken.Nonce)
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to parse claims: %w", err)
+	}
+
+	identity := &provider.Identity{
+		Subject:       stringClaim(claims, p.claims.Subject),
+		Email:         stringClaim(claims, p.claims.Email),
+		EmailVerified: boolClaim(claims, p.claims.EmailVerified),
+		Name:          stringClaim(claims, p.claims.Name),
+	}
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("missing subject claim: %s", p.claims.Subject)
+	}
+
+	return &provider.AuthResult{
+		Identity:     identity,
+		AccessToken:  oauth2Tok.AccessToken,
+		RefreshToken: oauth2Tok.RefreshToken,
+		Expiry:       oauth2Tok.Expiry.Unix(),
+	}, nil
+}
+
+func (p *OIDCProvider) RefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	tokenSource := p.oidcConfig.TokenSource(ctx, &oauth2.Token{
+		RefreshToken: refreshToken,
+	})
+
+	newToken, err := tokenSource.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	return newToken, nil
+}
+
+// RevokeToken revokes a token at the RFC 7009 revocation endpoint advertised
+// in the provider's discovery document. Providers without one keep their
+// tokens until they expire.
+func (p *OIDCProvider) RevokeToken(ctx context.Context, token string) error {
+	log := logger.FromContext(ctx)
+
+	if p.revokeURL == "" {
+		log.Warn("Upstream provider does not support token revocation")
+		return nil
+	}
+
+	form := url.Values{"token": {token}}
+	switch p.revokeAuth {
+	case "client_secret_post":
+		form.Set("client_id", p.oidcConfig.ClientID)
+		form.Set("client_secret", p.oidcConfig.ClientSecret)
+	case "none":
+		form.Set("client_id", p.oidcConfig.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.revokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create revoke request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.revokeAuth == "client_secret_basic" {
+		req.SetBasicAuth(url.QueryEscape(p.oidcConfig.ClientID), url.QueryEscape(p.oidcConfig.ClientSecret))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		log.Info("Revoked upstream token")
+		return nil
+	}
+
+	bodyBytes, _ := io.ReadAll(resp.Body)
+	// Tokens of a type the provider cannot revoke expire on their own
+	var revokeErr struct {
+		Error string `json:"error"`
+	}
+	if resp.StatusCode == http.StatusBadRequest && json.Unmarshal(bodyBytes, &revokeErr) == nil && revokeErr.Error == "unsupported_token_type" {
+		log.Warn("Upstream provider cannot revoke the token type")
+		return nil
+	}
+	return fmt.Errorf("unexpected status code from revocation endpoint: %d, body: %s", resp.StatusCode, string(bodyBytes))
+}
+
+func stringClaim(claims map[string]any, name string) string {
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	default:
+		return ""
+	}
+}
+
+// boolClaim reads a boolean claim. Some providers send email_verified as a
+// string.
+func boolClaim(claims map[string]any, name string) bool {
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
+		return false
+	}
+}
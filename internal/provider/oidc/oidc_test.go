@@ -0,0 +1,276 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeIssuer is a local OpenID Connect provider. It issues a single code for
+// the last authorization request it saw.
+type fakeIssuer struct {
+	t             *testing.T
+	server        *httptest.Server
+	key           *rsa.PrivateKey
+	mu            sync.Mutex
+	codeChallenge string
+	nonce         string
+	authMethods   []string // token_endpoint_auth_methods_supported
+	revoked       []string
+	revokeAuth    []string // client authentication of each revocation
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeIssuer{t: t, key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                f.server.URL,
+			"authorization_endpoint":                f.server.URL + "/authorize",
+			"token_endpoint":                        f.server.URL + "/token",
+			"jwks_uri":                              f.server.URL + "/jwks",
+			"revocation_endpoint":                   f.server.URL + "/revoke",
+			"token_endpoint_auth_methods_supported": f.authMethods,
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &f.key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("POST /token", f.handleToken)
+	mux.HandleFunc("POST /revoke", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.revoked = append(f.revoked, r.FormValue("token"))
+
+		var auth []string
+		if id, secret, ok := r.BasicAuth(); ok {
+			auth = append(auth, "basic:"+id+":"+secret)
+		}
+		if r.PostFormValue("client_id") != "" {
+			auth = append(auth, "post:"+r.PostFormValue("client_id")+":"+r.PostFormValue("client_secret"))
+		}
+		f.revokeAuth = append(f.revokeAuth, strings.Join(auth, ","))
+
+		switch r.FormValue("token") {
+		case "access-token-only":
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "unsupported_token_type"})
+		case "unknown-client":
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		}
+	})
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeIssuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	hash := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if r.FormValue("code") != "upstream-code" || base64.RawURLEncoding.EncodeToString(hash[:]) != f.codeChallenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: f.key, KeyID: "test"}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	idToken, err := jwt.Signed(signer).Claims(map[string]any{
+		"iss":                f.server.URL,
+		"sub":                "f81d4fae",
+		"aud":                "gateway",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              f.nonce,
+		"preferred_username": "jdoe",
+		"email":              "jdoe@example.com",
+		"email_verified":     "true",
+	}).Serialize()
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token":  "upstream-access-token",
+		"refresh_token": "upstream-refresh-token",
+		"token_type":    "Bearer",
+		"expires_in":    300,
+		"id_token":      idToken,
+	})
+}
+
+func newTestProvider(t *testing.T, issuer *fakeIssuer) *OIDCProvider {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	p, err := NewOIDCProvider(context.Background(), &OIDCConfig{
+		Issuer:       issuer.server.URL,
+		ClientID:     "gateway",
+		ClientSecret: "secret",
+		RedirectURI:  "http://localhost:8080/oauth/callback",
+		Claims:       ClaimMapping{Name: "preferred_username"},
+	}, rdb)
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	return p
+}
+
+func TestOIDCProvider_Flow(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	p := newTestProvider(t, issuer)
+	ctx := context.Background()
+
+	authCodeURL, err := p.GetAuthCodeURL(ctx, "sid")
+	if err != nil {
+		t.Fatalf("failed to get auth code url: %v", err)
+	}
+	u, err := url.Parse(authCodeURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Query().Get("code_challenge_method") != "S256" {
+		t.Errorf("expected PKCE S256, got '%s'", u.Query().Get("code_challenge_method"))
+	}
+	issuer.codeChallenge = u.Query().Get("code_challenge")
+	issuer.nonce = u.Query().Get("nonce")
+
+	if _, err := p.Callback(ctx, "sid", "wrong-state", "upstream-code"); err == nil {
+		t.Fatal("expected error for wrong state")
+	}
+
+	// The failed attempt consumed the flow
+	authCodeURL, _ = p.GetAuthCodeURL(ctx, "sid")
+	u, _ = url.Parse(authCodeURL)
+	issuer.codeChallenge = u.Query().Get("code_challenge")
+	issuer.nonce = u.Query().Get("nonce")
+
+	result, err := p.Callback(ctx, "sid", u.Query().Get("state"), "upstream-code")
+	if err != nil {
+		t.Fatalf("callback failed: %v", err)
+	}
+	if result.Identity.Subject != "f81d4fae" || result.Identity.Email != "jdoe@example.com" || result.Identity.Name != "jdoe" {
+		t.Errorf("unexpected identity: %+v", result.Identity)
+	}
+	if !result.Identity.EmailVerified {
+		t.Error("expected email to be verified")
+	}
+	if result.AccessToken != "upstream-access-token" || result.RefreshToken != "upstream-refresh-token" {
+		t.Errorf("unexpected upstream tokens: %+v", result)
+	}
+
+	if _, err := p.Callback(ctx, "sid", u.Query().Get("state"), "upstream-code"); err == nil {
+		t.Error("expected flow to be single use")
+	}
+}
+
+func TestOIDCProvider_RevokeToken(t *testing.T) {
+	testCases := []struct {
+		name         string
+		authMethods  []string
+		clientSecret string
+		token        string
+		expectedAuth string
+		expectError  bool
+	}{
+		{
+			name:         "basic by default",
+			clientSecret: "secret",
+			token:        "upstream-refresh-token",
+			expectedAuth: "basic:gateway:secret",
+		},
+		{
+			name:         "post if basic is not supported",
+			authMethods:  []string{"client_secret_post", "private_key_jwt"},
+			clientSecret: "secret",
+			token:        "upstream-refresh-token",
+			expectedAuth: "post:gateway:secret",
+		},
+		{
+			name:         "public client",
+			token:        "upstream-refresh-token",
+			expectedAuth: "post:gateway:",
+		},
+		{
+			name:         "unsupported token type",
+			clientSecret: "secret",
+			token:        "access-token-only",
+			expectedAuth: "basic:gateway:secret",
+		},
+		{
+			name:         "other errors",
+			clientSecret: "secret",
+			token:        "unknown-client",
+			expectedAuth: "basic:gateway:secret",
+			expectError:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			issuer := newFakeIssuer(t)
+			issuer.authMethods = tc.authMethods
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { rdb.Close() })
+			p, err := NewOIDCProvider(context.Background(), &OIDCConfig{
+				Issuer:       issuer.server.URL,
+				ClientID:     "gateway",
+				ClientSecret: tc.clientSecret,
+			}, rdb)
+			if err != nil {
+				t.Fatalf("failed to create provider: %v", err)
+			}
+
+			err = p.RevokeToken(context.Background(), tc.token)
+			if tc.expectError && err == nil {
+				t.Error("expected error")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if len(issuer.revoked) != 1 || issuer.revoked[0] != tc.token {
+				t.Errorf("expected token to be revoked upstream, got %v", issuer.revoked)
+			}
+			if len(issuer.revokeAuth) != 1 || issuer.revokeAuth[0] != tc.expectedAuth {
+				t.Errorf("expected client authentication %q, got %v", tc.expectedAuth, issuer.revokeAuth)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrAccessDenied is returned for identities the sign-in policy rejects.
+var ErrAccessDenied = errors.New("access denied")
+
+// SignInPolicy restricts which identities authenticated by an upstream
+// provider may sign in to the gateway. If any allow list is set, an identity
+// has to match at least one of them. Empty lists do not restrict anything.
+type SignInPolicy struct {
+	HostedDomains        []string // Google Workspace domains, only Google identities have one
+	EmailDomains         []string
+	AllowedEmails        []string
+	DeniedEmails         []string // denied even if allowed otherwise
+	RequireEmailVerified bool
+}
+
+// Check returns an error wrapping ErrAccessDenied if identity may not sign in.
+func (p *SignInPolicy) Check(identity *Identity) error {
+	email := identity.Email
+
+	if containsFold(p.DeniedEmails, email) {
+		return fmt.Errorf("%w: email %s is denied", ErrAccessDenied, email)
+	}
+	if p.RequireEmailVerified && !identity.EmailVerified {
+		return fmt.Errorf("%w: email %s is not verified", ErrAccessDenied, email)
+	}
+
+	if len(p.HostedDomains) == 0 && len(p.EmailDomains) == 0 && len(p.AllowedEmails) == 0 {
+		return nil
+	}
+	if identity.HostedDomain != "" && containsFold(p.HostedDomains, identity.HostedDomain) {
+		return nil
+	}
+	if _, domain, ok := strings.Cut(email, "@"); ok && containsFold(p.EmailDomains, domain) {
+		return nil
+	}
+	if email != "" && containsFold(p.AllowedEmails, email) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: email %s with hosted domain %q is not allowed", ErrAccessDenied, email, identity.HostedDomain)
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(v string) bool {
+		return strings.EqualFold(v, s)
+	})
+}
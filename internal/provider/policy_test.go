@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSignInPolicy(t *testing.T) {
+	workspace := &SignInPolicy{
+		HostedDomains:        []string{"example.com"},
+		AllowedEmails:        []string{"contractor@gmail.com"},
+		DeniedEmails:         []string{"mallory@example.com"},
+		RequireEmailVerified: true,
+	}
+	allowlist := &SignInPolicy{
+		AllowedEmails: []string{"alice@example.com"},
+	}
+	emailDomains := &SignInPolicy{
+		EmailDomains: []string{"example.com", "contractors.example"},
+	}
+
+	union := &SignInPolicy{
+		HostedDomains: []string{"example.com"},
+		EmailDomains:  []string{"contractors.example"},
+	}
+
+	tests := []struct {
+		name     string
+		policy   *SignInPolicy
+		identity Identity
+		allowed  bool
+	}{
+		{"no restrictions", &SignInPolicy{}, Identity{Email: "anyone@gmail.com"}, true},
+		{"hosted domain", workspace, Identity{Email: "jane@example.com", EmailVerified: true, HostedDomain: "EXAMPLE.com"}, true},
+		{"other hosted domain", workspace, Identity{Email: "jane@other.example", EmailVerified: true, HostedDomain: "other.example"}, false},
+		{"consumer account", workspace, Identity{Email: "jane@gmail.com", EmailVerified: true}, false},
+		{"allowed email", workspace, Identity{Email: "Contractor@gmail.com", EmailVerified: true}, true},
+		{"denied email", workspace, Identity{Email: "mallory@example.com", EmailVerified: true, HostedDomain: "example.com"}, false},
+		{"unverified email", workspace, Identity{Email: "contractor@gmail.com"}, false},
+		{"allowlist only", allowlist, Identity{Email: "alice@example.com"}, true},
+		{"not on allowlist", allowlist, Identity{Email: "bob@example.com"}, false},
+		{"email domain", emailDomains, Identity{Email: "bob@contractors.example"}, true},
+		{"other email domain", emailDomains, Identity{Email: "bob@gmail.com"}, false},
+		{"no email", emailDomains, Identity{}, false},
+		{"hosted domain or email domain", union, Identity{Email: "bob@contractors.example"}, true},
+		{"hosted domain or email domain, other", union, Identity{Email: "bob@gmail.com", HostedDomain: "other.example"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(&tt.identity)
+			if tt.allowed && err != nil {
+				t.Errorf("expected identity to be allowed, got %v", err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrAccessDenied) {
+				t.Errorf("expected ErrAccessDenied, got %v", err)
+			}
+		})
+	}
+}
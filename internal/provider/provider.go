@@ -0,0 +1,57 @@
+package provider
+
+import (
+	"context"
+
+	"golang.org/x/oauth2"
+)
+
+// Identity is the user an upstream identity provider authenticated.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	HostedDomain  string // Google Workspace domain, empty for other providers
+}
+
+// AuthResult is the outcome of a completed upstream authorization.
+type AuthResult struct {
+	Identity     *Identity
+	AccessToken  string
+	RefreshToken string
+	Expiry       int64    // Unix timestamp
+	Scopes       []string // granted scopes, empty if the provider does not tell
+}
+
+// Provider is an upstream identity provider the gateway delegates user
+// authentication to. The upstream tokens are kept server-side and mapped to
+// the gateway's own tokens.
+type Provider interface {
+	// GetAuthCodeURL starts an authorization for the session sid and returns
+	// the URL the user is redirected to.
+	GetAuthCodeURL(ctx context.Context, sid string) (string, error)
+
+	// Callback completes the authorization of the session sid.
+	Callback(ctx context.Context, sid, state, code string) (*AuthResult, error)
+
+	// RefreshToken exchanges an upstream refresh token for a new upstream
+	// access token. The token carries the refresh token to use next time,
+	// which providers rotating refresh tokens replace.
+	RefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error)
+
+	// RevokeToken revokes an upstream access or refresh token. Tokens the
+	// provider no longer knows are treated as revoked.
+	RevokeToken(ctx context.Context, token string) error
+}
+
+// IncrementalProvider is a Provider that can request scopes on top of its
+// configured ones. The user is only asked for scopes not granted before, and
+// the resulting tokens carry all scopes granted so far.
+type IncrementalProvider interface {
+	Provider
+
+	// GetIncrementalAuthCodeURL is GetAuthCodeURL requesting scopes in
+	// addition to the configured ones.
+	GetIncrementalAuthCodeURL(ctx context.Context, sid string, scopes []string) (string, error)
+}
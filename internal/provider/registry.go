@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrInvalidGrant is returned for upstream refresh tokens the provider
+// rejects, e.g. because the user revoked the grant.
+var ErrInvalidGrant = errors.New("invalid upstream grant")
+
+// Registry holds the configured upstream providers by name.
+type Registry struct {
+	names     []string
+	providers map[string]Provider
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		providers: make(map[string]Provider),
+	}
+}
+
+// Register adds the provider p called name.
+func (r *Registry) Register(name string, p Provider) {
+	r.names = append(r.names, name)
+	r.providers[name] = p
+}
+
+// Names returns the names of the providers in the order they were registered.
+func (r *Registry) Names() []string {
+	return r.names
+}
+
+// Get returns the provider called name.
+func (r *Registry) Get(name string) (Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("provider is not configured: %s", name)
+	}
+	return p, nil
+}
+
+// RefreshToken refreshes an upstream access token at the provider called
+// name. Refresh tokens the provider rejects with invalid_grant yield an error
+// wrapping ErrInvalidGrant, other errors, like a misconfigured client or rate
+// limiting, leave the grant alone.
+func (r *Registry) RefreshToken(ctx context.Context, name, refreshToken string) (*oauth2.Token, error) {
+	p, err := r.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGrant, err)
+	}
+
+	token, err := p.RefreshToken(ctx, refreshToken)
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) && retrieveErr.Response != nil &&
+			retrieveErr.Response.StatusCode == http.StatusBadRequest && retrieveErr.ErrorCode == "invalid_grant" {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidGrant, err)
+		}
+		return nil, err
+	}
+	return token, nil
+}
@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// refreshErrorProvider fails every refresh with err.
+type refreshErrorProvider struct {
+	Provider
+	err error
+}
+
+func (p *refreshErrorProvider) RefreshToken(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	return nil, p.err
+}
+
+func TestRegistry_RefreshToken(t *testing.T) {
+	retrieveError := func(status int, code string) error {
+		return &oauth2.RetrieveError{Response: &http.Response{StatusCode: status}, ErrorCode: code}
+	}
+
+	testCases := []struct {
+		name         string
+		err          error
+		invalidGrant bool
+	}{
+		{name: "invalid_grant", err: retrieveError(http.StatusBadRequest, "invalid_grant"), invalidGrant: true},
+		{name: "invalid_client", err: retrieveError(http.StatusUnauthorized, "invalid_client")},
+		{name: "invalid_client with 400", err: retrieveError(http.StatusBadRequest, "invalid_client")},
+		{name: "rate limited", err: retrieveError(http.StatusTooManyRequests, "")},
+		{name: "server error", err: retrieveError(http.StatusInternalServerError, "")},
+		{name: "network error", err: errors.New("connection refused")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRegistry()
+			r.Register("oidc", &refreshErrorProvider{err: tc.err})
+
+			_, err := r.RefreshToken(context.Background(), "oidc", "refresh-token")
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if errors.Is(err, ErrInvalidGrant) != tc.invalidGrant {
+				t.Errorf("expected ErrInvalidGrant %v, got %v", tc.invalidGrant, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"slices"
+	"strings"
+)
+
+// Router picks the upstream provider of an authorization request when several
+// providers are configured.
+type Router struct {
+	providers []string
+	domains   map[string]string // key: email domain, value: provider
+	clients   map[string]string // key: client_id, value: provider
+}
+
+// RouteRequest carries the hints of an authorization request.
+type RouteRequest struct {
+	ClientID   string
+	LoginHint  string // OIDC login_hint, used if it is an email address
+	DomainHint string
+	Remembered string // provider the user signed in with before
+}
+
+// NewRouter creates a Router for providers, in the order they are offered to
+// the user. Domains maps email domains and clients maps client ids to the
+// provider used for them.
+func NewRouter(providers []string, domains, clients map[string]string) *Router {
+	lowerDomains := make(map[string]string, len(domains))
+	for domain, p := range domains {
+		lowerDomains[strings.ToLower(domain)] = p
+	}
+
+	return &Router{
+		providers: providers,
+		domains:   lowerDomains,
+		clients:   clients,
+	}
+}
+
+// Providers returns the configured providers. The first one is the default.
+func (r *Router) Providers() []string {
+	return r.providers
+}
+
+// IsProvider reports whether name is a configured provider.
+func (r *Router) IsProvider(name string) bool {
+	return slices.Contains(r.providers, name)
+}
+
+// Route returns the provider of an authorization request, or an empty string
+// if the user has to choose. The domain of the login hint or the domain hint
+// wins over the provider the user signed in with before, which wins over the
+// default of the client.
+func (r *Router) Route(req *RouteRequest) string {
+	if len(r.providers) == 1 {
+		return r.providers[0]
+	}
+
+	if _, domain, ok := strings.Cut(req.LoginHint, "@"); ok {
+		if p, ok := r.domains[strings.ToLower(domain)]; ok {
+			return p
+		}
+	}
+	if p, ok := r.domains[strings.ToLower(req.DomainHint)]; ok {
+		return p
+	}
+	if r.IsProvider(req.Remembered) {
+		return req.Remembered
+	}
+	if p, ok := r.clients[req.ClientID]; ok {
+		return p
+	}
+
+	return ""
+}
@@ -0,0 +1,41 @@
+package provider
+
+import "testing"
+
+func TestRoute(t *testing.T) {
+	r := NewRouter(
+		[]string{"google", "github"},
+		map[string]string{"Example.com": "google", "contractor.example": "github"},
+		map[string]string{"cli-client": "github"},
+	)
+
+	tests := []struct {
+		name string
+		req  RouteRequest
+		want string
+	}{
+		{"no hints", RouteRequest{}, ""},
+		{"login hint", RouteRequest{LoginHint: "jane@EXAMPLE.com", Remembered: "github"}, "google"},
+		{"login hint unknown domain", RouteRequest{LoginHint: "jane@other.example"}, ""},
+		{"login hint without email", RouteRequest{LoginHint: "jane"}, ""},
+		{"domain hint", RouteRequest{DomainHint: "contractor.example"}, "github"},
+		{"remembered", RouteRequest{Remembered: "google", ClientID: "cli-client"}, "google"},
+		{"remembered unknown provider", RouteRequest{Remembered: "oidc"}, ""},
+		{"client default", RouteRequest{ClientID: "cli-client"}, "github"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Route(&tt.req); got != tt.want {
+				t.Errorf("expected '%s', got '%s'", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRoute_SingleProvider(t *testing.T) {
+	r := NewRouter([]string{"github"}, map[string]string{"example.com": "google"}, nil)
+
+	if got := r.Route(&RouteRequest{LoginHint: "jane@example.com"}); got != "github" {
+		t.Errorf("expected the only provider, got '%s'", got)
+	}
+}
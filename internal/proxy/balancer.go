@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+)
+
+var ErrNoHealthyTarget = errors.New("no healthy target")
+
+// BalancerConfig configures how the requests of a route are spread over the
+// replicas of its MCP server.
+type BalancerConfig struct {
+	// Targets are the URLs of the replicas.
+	Targets []*url.URL
+
+	// Policy is config.LoadBalancingRoundRobin or
+	// config.LoadBalancingLeastConnections.
+	Policy string
+
+	// HealthCheck probes the targets. Nil considers all targets healthy.
+	HealthCheck *config.HealthCheckConfig
+
+	// Client sends the health checks. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Balancer picks the target of each request among the healthy targets.
+type Balancer struct {
+	targets     []*target
+	policy      string
+	next        atomic.Uint64
+	healthCheck *config.HealthCheckConfig
+	client      *http.Client
+}
+
+type target struct {
+	url     *url.URL
+	healthy atomic.Bool
+	active  atomic.Int64 // requests in flight, including open streams
+
+	// Streaks of the health check loop, only it touches them
+	passed int
+	failed int
+}
+
+// NewBalancer creates the balancer of a route. Health checks run until ctx is
+// done.
+func NewBalancer(ctx context.Context, cfg *BalancerConfig) *Balancer {
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	b := &Balancer{
+		policy:      cfg.Policy,
+		healthCheck: cfg.HealthCheck,
+		client:      client,
+	}
+	for _, u := range cfg.Targets {
+		t := &target{url: u}
+		t.healthy.Store(true)
+		b.targets = append(b.targets, t)
+	}
+
+	if b.healthCheck != nil {
+		go b.runHealthChecks(ctx)
+	}
+
+	return b
+}
+
+// get returns the target with the URL targetURL if it is healthy, or nil.
+func (b *Balancer) get(targetURL string) *target {
+	for _, t := range b.targets {
+		if t.url.String() == targetURL && t.healthy.Load() {
+			return t
+		}
+	}
+	return nil
+}
+
+// pick chooses a healthy target by the policy of the route.
+func (b *Balancer) pick() (*target, error) {
+	n := len(b.targets)
+	start := int(b.next.Add(1) % uint64(n))
+
+	var picked *target
+	for i := range n {
+		t := b.targets[(start+i)%n]
+		if !t.healthy.Load() {
+			continue
+		}
+		if b.policy != config.LoadBalancingLeastConnections {
+			return t, nil
+		}
+		// Ties go to the next target in round-robin order
+		if picked == nil || t.active.Load() < picked.active.Load() {
+			picked = t
+		}
+	}
+	if picked == nil {
+		return nil, ErrNoHealthyTarget
+	}
+	return picked, nil
+}
+
+func (b *Balancer) runHealthChecks(ctx context.Context) {
+	ticker := time.NewTicker(b.healthCheck.Interval)
+	defer ticker.Stop()
+
+	for {
+		for _, t := range b.targets {
+			b.check(ctx, t)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Balancer) check(ctx context.Context, t *target) {
+	log := logger.FromContext(ctx).With(
+		slog.String("component", "balancer"),
+		slog.String("target", t.url.String()),
+	)
+
+	if err := b.probe(ctx, t); err != nil {
+		t.passed = 0
+		t.failed++
+		if t.healthy.Load() && t.failed >= b.healthCheck.UnhealthyThreshold {
+			log.Warn("draining unhealthy target", "error", err)
+			t.healthy.Store(false)
+		}
+		return
+	}
+
+	t.failed = 0
+	t.passed++
+	if !t.healthy.Load() && t.passed >= b.healthCheck.HealthyThreshold {
+		log.Info("target is healthy again")
+		t.healthy.Store(true)
+	}
+}
+
+func (b *Balancer) probe(ctx context.Context, t *target) error {
+	ctx, cancel := context.WithTimeout(ctx, b.healthCheck.Timeout)
+	defer cancel()
+
+	checkURL := *t.url
+	checkURL.Path = b.healthCheck.Path
+	checkURL.RawQuery = ""
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkURL.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return errors.New("health check answered " + resp.Status)
+	}
+	return nil
+}
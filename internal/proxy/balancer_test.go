@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+	"github.com/schnurbus/go-mcp-gateway/internal/mcpsession"
+)
+
+// newTestReplica answers initialize with a new session and other requests
+// with its name, or 404 for sessions it did not create.
+func newTestReplica(t *testing.T, name string) *url.URL {
+	t.Helper()
+	var sessions atomic.Int64
+	return newTestTarget(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessionID := r.Header.Get(mcpsession.Header)
+		switch {
+		case sessionID == "":
+			w.Header().Set(mcpsession.Header, fmt.Sprintf("%s-%d", name, sessions.Add(1)))
+		case !strings.HasPrefix(sessionID, name+"-"):
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, name)
+	}))
+}
+
+func TestBalancer(t *testing.T) {
+	rdb := newTestRedis(t)
+	balancerConfig := &BalancerConfig{
+		Targets: []*url.URL{newTestReplica(t, "a"), newTestReplica(t, "b")},
+		Policy:  config.LoadBalancingRoundRobin,
+	}
+	// Gateway replicas share the sessions through Redis
+	gatewayURLs := []string{
+		serveTestGateway(t, Config{
+			Balancer: NewBalancer(t.Context(), balancerConfig),
+			Sessions: mcpsession.NewRegistry(rdb),
+		}),
+		serveTestGateway(t, Config{
+			Balancer: NewBalancer(t.Context(), balancerConfig),
+			Sessions: mcpsession.NewRegistry(rdb),
+		}),
+	}
+
+	var sent int
+	send := func(sessionID string) (string, string, int) {
+		t.Helper()
+		gatewayURL := gatewayURLs[sent%len(gatewayURLs)]
+		sent++
+		req, _ := http.NewRequest("POST", gatewayURL, strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer alice")
+		if sessionID != "" {
+			req.Header.Set(mcpsession.Header, sessionID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), resp.Header.Get(mcpsession.Header), resp.StatusCode
+	}
+
+	first, firstSession, _ := send("")
+	sent = 0
+	second, secondSession, _ := send("")
+	if first == second {
+		t.Fatalf("expected round robin over both targets, got %s twice", first)
+	}
+
+	for range 3 {
+		if got, _, status := send(firstSession); got != first || status != http.StatusOK {
+			t.Errorf("expected session %s to stay on %s, got %s (%d)", firstSession, first, got, status)
+		}
+		if got, _, status := send(secondSession); got != second || status != http.StatusOK {
+			t.Errorf("expected session %s to stay on %s, got %s (%d)", secondSession, second, got, status)
+		}
+	}
+}
+
+func TestBalancerLeastConnections(t *testing.T) {
+	a, b := &target{url: &url.URL{Host: "a"}}, &target{url: &url.URL{Host: "b"}}
+	a.healthy.Store(true)
+	b.healthy.Store(true)
+	balancer := &Balancer{targets: []*target{a, b}, policy: config.LoadBalancingLeastConnections}
+
+	a.active.Store(2)
+	for range 4 {
+		if got, _ := balancer.pick(); got != b {
+			t.Fatalf("expected the target with fewer connections, got %s", got.url.Host)
+		}
+	}
+
+	b.healthy.Store(false)
+	if got, _ := balancer.pick(); got != a {
+		t.Errorf("expected the only healthy target, got %s", got.url.Host)
+	}
+
+	a.healthy.Store(false)
+	if _, err := balancer.pick(); err != ErrNoHealthyTarget {
+		t.Errorf("expected ErrNoHealthyTarget, got %v", err)
+	}
+}
+
+func TestBalancerHealthCheck(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	targetURL := newTestTarget(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			t.Errorf("unexpected health check path %s", r.URL.Path)
+		}
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+
+	balancer := NewBalancer(t.Context(), &BalancerConfig{
+		Targets: []*url.URL{targetURL},
+		HealthCheck: &config.HealthCheckConfig{
+			Path:               "/health",
+			Interval:           10 * time.Millisecond,
+			Timeout:            time.Second,
+			UnhealthyThreshold: 2,
+			HealthyThreshold:   2,
+		},
+	})
+
+	waitFor := func(expected bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for balancer.targets[0].healthy.Load() != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("target did not become healthy=%v", expected)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	healthy.Store(false)
+	waitFor(false)
+	if _, err := balancer.pick(); err != ErrNoHealthyTarget {
+		t.Errorf("expected the unhealthy target to be drained, got %v", err)
+	}
+
+	healthy.Store(true)
+	waitFor(true)
+}
@@ -0,0 +1,432 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+	"github.com/schnurbus/go-mcp-gateway/internal/mcpsession"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/tokenauth"
+	"github.com/schnurbus/go-mcp-gateway/internal/tokenvalidator"
+)
+
+// heartbeatInterval is how often an SSE comment is sent on quiet streams. It
+// keeps intermediaries from closing the connection and detects clients that
+// went away.
+const heartbeatInterval = 15 * time.Second
+
+// hopHeaders are not forwarded in either direction (RFC 9110 section 7.6.1).
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Config configures the reverse proxy of a route.
+type Config struct {
+	// Rewrite is appended to the path of the target URL, with the parameters
+	// and the wildcard of the route pattern expanded, see config.Rewrite.
+	Rewrite string
+
+	// Balancer picks the replica of the MCP server.
+	Balancer *Balancer
+
+	// Sessions tracks the MCP sessions and their replica.
+	Sessions *mcpsession.Registry
+
+	// IdleTimeout closes requests and streams the MCP server sent nothing on
+	// for this long. Zero disables it.
+	IdleTimeout time.Duration
+
+	// MaxStreamDuration closes event streams after this long, clients resume
+	// them with Last-Event-ID. Zero disables it.
+	MaxStreamDuration time.Duration
+
+	// Client sends the requests to the MCP server. Defaults to a client
+	// without timeouts that does not follow redirects.
+	Client *http.Client
+}
+
+type reverseProxy struct {
+	rewrite           string
+	balancer          *Balancer
+	sessions          *mcpsession.Registry
+	idleTimeout       time.Duration
+	maxStreamDuration time.Duration
+	client            *http.Client
+}
+
+// New forwards requests to the MCP server of a route. Unlike
+// proxy.Forward it does not buffer text/event-stream responses of MCP
+// Streamable HTTP: events are flushed to the client as they arrive, and a
+// client that disconnects cancels the upstream request. Last-Event-ID is
+// forwarded, so the MCP server can resume the stream. Requests of an MCP
+// session go to the replica that created it, and only the user who created
+// the session may use it.
+func New(cfg Config) fiber.Handler {
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+
+	p := &reverseProxy{
+		rewrite:           cfg.Rewrite,
+		balancer:          cfg.Balancer,
+		sessions:          cfg.Sessions,
+		idleTimeout:       cfg.IdleTimeout,
+		maxStreamDuration: cfg.MaxStreamDuration,
+		client:            client,
+	}
+	return p.handle
+}
+
+func (p *reverseProxy) handle(c *fiber.Ctx) error {
+	log := logger.FromContext(c.Context()).With(
+		slog.String("handler", "proxy"),
+	)
+
+	// The request outlives the handler while the response is streamed, so it
+	// is not bound to the fiber context
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var owner mcpsession.Owner
+	var clientID string
+	if principal, ok := c.Locals(tokenauth.LocalsKey).(*tokenvalidator.Principal); ok {
+		owner = mcpsession.Owner{Provider: principal.Provider, Subject: principal.Subject}
+		clientID = principal.ClientID
+	}
+
+	// Unknown sessions and sessions of other users are answered like the MCP
+	// server answers sessions it ended
+	var target *target
+	sessionID := c.Get(mcpsession.Header)
+	session, err := p.lookupSession(ctx, c.Path(), sessionID)
+	if err != nil {
+		cancel()
+		log.Error("failed to look up mcp session", "error", err)
+		return fiber.NewError(fiber.StatusServiceUnavailable, "MCP session unavailable")
+	}
+	if sessionID != "" && (session == nil || session.Owner != owner) {
+		cancel()
+		log.Warn("unknown mcp session", "provider", owner.Provider, "sub", owner.Subject)
+		return fiber.NewError(fiber.StatusNotFound, "MCP session not found")
+	}
+	if session != nil {
+		// Drained replicas lose their sessions, the replica picked instead
+		// answers 404 and the client starts over
+		target = p.balancer.get(session.Target)
+	}
+	if target == nil {
+		target, err = p.balancer.pick()
+		if err != nil {
+			cancel()
+			log.Error("no mcp server available", "error", err)
+			return fiber.NewError(fiber.StatusServiceUnavailable, "MCP server unavailable")
+		}
+	}
+	log = log.With(slog.String("target", target.url.String()))
+
+	endpoint, err := p.endpoint(c, target.url)
+	if err != nil {
+		cancel()
+		log.Warn("rejected path", "path", c.Path(), "error", err)
+		return fiber.NewError(fiber.StatusNotFound, "Not found")
+	}
+
+	target.active.Add(1)
+	release := func() { target.active.Add(-1) }
+	idle := newIdleTimer(p.idleTimeout, cancel)
+
+	req, err := p.newUpstreamRequest(ctx, c, endpoint)
+	if err != nil {
+		release()
+		cancel()
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		release()
+		idle.Stop()
+		cancel()
+		log.Error("failed to reach mcp server", "error", err)
+		return fiber.NewError(fiber.StatusBadGateway, "MCP server unavailable")
+	}
+	idle.Reset()
+
+	// Sessions are created by the response to initialize, and end with 404
+	// once the MCP server forgot them or when the client deletes them
+	switch respSessionID := resp.Header.Get(mcpsession.Header); {
+	case session == nil && respSessionID != "":
+		if err := p.sessions.Create(ctx, &mcpsession.Session{
+			SessionID: respSessionID,
+			Route:     c.Path(),
+			Target:    target.url.String(),
+			Endpoint:  endpoint.String(),
+			Owner:     owner,
+			ClientID:  clientID,
+		}); err != nil {
+			log.Error("failed to register mcp session", "error", err)
+		}
+	case session != nil && (resp.StatusCode == fiber.StatusNotFound ||
+		c.Method() == fiber.MethodDelete && resp.StatusCode < fiber.StatusMultipleChoices):
+		if err := p.sessions.Delete(ctx, session); err != nil {
+			log.Error("failed to delete mcp session", "error", err)
+		}
+	}
+
+	c.Status(resp.StatusCode)
+	copyResponseHeaders(c, resp.Header)
+
+	if !isEventStream(resp.Header) {
+		defer release()
+		defer cancel()
+		defer idle.Stop()
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(&idleReader{r: resp.Body, idle: idle})
+		if err != nil {
+			log.Error("failed to read mcp server response", "error", err)
+			return fiber.NewError(fiber.StatusBadGateway, "MCP server response incomplete")
+		}
+		return c.Send(body)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer release()
+		defer cancel()
+		defer idle.Stop()
+		defer resp.Body.Close()
+
+		if p.maxStreamDuration > 0 {
+			maxTimer := time.AfterFunc(p.maxStreamDuration, cancel)
+			defer maxTimer.Stop()
+		}
+
+		if err := streamEvents(ctx, w, &idleReader{r: resp.Body, idle: idle}); err != nil {
+			log.Debug("event stream closed", "error", err)
+		}
+	})
+
+	return nil
+}
+
+// lookupSession returns the session sessionID of the MCP endpoint at path, or
+// nil.
+func (p *reverseProxy) lookupSession(ctx context.Context, path, sessionID string) (*mcpsession.Session, error) {
+	if sessionID == "" {
+		return nil, nil
+	}
+	return p.sessions.Get(ctx, path, sessionID)
+}
+
+// endpoint returns the URL of the MCP endpoint at target the request is
+// forwarded to. The rewritten path must stay below the path of target.
+func (p *reverseProxy) endpoint(c *fiber.Ctx, target *url.URL) (*url.URL, error) {
+	endpoint := *target
+	if query := c.Request().URI().QueryString(); len(query) > 0 {
+		endpoint.RawQuery = string(query)
+	}
+	if p.rewrite == "" {
+		return &endpoint, nil
+	}
+
+	// Fiber matches the escaped path, the values are unescaped so that dot
+	// segments are resolved below
+	var unescapeErr error
+	rewritten := config.Rewrite(p.rewrite, func(name string) string {
+		value, err := url.PathUnescape(c.Params(name))
+		if err != nil {
+			unescapeErr = err
+		}
+		return value
+	})
+	if unescapeErr != nil {
+		return nil, unescapeErr
+	}
+	base := path.Clean("/" + target.Path)
+	endpoint.Path = path.Clean(base + rewritten)
+	endpoint.RawPath = ""
+	if endpoint.Path != base && !strings.HasPrefix(endpoint.Path, strings.TrimSuffix(base, "/")+"/") {
+		return nil, errors.New("path leaves the target")
+	}
+	return &endpoint, nil
+}
+
+func (p *reverseProxy) newUpstreamRequest(ctx context.Context, c *fiber.Ctx, endpoint *url.URL) (*http.Request, error) {
+	var body io.Reader
+	if b := c.Body(); len(b) > 0 {
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, c.Method(), endpoint.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		req.Header.Add(string(key), string(value))
+	})
+	removeHopHeaders(req.Header)
+	// The transport negotiates compression itself and decompresses, event
+	// streams have to be read event by event
+	req.Header.Del(fiber.HeaderAcceptEncoding)
+	req.Header.Del(fiber.HeaderHost)
+	req.Header.Del(fiber.HeaderContentLength)
+
+	return req, nil
+}
+
+func copyResponseHeaders(c *fiber.Ctx, header http.Header) {
+	removeHopHeaders(header)
+	header.Del(fiber.HeaderContentLength)
+	for key, values := range header {
+		for _, value := range values {
+			c.Response().Header.Add(key, value)
+		}
+	}
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, connectionHeader := range header.Values("Connection") {
+		for _, name := range strings.Split(connectionHeader, ",") {
+			header.Del(strings.TrimSpace(name))
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+func isEventStream(header http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(header.Get(fiber.HeaderContentType))
+	return mediaType == "text/event-stream"
+}
+
+// streamEvents copies complete SSE events from r to w and flushes each one.
+// Quiet streams get a heartbeat comment. It returns when r ends or fails, or
+// when the client cannot be written to anymore.
+func streamEvents(ctx context.Context, w *bufio.Writer, r io.Reader) error {
+	events := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- readEvents(ctx, r, events)
+		close(events)
+	}()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return <-readErr
+			}
+			if _, err := w.Write(event); err != nil {
+				return err
+			}
+			heartbeat.Reset(heartbeatInterval)
+		case <-heartbeat.C:
+			if _, err := w.WriteString(": keepalive\n\n"); err != nil {
+				return err
+			}
+		}
+		// Flush fails once the client disconnected
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// readEvents splits r into SSE events including their terminating blank line.
+// An incomplete event at the end of r is dropped, as clients would.
+func readEvents(ctx context.Context, r io.Reader, events chan<- []byte) error {
+	br := bufio.NewReader(r)
+	var event []byte
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		event = append(event, line...)
+		if len(bytes.TrimRight(line, "\r\n")) > 0 {
+			continue
+		}
+
+		select {
+		case events <- event:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		event = nil
+	}
+}
+
+// idleTimer cancels the upstream request once it was not reset for the idle
+// timeout.
+type idleTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func newIdleTimer(timeout time.Duration, cancel context.CancelFunc) *idleTimer {
+	t := &idleTimer{timeout: timeout}
+	if timeout > 0 {
+		t.timer = time.AfterFunc(timeout, cancel)
+	}
+	return t
+}
+
+func (t *idleTimer) Reset() {
+	if t.timer != nil {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+func (t *idleTimer) Stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// idleReader resets the idle timer whenever the MCP server sends data.
+type idleReader struct {
+	r    io.Reader
+	idle *idleTimer
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.idle.Reset()
+	}
+	return n, err
+}
@@ -0,0 +1,354 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/mcpsession"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/tokenauth"
+	"github.com/schnurbus/go-mcp-gateway/internal/tokenvalidator"
+)
+
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+func newTestTarget(t *testing.T, upstream http.Handler) *url.URL {
+	t.Helper()
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	target, err := url.Parse(server.URL + "/mcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return target
+}
+
+func newTestGateway(t *testing.T, upstream http.Handler, cfg Config) string {
+	t.Helper()
+	cfg.Balancer = NewBalancer(t.Context(), &BalancerConfig{
+		Targets: []*url.URL{newTestTarget(t, upstream)},
+	})
+	cfg.Sessions = mcpsession.NewRegistry(newTestRedis(t))
+	return serveTestGateway(t, cfg)
+}
+
+// serveTestGateway serves the proxy at /calc/mcp. The provider and subject of
+// the request are taken from the Authorization header, e.g. "github:alice";
+// the provider defaults to google.
+func serveTestGateway(t *testing.T, cfg Config) string {
+	t.Helper()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(func(c *fiber.Ctx) error {
+		provider, subject, ok := strings.Cut(strings.TrimPrefix(c.Get("Authorization"), "Bearer "), ":")
+		if !ok {
+			provider, subject = "google", provider
+		}
+		c.Locals(tokenauth.LocalsKey, &tokenvalidator.Principal{
+			Provider: provider,
+			Subject:  subject,
+			ClientID: "client-a",
+		})
+		return c.Next()
+	})
+	app.All("/calc/mcp", New(cfg))
+	return listenTestApp(t, app) + "/calc/mcp"
+}
+
+// listenTestApp serves app and returns its base URL.
+func listenTestApp(t *testing.T, app *fiber.App) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = app.Listener(ln) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	return "http://" + ln.Addr().String()
+}
+
+func TestNew(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Mcp-Session-Id", "session-1")
+		w.Header().Set("Connection", "X-Hop")
+		w.Header().Set("X-Hop", "dropped")
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, `{"method":%q,"path":%q,"query":%q,"body":%q,"authorization":%q}`,
+			r.Method, r.URL.Path, r.URL.RawQuery, body, r.Header.Get("Authorization"))
+	})
+	gatewayURL := newTestGateway(t, upstream, Config{IdleTimeout: time.Second})
+
+	req, _ := http.NewRequest("POST", gatewayURL+"?debug=1", strings.NewReader(`{"jsonrpc":"2.0"}`))
+	req.Header.Set("Authorization", "Bearer upstream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	expected := `{"method":"POST","path":"/mcp","query":"debug=1","body":"{\"jsonrpc\":\"2.0\"}","authorization":"Bearer upstream"}`
+	if string(body) != expected {
+		t.Errorf("expected %s, got %s", expected, body)
+	}
+	if got := resp.Header.Get("Mcp-Session-Id"); got != "session-1" {
+		t.Errorf("expected session id session-1, got %q", got)
+	}
+	if got := resp.Header.Get("X-Hop"); got != "" {
+		t.Errorf("expected hop-by-hop header to be dropped, got %q", got)
+	}
+}
+
+func TestNewEventStream(t *testing.T) {
+	next := make(chan struct{})
+	closed := make(chan struct{})
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(closed)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "id: %s-1\ndata: {\"progress\":1}\n\n", r.Header.Get("Last-Event-ID"))
+		w.(http.Flusher).Flush()
+
+		// The second event is only sent once the client received the first
+		<-next
+		fmt.Fprint(w, "id: 2\ndata: {\"progress\":2}\n\n")
+		w.(http.Flusher).Flush()
+
+		// Keep sending until the gateway cancels the request
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+				fmt.Fprint(w, "data: {}\n\n")
+				w.(http.Flusher).Flush()
+			}
+		}
+	})
+	gatewayURL := newTestGateway(t, upstream, Config{})
+
+	req, _ := http.NewRequest("GET", gatewayURL, nil)
+	req.Header.Set("Last-Event-ID", "resume")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	readEvent := func() string {
+		var event strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == "\n" {
+				return event.String()
+			}
+			event.WriteString(line)
+		}
+	}
+
+	if got := readEvent(); got != "id: resume-1\ndata: {\"progress\":1}\n" {
+		t.Errorf("unexpected first event %q", got)
+	}
+	close(next)
+	if got := readEvent(); got != "id: 2\ndata: {\"progress\":2}\n" {
+		t.Errorf("unexpected second event %q", got)
+	}
+
+	// The client disconnects, the upstream request has to be canceled
+	resp.Body.Close()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream request was not canceled after the client disconnected")
+	}
+}
+
+func TestNewStreamDurations(t *testing.T) {
+	testCases := []struct {
+		name string
+		cfg  Config
+		send bool
+	}{
+		{
+			name: "idle timeout",
+			cfg:  Config{IdleTimeout: 100 * time.Millisecond},
+		},
+		{
+			name: "max stream duration",
+			cfg:  Config{IdleTimeout: time.Second, MaxStreamDuration: 200 * time.Millisecond},
+			send: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+				for {
+					select {
+					case <-r.Context().Done():
+						return
+					case <-time.After(20 * time.Millisecond):
+						if tc.send {
+							fmt.Fprint(w, "data: {}\n\n")
+							w.(http.Flusher).Flush()
+						}
+					}
+				}
+			})
+			gatewayURL := newTestGateway(t, upstream, tc.cfg)
+
+			client := &http.Client{Timeout: 5 * time.Second}
+			resp, err := client.Get(gatewayURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			// The gateway ends the stream, so reading it completes
+			if _, err := io.ReadAll(resp.Body); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestNewSessions(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get(mcpsession.Header) == "":
+			w.Header().Set(mcpsession.Header, "session-1")
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	rdb := newTestRedis(t)
+	sessions := mcpsession.NewRegistry(rdb)
+	gatewayURL := serveTestGateway(t, Config{
+		Balancer: NewBalancer(t.Context(), &BalancerConfig{
+			Targets: []*url.URL{newTestTarget(t, upstream)},
+		}),
+		Sessions: sessions,
+	})
+
+	send := func(method, user, sessionID string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, gatewayURL, nil)
+		req.Header.Set("Authorization", "Bearer "+user)
+		if sessionID != "" {
+			req.Header.Set(mcpsession.Header, sessionID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	steps := []struct {
+		name           string
+		method         string
+		user           string
+		sessionID      string
+		expectedStatus int
+		expectedOpen   int
+	}{
+		{"initialize", "POST", "alice", "", http.StatusOK, 1},
+		{"session of another user", "POST", "bob", "session-1", http.StatusNotFound, 1},
+		{"same subject at another provider", "POST", "github:alice", "session-1", http.StatusNotFound, 1},
+		{"unknown session", "POST", "alice", "session-2", http.StatusNotFound, 1},
+		{"own session", "GET", "alice", "session-1", http.StatusOK, 1},
+		{"delete session", "DELETE", "alice", "session-1", http.StatusNoContent, 0},
+		{"deleted session", "POST", "alice", "session-1", http.StatusNotFound, 0},
+	}
+	for _, step := range steps {
+		if status := send(step.method, step.user, step.sessionID); status != step.expectedStatus {
+			t.Errorf("%s: expected status %d, got %d", step.name, step.expectedStatus, status)
+		}
+		open, err := sessions.List(t.Context(), mcpsession.Owner{Provider: "google", Subject: "alice"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(open) != step.expectedOpen {
+			t.Errorf("%s: expected %d open sessions, got %d", step.name, step.expectedOpen, len(open))
+		}
+	}
+}
+
+func TestNewRewrite(t *testing.T) {
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s?%s", r.URL.Path, r.URL.RawQuery)
+	})
+	target := newTestTarget(t, upstream)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	for _, route := range []struct {
+		pattern string
+		rewrite string
+	}{
+		{"/tools/*", "/*"},
+		{"/calc/:version/mcp", "/:version"},
+		{"/fixed/mcp", ""},
+	} {
+		app.All(route.pattern, New(Config{
+			Rewrite:  route.rewrite,
+			Balancer: NewBalancer(t.Context(), &BalancerConfig{Targets: []*url.URL{target}}),
+			Sessions: mcpsession.NewRegistry(newTestRedis(t)),
+		}))
+	}
+	gatewayURL := listenTestApp(t, app)
+
+	testCases := []struct {
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"/tools/search?q=1", http.StatusOK, "/mcp/search?q=1"},
+		{"/tools/files/mcp", http.StatusOK, "/mcp/files/mcp?"},
+		{"/tools/", http.StatusOK, "/mcp?"},
+		{"/tools/%2e%2e/admin", http.StatusNotFound, ""},
+		{"/calc/v2/mcp", http.StatusOK, "/mcp/v2?"},
+		{"/fixed/mcp?debug=1", http.StatusOK, "/mcp?debug=1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			resp, err := http.Get(gatewayURL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.expectedStatus, resp.StatusCode, body)
+			}
+			if tc.expectedBody != "" && string(body) != tc.expectedBody {
+				t.Errorf("expected %s, got %s", tc.expectedBody, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package stdio
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/schnurbus/go-mcp-gateway/pkg/jsonrpc"
+)
+
+// JSON-RPC error codes of the bridge
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInternalError  = -32603
+	codeNoSession      = -32000
+)
+
+// message is a JSON-RPC message. Members stay raw, the bridge only replaces
+// ids and progress tokens.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
+}
+
+func (m *message) isRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+func (m *message) isNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
+
+func (m *message) isResponse() bool {
+	return m.Method == ""
+}
+
+func newErrorMessage(id json.RawMessage, code int, text string) *message {
+	errorJSON, _ := json.Marshal(&jsonrpc.JSONRPCError{Code: code, Message: text})
+	return &message{JSONRPC: "2.0", ID: id, Error: errorJSON}
+}
+
+// parseMessages parses the body of a POST request, a single message or a
+// batch.
+func parseMessages(body []byte) ([]*message, bool, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var messages []*message
+		if err := json.Unmarshal(body, &messages); err != nil {
+			return nil, true, err
+		}
+		if len(messages) == 0 {
+			return nil, true, errors.New("empty batch")
+		}
+		for _, m := range messages {
+			if m == nil {
+				return nil, true, errors.New("null message in batch")
+			}
+		}
+		return messages, true, nil
+	}
+
+	var m message
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, false, err
+	}
+	return []*message{&m}, false, nil
+}
+
+// member returns the member at path of the JSON object raw, or nil.
+func member(raw json.RawMessage, path ...string) json.RawMessage {
+	for _, name := range path {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return nil
+		}
+		raw = object[name]
+	}
+	return raw
+}
+
+// setMember returns the JSON object raw with the member at path replaced by
+// value. The objects on the path must exist.
+func setMember(raw json.RawMessage, value json.RawMessage, path ...string) (json.RawMessage, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, err
+	}
+	if object == nil {
+		return nil, errors.New("not an object")
+	}
+	if len(path) > 1 {
+		var err error
+		if value, err = setMember(object[path[0]], value, path[1:]...); err != nil {
+			return nil, err
+		}
+	}
+	object[path[0]] = value
+	return json.Marshal(object)
+}
@@ -0,0 +1,344 @@
+package stdio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// stopTimeout is how long a process may take to exit once its stdin is
+// closed, before it is killed.
+const stopTimeout = 5 * time.Second
+
+// maxStderrLine bounds the lines of stderr that are logged.
+const maxStderrLine = 64 * 1024
+
+// process is a running stdio MCP server. The requests of the sessions that
+// share it get ids unique to the process, so their responses find their way
+// back.
+type process struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	log   *slog.Logger
+	done  chan struct{} // closed once the process exited
+	err   error         // why the process exited, set before done is closed
+
+	// onMessage gets the requests and notifications of the MCP server,
+	// except the progress of pending requests
+	onMessage func(*process, *message)
+
+	writeMu  sync.Mutex
+	stopOnce sync.Once
+
+	mu         sync.Mutex
+	nextID     int64
+	calls      map[string]*call // keyed by the id sent to the process
+	initResult json.RawMessage  // result of the initialize of the gateway, pool mode
+}
+
+// call is a request of a client the process has not answered yet.
+type call struct {
+	id      json.RawMessage // id of the client
+	token   json.RawMessage // progress token of the client, or nil
+	session *session
+	stream  *stream // gets the progress and the response
+
+	process *process
+	pid     string // id sent to the process
+}
+
+func startProcess(cmd *exec.Cmd, log *slog.Logger, onMessage func(*process, *message)) (*process, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &process{
+		cmd:       cmd,
+		stdin:     stdin,
+		log:       log.With(slog.Int("pid", cmd.Process.Pid)),
+		done:      make(chan struct{}),
+		onMessage: onMessage,
+		calls:     map[string]*call{},
+	}
+	p.log.Info("started mcp server")
+
+	// Wait closes the pipes, so it has to wait for the readers
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.logStderr(stderr)
+	}()
+	go func() {
+		defer wg.Done()
+		p.readMessages(stdout)
+	}()
+	go func() {
+		wg.Wait()
+		p.exited(cmd.Wait())
+	}()
+
+	return p, nil
+}
+
+// send forwards the request m of the call c with an id of the process.
+func (p *process) send(c *call, m *message) error {
+	p.mu.Lock()
+	p.nextID++
+	pid := strconv.FormatInt(p.nextID, 10)
+	c.process, c.pid = p, pid
+	p.calls[pid] = c
+	p.mu.Unlock()
+
+	forwarded := *m
+	forwarded.ID = json.RawMessage(pid)
+	// Progress tokens are only unique per client as well, the id of the
+	// process serves as token
+	if c.token = member(m.Params, "_meta", "progressToken"); c.token != nil {
+		params, err := setMember(m.Params, json.RawMessage(pid), "_meta", "progressToken")
+		if err != nil {
+			p.forget(pid)
+			return err
+		}
+		forwarded.Params = params
+	}
+
+	if c.stream != nil {
+		c.stream.track(c)
+	}
+	if err := p.write(&forwarded); err != nil {
+		p.forget(pid)
+		return err
+	}
+	return nil
+}
+
+// cancel forwards the cancellation m of the request id of session s. It
+// reports false if the process has no such request.
+func (p *process) cancel(s *session, id json.RawMessage, m *message) bool {
+	p.mu.Lock()
+	var cancelled *call
+	for _, c := range p.calls {
+		if c.session == s && bytes.Equal(c.id, id) {
+			cancelled = c
+			break
+		}
+	}
+	if cancelled != nil {
+		delete(p.calls, cancelled.pid)
+	}
+	p.mu.Unlock()
+	if cancelled == nil {
+		return false
+	}
+
+	// The MCP server does not answer cancelled requests
+	cancelled.stream.drop()
+	params, err := setMember(m.Params, json.RawMessage(cancelled.pid), "requestId")
+	if err != nil {
+		return true
+	}
+	forwarded := *m
+	forwarded.Params = params
+	if err := p.write(&forwarded); err != nil {
+		p.log.Debug("failed to forward cancellation", "error", err)
+	}
+	return true
+}
+
+// abandon cancels the request of c, whose client went away.
+func (p *process) abandon(c *call) {
+	if !p.forget(c.pid) {
+		return
+	}
+	params, _ := json.Marshal(map[string]any{
+		"requestId": json.RawMessage(c.pid),
+		"reason":    "client disconnected",
+	})
+	if err := p.write(&message{JSONRPC: "2.0", Method: "notifications/cancelled", Params: params}); err != nil {
+		p.log.Debug("failed to cancel abandoned request", "error", err)
+	}
+}
+
+// forget drops the call with the process id pid. It reports whether the call
+// was pending.
+func (p *process) forget(pid string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.calls[pid]
+	delete(p.calls, pid)
+	return ok
+}
+
+// load is the number of requests the process has not answered.
+func (p *process) load() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.calls)
+}
+
+func (p *process) write(m *message) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	_, err = p.stdin.Write(append(data, '\n'))
+	return err
+}
+
+// readMessages dispatches the messages the MCP server writes to stdout, one
+// per line.
+func (p *process) readMessages(stdout io.Reader) {
+	r := bufio.NewReader(stdout)
+	for {
+		line, err := r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var m message
+			if err := json.Unmarshal(line, &m); err != nil {
+				p.log.Warn("invalid message from mcp server", "error", err)
+			} else {
+				p.dispatch(&m)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *process) dispatch(m *message) {
+	switch {
+	case m.isResponse():
+		p.mu.Lock()
+		c := p.calls[string(m.ID)]
+		delete(p.calls, string(m.ID))
+		p.mu.Unlock()
+		if c == nil {
+			p.log.Debug("dropped response to unknown request", "id", string(m.ID))
+			return
+		}
+		m.ID = c.id
+		c.stream.push(m)
+
+	case m.Method == "notifications/progress":
+		token := member(m.Params, "progressToken")
+		p.mu.Lock()
+		c := p.calls[string(token)]
+		p.mu.Unlock()
+		if c == nil || c.token == nil {
+			p.onMessage(p, m)
+			return
+		}
+		params, err := setMember(m.Params, c.token, "progressToken")
+		if err != nil {
+			return
+		}
+		m.Params = params
+		c.stream.push(m)
+
+	default:
+		p.onMessage(p, m)
+	}
+}
+
+func (p *process) logStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(nil, maxStderrLine)
+	for scanner.Scan() {
+		p.log.Info("mcp server stderr", "line", scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		p.log.Warn("stopped logging stderr of mcp server", "error", err)
+		// A full pipe would block the process
+		_, _ = io.Copy(io.Discard, stderr)
+	}
+}
+
+// exited answers the pending requests once the process is gone.
+func (p *process) exited(err error) {
+	if err == nil {
+		err = errors.New("exited")
+	}
+	p.err = err
+	p.log.Info("mcp server exited", "error", err)
+
+	p.mu.Lock()
+	calls := p.calls
+	p.calls = map[string]*call{}
+	p.mu.Unlock()
+	for _, c := range calls {
+		c.stream.push(newErrorMessage(c.id, codeInternalError, "MCP server exited"))
+	}
+
+	close(p.done)
+}
+
+// stop closes stdin, which ends stdio MCP servers, and kills the process if
+// it does not exit in time.
+func (p *process) stop() {
+	p.stopOnce.Do(func() {
+		_ = p.stdin.Close()
+		go func() {
+			select {
+			case <-p.done:
+			case <-time.After(stopTimeout):
+				p.log.Warn("killing mcp server that did not exit")
+				_ = p.cmd.Process.Kill()
+			}
+		}()
+	})
+}
+
+// initialize starts the MCP session of the gateway with a pooled process. The
+// clients of the pool get its result.
+func (p *process) initialize(timeout time.Duration) error {
+	params, _ := json.Marshal(map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]string{"name": clientName, "version": clientVersion},
+	})
+	s := newStream(1)
+	c := &call{id: json.RawMessage("0"), stream: s}
+	if err := p.send(c, &message{JSONRPC: "2.0", ID: c.id, Method: "initialize", Params: params}); err != nil {
+		return err
+	}
+
+	responses, err := s.collect(0, timeout)
+	if err != nil {
+		p.forget(c.pid)
+		return err
+	}
+	if len(responses) == 0 {
+		return errors.New("initialize was not answered")
+	}
+	if responses[0].Error != nil {
+		return fmt.Errorf("initialize failed: %s", responses[0].Error)
+	}
+
+	p.mu.Lock()
+	p.initResult = responses[0].Result
+	p.mu.Unlock()
+	return p.write(&message{JSONRPC: "2.0", Method: "notifications/initialized"})
+}
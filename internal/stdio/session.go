@@ -0,0 +1,129 @@
+package stdio
+
+import (
+	"sync"
+	"time"
+
+	"github.com/schnurbus/go-mcp-gateway/internal/mcpsession"
+)
+
+// session is an MCP session of a stdio route. The gateway that runs its MCP
+// server keeps it in memory, the registry makes it visible to the admin API.
+type session struct {
+	id      string
+	route   string // gateway path of the MCP endpoint
+	owner   mcpsession.Owner
+	record  *mcpsession.Session
+	process *process // own process in session mode, nil in pool mode
+
+	mu          sync.Mutex
+	initialized bool
+	standalone  *stream              // stream of the open GET, or nil
+	posts       map[*stream]struct{} // streams of the open POSTs
+	requests    int                  // HTTP requests in progress
+	lastUsed    time.Time
+}
+
+func newSession(id, route string, owner mcpsession.Owner) *session {
+	return &session{
+		id:       id,
+		route:    route,
+		owner:    owner,
+		posts:    map[*stream]struct{}{},
+		lastUsed: time.Now(),
+	}
+}
+
+// initialize reports whether the session was not initialized yet, and marks
+// it initialized.
+func (s *session) initialize() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	initialized := s.initialized
+	s.initialized = true
+	return !initialized
+}
+
+// begin and end enclose the HTTP requests of the session, sessions with
+// requests in progress are not idle.
+func (s *session) begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	s.lastUsed = time.Now()
+}
+
+func (s *session) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests--
+	s.lastUsed = time.Now()
+}
+
+// idle reports whether the session had no requests for timeout.
+func (s *session) idle(timeout time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests == 0 && time.Since(s.lastUsed) > timeout
+}
+
+func (s *session) addPost(post *stream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.posts[post] = struct{}{}
+}
+
+func (s *session) removePost(post *stream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.posts, post)
+}
+
+// openStandalone opens the stream of a GET. A session has at most one.
+func (s *session) openStandalone() (*stream, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.standalone != nil {
+		return nil, false
+	}
+	s.standalone = newStream(0)
+	return s.standalone, true
+}
+
+func (s *session) closeStandalone(standalone *stream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	standalone.close()
+	if s.standalone == standalone {
+		s.standalone = nil
+	}
+}
+
+// deliver sends a message of the MCP server that answers no request to the
+// standalone stream, or else to an open POST stream. It reports false if the
+// client has no open stream.
+func (s *session) deliver(m *message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.standalone != nil && s.standalone.push(m) {
+		return true
+	}
+	for post := range s.posts {
+		if post.push(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// close ends the open streams of the session.
+func (s *session) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.standalone != nil {
+		s.standalone.close()
+	}
+	for post := range s.posts {
+		post.close()
+	}
+}
@@ -0,0 +1,590 @@
+package stdio
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+	"github.com/schnurbus/go-mcp-gateway/internal/mcpsession"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/tokenauth"
+	"github.com/schnurbus/go-mcp-gateway/internal/tokenvalidator"
+	"github.com/schnurbus/go-mcp-gateway/internal/utils"
+	"github.com/schnurbus/go-mcp-gateway/pkg/jsonrpc"
+)
+
+// The gateway initializes pooled processes as this client
+const (
+	protocolVersion = "2025-06-18"
+	clientName      = "go-mcp-gateway"
+	clientVersion   = "1.0.0"
+)
+
+// initializeTimeout bounds the initialization of pooled processes.
+const initializeTimeout = 30 * time.Second
+
+// Crashed pooled processes are restarted after a backoff that doubles up to
+// maxRestartBackoff, and starts over once a process ran for stableRunTime.
+const (
+	minRestartBackoff = time.Second
+	maxRestartBackoff = 30 * time.Second
+	stableRunTime     = time.Minute
+)
+
+// replica names this gateway process in the sessions it registers.
+var replica = func() string {
+	hostname, _ := os.Hostname()
+	return hostname + "/" + strconv.Itoa(os.Getpid())
+}()
+
+// inheritedEnv are the variables of the gateway's environment that are passed
+// to the processes. The rest of it holds the gateway's secrets.
+var inheritedEnv = []string{"PATH", "HOME"}
+
+// Config configures the stdio bridge of a route.
+type Config struct {
+	// Server is the command of the MCP server and how its processes are run.
+	Server *config.StdioConfig
+
+	// Sessions makes the sessions visible to the admin API.
+	Sessions *mcpsession.Registry
+
+	// IdleTimeout closes requests the MCP server sent nothing on for this
+	// long. Zero disables it.
+	IdleTimeout time.Duration
+
+	// MaxStreamDuration closes event streams after this long. Zero disables
+	// it.
+	MaxStreamDuration time.Duration
+}
+
+type bridge struct {
+	server            *config.StdioConfig
+	env               []string
+	sessionTimeout    time.Duration
+	registry          *mcpsession.Registry
+	idleTimeout       time.Duration
+	maxStreamDuration time.Duration
+	ctx               context.Context
+	log               *slog.Logger
+
+	mu       sync.Mutex
+	sessions map[string]*session // keyed by Mcp-Session-Id
+	pool     []*slot
+}
+
+// slot holds a pooled process, nil while it is restarted.
+type slot struct {
+	mu      sync.Mutex
+	process *process
+}
+
+// New serves an MCP server that speaks JSON-RPC on stdin and stdout over MCP
+// Streamable HTTP. In session mode every MCP session gets its own process,
+// which ends with the session. In pool mode the sessions share a pool of
+// processes that the gateway initializes and restarts when they crash.
+// Sessions end once they had no requests for the idle timeout of the server,
+// and all processes stop when ctx is done.
+func New(ctx context.Context, cfg Config) fiber.Handler {
+	env := []string{}
+	for _, name := range inheritedEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	names := make([]string, 0, len(cfg.Server.Env))
+	for name := range cfg.Server.Env {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		env = append(env, name+"="+cfg.Server.Env[name])
+	}
+
+	var sessionTimeout time.Duration
+	if cfg.Server.IdleTimeout != nil {
+		sessionTimeout = *cfg.Server.IdleTimeout
+	}
+
+	b := &bridge{
+		server:            cfg.Server,
+		env:               env,
+		sessionTimeout:    sessionTimeout,
+		registry:          cfg.Sessions,
+		idleTimeout:       cfg.IdleTimeout,
+		maxStreamDuration: cfg.MaxStreamDuration,
+		ctx:               ctx,
+		log: logger.FromContext(ctx).With(
+			slog.String("component", "stdio"),
+			slog.String("command", cfg.Server.Command),
+		),
+		sessions: map[string]*session{},
+	}
+
+	if b.server.Mode == config.StdioModePool {
+		for range b.server.PoolSize {
+			s := &slot{}
+			b.pool = append(b.pool, s)
+			go b.runPooled(s)
+		}
+	}
+	go b.reapSessions()
+
+	return b.handle
+}
+
+func (b *bridge) handle(c *fiber.Ctx) error {
+	log := logger.FromContext(c.Context()).With(
+		slog.String("handler", "stdio"),
+	)
+
+	var owner mcpsession.Owner
+	var clientID string
+	if principal, ok := c.Locals(tokenauth.LocalsKey).(*tokenvalidator.Principal); ok {
+		owner = mcpsession.Owner{Provider: principal.Provider, Subject: principal.Subject}
+		clientID = principal.ClientID
+	}
+
+	switch c.Method() {
+	case fiber.MethodPost:
+		return b.handlePost(c, log, owner, clientID)
+	case fiber.MethodGet:
+		return b.handleGet(c, log, owner)
+	case fiber.MethodDelete:
+		s, err := b.session(c, log, owner)
+		if err != nil {
+			return err
+		}
+		b.close(s, "deleted by client")
+		return c.SendStatus(fiber.StatusNoContent)
+	default:
+		return fiber.ErrMethodNotAllowed
+	}
+}
+
+func (b *bridge) handlePost(c *fiber.Ctx, log *slog.Logger, owner mcpsession.Owner, clientID string) error {
+	messages, batch, err := parseMessages(c.Body())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(
+			jsonrpc.NewErrorResponse(nil, "Parse error", codeParseError, nil))
+	}
+
+	// Sessions start with an initialize request without session id
+	var s *session
+	if c.Get(mcpsession.Header) == "" {
+		if batch || messages[0].Method != "initialize" || !messages[0].isRequest() {
+			return c.Status(fiber.StatusBadRequest).JSON(
+				jsonrpc.NewErrorResponse(nil, "Bad Request: No valid session ID provided", codeNoSession, nil))
+		}
+		if s, err = b.open(c, log, owner, clientID); err != nil {
+			return err
+		}
+		c.Set(mcpsession.Header, s.id)
+	} else if s, err = b.session(c, log, owner); err != nil {
+		return err
+	}
+
+	s.begin()
+	pending := 0
+	for _, m := range messages {
+		if m.isRequest() {
+			pending++
+		}
+	}
+	post := newStream(pending)
+	if pending > 0 {
+		s.addPost(post)
+	}
+	for _, m := range messages {
+		b.forward(s, post, m, log)
+	}
+	done := func() {
+		post.finish()
+		s.removePost(post)
+		s.end()
+	}
+
+	if pending == 0 {
+		done()
+		return c.SendStatus(fiber.StatusAccepted)
+	}
+
+	if acceptsEventStream(c) {
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		c.Set("X-Accel-Buffering", "no")
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			defer done()
+			if err := writeEvents(w, post, b.idleTimeout, b.maxStreamDuration); err != nil {
+				log.Debug("event stream closed", "error", err)
+			}
+		})
+		return nil
+	}
+
+	defer done()
+	responses, err := post.collect(b.idleTimeout, b.maxStreamDuration)
+	if err != nil {
+		log.Error("mcp server did not answer", "error", err)
+		return fiber.NewError(fiber.StatusGatewayTimeout, "MCP server did not answer")
+	}
+	switch {
+	case batch:
+		return c.JSON(responses)
+	case len(responses) == 1:
+		return c.JSON(responses[0])
+	default:
+		// The request was cancelled or the session closed
+		return c.SendStatus(fiber.StatusAccepted)
+	}
+}
+
+func (b *bridge) handleGet(c *fiber.Ctx, log *slog.Logger, owner mcpsession.Owner) error {
+	s, err := b.session(c, log, owner)
+	if err != nil {
+		return err
+	}
+	if !acceptsEventStream(c) {
+		return fiber.NewError(fiber.StatusNotAcceptable, "Client must accept text/event-stream")
+	}
+	standalone, ok := s.openStandalone()
+	if !ok {
+		return fiber.NewError(fiber.StatusConflict, "MCP session already has a stream")
+	}
+
+	s.begin()
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer s.end()
+		defer s.closeStandalone(standalone)
+		if err := writeEvents(w, standalone, 0, b.maxStreamDuration); err != nil {
+			log.Debug("event stream closed", "error", err)
+		}
+	})
+	return nil
+}
+
+// open starts a session, and its process in session mode.
+func (b *bridge) open(c *fiber.Ctx, log *slog.Logger, owner mcpsession.Owner, clientID string) (*session, error) {
+	// Values of the fiber context are only valid during the request
+	owner = mcpsession.Owner{Provider: strings.Clone(owner.Provider), Subject: strings.Clone(owner.Subject)}
+	s := newSession(utils.RandString(24), strings.Clone(c.Path()), owner)
+	log = log.With(slog.String("session", s.id))
+
+	switch b.server.Mode {
+	case config.StdioModePool:
+		if b.pick() == nil {
+			log.Error("no pooled mcp server is running")
+			return nil, fiber.NewError(fiber.StatusServiceUnavailable, "MCP server unavailable")
+		}
+	case config.StdioModeSession:
+		p, err := b.start(b.deliverTo(s))
+		if err != nil {
+			log.Error("failed to start mcp server", "error", err)
+			return nil, fiber.NewError(fiber.StatusServiceUnavailable, "MCP server unavailable")
+		}
+		s.process = p
+	}
+
+	s.record = &mcpsession.Session{
+		SessionID: s.id,
+		Route:     s.route,
+		Target:    replica,
+		Owner:     owner,
+		ClientID:  clientID,
+	}
+	if err := b.registry.Create(b.ctx, s.record); err != nil {
+		if s.process != nil {
+			s.process.stop()
+		}
+		log.Error("failed to register mcp session", "error", err)
+		return nil, fiber.NewError(fiber.StatusServiceUnavailable, "MCP session unavailable")
+	}
+
+	b.mu.Lock()
+	b.sessions[s.id] = s
+	b.mu.Unlock()
+
+	if s.process != nil {
+		go func() {
+			<-s.process.done
+			b.close(s, "mcp server exited")
+		}()
+	}
+	return s, nil
+}
+
+// session returns the session of the request. Unknown sessions, sessions of
+// other users and sessions the admin API terminated are not found. Sessions
+// of other gateway replicas are not found either, their process runs there.
+func (b *bridge) session(c *fiber.Ctx, log *slog.Logger, owner mcpsession.Owner) (*session, error) {
+	sessionID := c.Get(mcpsession.Header)
+	if sessionID == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "MCP session required")
+	}
+
+	b.mu.Lock()
+	s := b.sessions[sessionID]
+	b.mu.Unlock()
+	if s == nil {
+		record, err := b.registry.GetByID(b.ctx, mcpsession.ID(c.Path(), sessionID))
+		if err == nil && record != nil && record.Owner == owner {
+			log.Warn("mcp session runs on another gateway replica", "replica", record.Target)
+			return nil, fiber.NewError(fiber.StatusNotFound,
+				"MCP session runs on another gateway replica, send initialize to start a new session")
+		}
+	}
+	if s == nil || s.owner != owner || s.route != c.Path() {
+		log.Warn("unknown mcp session", "provider", owner.Provider, "sub", owner.Subject)
+		return nil, fiber.NewError(fiber.StatusNotFound, "MCP session not found")
+	}
+
+	// Getting the session extends it in the registry
+	record, err := b.registry.Get(b.ctx, s.route, s.id)
+	if err != nil {
+		log.Error("failed to look up mcp session", "error", err)
+		return nil, fiber.NewError(fiber.StatusServiceUnavailable, "MCP session unavailable")
+	}
+	if record == nil {
+		b.close(s, "terminated")
+		return nil, fiber.NewError(fiber.StatusNotFound, "MCP session not found")
+	}
+	return s, nil
+}
+
+// forward passes a message of the client to the MCP server. Responses the
+// gateway gives itself are pushed to post.
+func (b *bridge) forward(s *session, post *stream, m *message, log *slog.Logger) {
+	switch {
+	case m.isRequest():
+		if m.Method == "initialize" && !s.initialize() {
+			post.push(newErrorMessage(m.ID, codeInvalidRequest, "Session is already initialized"))
+			return
+		}
+		p := s.process
+		if p == nil {
+			if p = b.pick(); p == nil {
+				post.push(newErrorMessage(m.ID, codeInternalError, "MCP server unavailable"))
+				return
+			}
+		}
+		// Pooled processes were initialized by the gateway
+		if m.Method == "initialize" && s.process == nil {
+			p.mu.Lock()
+			result := p.initResult
+			p.mu.Unlock()
+			post.push(&message{JSONRPC: "2.0", ID: m.ID, Result: result})
+			return
+		}
+		if err := p.send(&call{id: m.ID, session: s, stream: post}, m); err != nil {
+			log.Error("failed to send request to mcp server", "error", err)
+			post.push(newErrorMessage(m.ID, codeInternalError, "MCP server unavailable"))
+		}
+
+	case m.Method == "notifications/cancelled":
+		id := member(m.Params, "requestId")
+		for _, p := range b.processes(s) {
+			if p.cancel(s, id, m) {
+				return
+			}
+		}
+
+	case s.process != nil:
+		// Other notifications, and responses to requests of the MCP server
+		if err := s.process.write(m); err != nil {
+			log.Error("failed to send message to mcp server", "error", err)
+		}
+
+	default:
+		// Pooled processes have no session of the client to pass them to
+		log.Debug("dropped message to shared mcp server", "method", m.Method)
+	}
+}
+
+// deliverTo passes the messages of the process of session s to its client.
+// Requests the client cannot receive are answered with an error.
+func (b *bridge) deliverTo(s *session) func(*process, *message) {
+	return func(p *process, m *message) {
+		if s.deliver(m) {
+			return
+		}
+		if m.isRequest() {
+			_ = p.write(newErrorMessage(m.ID, codeInternalError, "Client has no open stream"))
+			return
+		}
+		p.log.Debug("dropped message of mcp server", "method", m.Method)
+	}
+}
+
+// broadcast passes the notifications of a pooled process to every session.
+// Requests cannot be attributed to a session and are refused.
+func (b *bridge) broadcast(p *process, m *message) {
+	if m.isRequest() {
+		_ = p.write(newErrorMessage(m.ID, codeMethodNotFound, "Method not supported by shared MCP servers"))
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.sessions {
+		s.deliver(m)
+	}
+}
+
+// pick returns the running pooled process with the fewest pending requests,
+// or nil.
+func (b *bridge) pick() *process {
+	var picked *process
+	for _, p := range b.processes(nil) {
+		if picked == nil || p.load() < picked.load() {
+			picked = p
+		}
+	}
+	return picked
+}
+
+// processes returns the process of session s, or the running pooled
+// processes.
+func (b *bridge) processes(s *session) []*process {
+	if s != nil && s.process != nil {
+		return []*process{s.process}
+	}
+	var processes []*process
+	for _, slot := range b.pool {
+		slot.mu.Lock()
+		if slot.process != nil {
+			processes = append(processes, slot.process)
+		}
+		slot.mu.Unlock()
+	}
+	return processes
+}
+
+func (b *bridge) start(onMessage func(*process, *message)) (*process, error) {
+	cmd := exec.Command(b.server.Command, b.server.Args...)
+	cmd.Dir = b.server.Dir
+	cmd.Env = b.env
+	return startProcess(cmd, b.log, onMessage)
+}
+
+// runPooled keeps a pooled process running until the context of the bridge
+// is done.
+func (b *bridge) runPooled(slot *slot) {
+	backoff := minRestartBackoff
+	for {
+		started := time.Now()
+		p, err := b.start(b.broadcast)
+		if err == nil {
+			if err = p.initialize(initializeTimeout); err == nil {
+				slot.mu.Lock()
+				slot.process = p
+				slot.mu.Unlock()
+
+				select {
+				case <-p.done:
+					err = p.err
+				case <-b.ctx.Done():
+				}
+
+				slot.mu.Lock()
+				slot.process = nil
+				slot.mu.Unlock()
+			}
+			p.stop()
+		}
+		if b.ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(started) > stableRunTime {
+			backoff = minRestartBackoff
+		}
+		b.log.Warn("restarting mcp server", "error", err, "backoff", backoff)
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxRestartBackoff)
+	}
+}
+
+// reapSessions closes idle sessions and sessions the admin API terminated. It
+// closes all sessions once the context of the bridge is done.
+func (b *bridge) reapSessions() {
+	interval := time.Minute
+	if b.sessionTimeout > 0 {
+		interval = min(interval, b.sessionTimeout/2)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.ctx.Done():
+			for _, s := range b.snapshot() {
+				b.close(s, "gateway stopped")
+			}
+			return
+		case <-ticker.C:
+		}
+
+		for _, s := range b.snapshot() {
+			if b.sessionTimeout > 0 && s.idle(b.sessionTimeout) {
+				b.close(s, "idle")
+				continue
+			}
+			record, err := b.registry.GetByID(b.ctx, s.record.ID)
+			if err == nil && record == nil {
+				b.close(s, "terminated")
+			}
+		}
+	}
+}
+
+func (b *bridge) snapshot() []*session {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sessions := make([]*session, 0, len(b.sessions))
+	for _, s := range b.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// close ends session s and stops its process.
+func (b *bridge) close(s *session, reason string) {
+	b.mu.Lock()
+	if b.sessions[s.id] != s {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.sessions, s.id)
+	b.mu.Unlock()
+
+	s.close()
+	if s.process != nil {
+		s.process.stop()
+	}
+
+	log := b.log.With(slog.String("session", s.id))
+	// The registry outlives the bridge
+	if err := b.registry.Delete(context.WithoutCancel(b.ctx), s.record); err != nil {
+		log.Error("failed to delete mcp session", "error", err)
+	}
+	log.Info("closed mcp session", "reason", reason)
+}
+
+func acceptsEventStream(c *fiber.Ctx) bool {
+	return strings.Contains(c.Get(fiber.HeaderAccept), "text/event-stream")
+}
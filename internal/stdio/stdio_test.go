@@ -0,0 +1,441 @@
+package stdio
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/config"
+	"github.com/schnurbus/go-mcp-gateway/internal/mcpsession"
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/tokenauth"
+	"github.com/schnurbus/go-mcp-gateway/internal/tokenvalidator"
+)
+
+// The test binary is the MCP server of the tests when this variable is set
+const testServerEnv = "STDIO_TEST_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testServerEnv) == "1" {
+		runTestServer()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runTestServer is a stdio MCP server. The tool echo returns its text with the
+// process id, working directory and environment, and reports progress. The
+// tool notify sends a list changed notification, crash exits.
+func runTestServer() {
+	out := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var m message
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "handling %s\n", m.Method)
+		if !m.isRequest() {
+			continue
+		}
+
+		var result any = map[string]any{}
+		switch m.Method {
+		case "initialize":
+			result = map[string]any{
+				"protocolVersion": protocolVersion,
+				"capabilities":    map[string]any{"tools": map[string]any{"listChanged": true}},
+				"serverInfo":      map[string]string{"name": "test", "version": "1.0.0"},
+			}
+		case "tools/call":
+			var params struct {
+				Name      string            `json:"name"`
+				Arguments map[string]string `json:"arguments"`
+				Meta      struct {
+					ProgressToken json.RawMessage `json:"progressToken"`
+				} `json:"_meta"`
+			}
+			_ = json.Unmarshal(m.Params, &params)
+			switch params.Name {
+			case "crash":
+				os.Exit(1)
+			case "notify":
+				_ = out.Encode(&message{JSONRPC: "2.0", Method: "notifications/tools/list_changed"})
+			case "echo":
+				if params.Meta.ProgressToken != nil {
+					progress, _ := json.Marshal(map[string]any{"progressToken": params.Meta.ProgressToken, "progress": 1})
+					_ = out.Encode(&message{JSONRPC: "2.0", Method: "notifications/progress", Params: progress})
+				}
+			}
+			dir, _ := os.Getwd()
+			result = map[string]any{
+				"text":     params.Arguments["text"],
+				"pid":      os.Getpid(),
+				"dir":      dir,
+				"greeting": os.Getenv("GREETING"),
+			}
+		}
+		resultJSON, _ := json.Marshal(result)
+		_ = out.Encode(&message{JSONRPC: "2.0", ID: m.ID, Result: resultJSON})
+	}
+}
+
+func newTestServer(t *testing.T, mode string, idleTimeout time.Duration) *config.StdioConfig {
+	t.Helper()
+	return &config.StdioConfig{
+		Command:     os.Args[0],
+		Env:         map[string]string{testServerEnv: "1", "GREETING": "hello"},
+		Dir:         t.TempDir(),
+		Mode:        mode,
+		PoolSize:    1,
+		IdleTimeout: &idleTimeout,
+	}
+}
+
+// serveTestBridge serves the bridge at /git/mcp. The subject of the request is
+// taken from the Authorization header.
+func serveTestBridge(t *testing.T, server *config.StdioConfig) (string, *mcpsession.Registry) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	sessions := mcpsession.NewRegistry(rdb)
+	return serveTestReplica(t, server, sessions), sessions
+}
+
+// serveTestReplica serves another bridge sharing the registry sessions, like
+// another gateway replica.
+func serveTestReplica(t *testing.T, server *config.StdioConfig, sessions *mcpsession.Registry) string {
+	t.Helper()
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(tokenauth.LocalsKey, &tokenvalidator.Principal{
+			Subject: strings.TrimPrefix(c.Get("Authorization"), "Bearer "),
+		})
+		return c.Next()
+	})
+	app.All("/git/mcp", New(t.Context(), Config{
+		Server:      server,
+		Sessions:    sessions,
+		IdleTimeout: 5 * time.Second,
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = app.Listener(ln) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	return "http://" + ln.Addr().String() + "/git/mcp"
+}
+
+type testClient struct {
+	t          *testing.T
+	gatewayURL string
+	user       string
+	sessionID  string
+}
+
+func (tc *testClient) send(method, accept, body string) *http.Response {
+	tc.t.Helper()
+	req, _ := http.NewRequest(method, tc.gatewayURL, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+tc.user)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+	if tc.sessionID != "" {
+		req.Header.Set(mcpsession.Header, tc.sessionID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	return resp
+}
+
+// call sends a request and returns the JSON response.
+func (tc *testClient) call(body string) (int, map[string]any) {
+	tc.t.Helper()
+	resp := tc.send("POST", "application/json", body)
+	defer resp.Body.Close()
+
+	var response map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&response)
+	return resp.StatusCode, response
+}
+
+func (tc *testClient) initialize() map[string]any {
+	tc.t.Helper()
+	resp := tc.send("POST", "application/json, text/event-stream",
+		`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		tc.t.Fatalf("initialize: expected status 200, got %d", resp.StatusCode)
+	}
+	tc.sessionID = resp.Header.Get(mcpsession.Header)
+	if tc.sessionID == "" {
+		tc.t.Fatal("initialize: expected a session id")
+	}
+
+	events := readEvents(tc.t, bufio.NewReader(resp.Body), 1)
+	if status, _ := tc.call(`{"jsonrpc":"2.0","method":"notifications/initialized"}`); status != http.StatusAccepted {
+		tc.t.Fatalf("initialized: expected status 202, got %d", status)
+	}
+	return events[0]
+}
+
+// readEvents reads n SSE events and returns their messages.
+func readEvents(t *testing.T, r *bufio.Reader, n int) []map[string]any {
+	t.Helper()
+	var events []map[string]any
+	for len(events) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expected %d events, got %d: %v", n, len(events), err)
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			var event map[string]any
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func result(t *testing.T, response map[string]any) map[string]any {
+	t.Helper()
+	result, ok := response["result"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected a result, got %v", response)
+	}
+	return result
+}
+
+func TestNewSessionMode(t *testing.T) {
+	server := newTestServer(t, config.StdioModeSession, time.Minute)
+	gatewayURL, sessions := serveTestBridge(t, server)
+
+	alice := &testClient{t: t, gatewayURL: gatewayURL, user: "alice"}
+	initialized := alice.initialize()
+	if got := result(t, initialized)["serverInfo"]; got == nil {
+		t.Errorf("expected server info, got %v", initialized)
+	}
+
+	// Progress and the response are streamed with the ids of the client
+	resp := alice.send("POST", "application/json, text/event-stream",
+		`{"jsonrpc":"2.0","id":"a","method":"tools/call","params":{"name":"echo","arguments":{"text":"hi"},"_meta":{"progressToken":"p"}}}`)
+	events := readEvents(t, bufio.NewReader(resp.Body), 2)
+	resp.Body.Close()
+	if events[0]["method"] != "notifications/progress" || events[0]["params"].(map[string]any)["progressToken"] != "p" {
+		t.Errorf("expected progress with the token of the client, got %v", events[0])
+	}
+	if events[1]["id"] != "a" {
+		t.Errorf("expected response with the id of the client, got %v", events[1])
+	}
+	echo := result(t, events[1])
+	if echo["text"] != "hi" || echo["dir"] != server.Dir || echo["greeting"] != "hello" {
+		t.Errorf("unexpected result %v", echo)
+	}
+
+	// Every session has its own process
+	bob := &testClient{t: t, gatewayURL: gatewayURL, user: "bob"}
+	bob.initialize()
+	_, bobEcho := bob.call(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo"}}`)
+	if result(t, bobEcho)["pid"] == echo["pid"] {
+		t.Error("expected sessions to have their own process")
+	}
+
+	// Sessions of other users are not found
+	eve := &testClient{t: t, gatewayURL: gatewayURL, user: "eve", sessionID: alice.sessionID}
+	if status, _ := eve.call(`{"jsonrpc":"2.0","id":1,"method":"ping"}`); status != http.StatusNotFound {
+		t.Errorf("expected status 404 for the session of another user, got %d", status)
+	}
+
+	open, err := sessions.List(t.Context(), mcpsession.Owner{Subject: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 1 || open[0].SessionID != alice.sessionID || open[0].Route != "/git/mcp" {
+		t.Errorf("expected the session in the registry, got %v", open)
+	}
+
+	resp = alice.send("DELETE", "", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", resp.StatusCode)
+	}
+	if status, _ := alice.call(`{"jsonrpc":"2.0","id":1,"method":"ping"}`); status != http.StatusNotFound {
+		t.Errorf("expected status 404 for the deleted session, got %d", status)
+	}
+	if open, _ := sessions.List(t.Context(), mcpsession.Owner{Subject: "alice"}); len(open) != 0 {
+		t.Errorf("expected the session to be deleted from the registry, got %v", open)
+	}
+}
+
+func TestNewOtherReplica(t *testing.T) {
+	server := newTestServer(t, config.StdioModeSession, time.Minute)
+	gatewayURL, sessions := serveTestBridge(t, server)
+	otherURL := serveTestReplica(t, server, sessions)
+
+	alice := &testClient{t: t, gatewayURL: gatewayURL, user: "alice"}
+	alice.initialize()
+	open, err := sessions.List(t.Context(), mcpsession.Owner{Subject: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 1 || open[0].Target != replica {
+		t.Errorf("expected the session registered with the replica, got %v", open)
+	}
+
+	// The other replica does not run the process of the session
+	other := &testClient{t: t, gatewayURL: otherURL, user: "alice", sessionID: alice.sessionID}
+	resp := other.send("POST", "application/json", `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound || !strings.Contains(string(body), "initialize") {
+		t.Errorf("expected status 404 asking to initialize, got %d: %s", resp.StatusCode, body)
+	}
+
+	// The session keeps working on its replica, and a new one on the other
+	if status, _ := alice.call(`{"jsonrpc":"2.0","id":2,"method":"ping"}`); status != http.StatusOK {
+		t.Errorf("expected status 200 on the replica of the session, got %d", status)
+	}
+	other.sessionID = ""
+	other.initialize()
+	if status, _ := other.call(`{"jsonrpc":"2.0","id":3,"method":"ping"}`); status != http.StatusOK {
+		t.Errorf("expected status 200 for the new session, got %d", status)
+	}
+}
+
+func TestNewPoolMode(t *testing.T) {
+	gatewayURL, _ := serveTestBridge(t, newTestServer(t, config.StdioModePool, time.Minute))
+
+	// The pool starts in the background
+	alice := &testClient{t: t, gatewayURL: gatewayURL, user: "alice"}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp := alice.send("POST", "application/json", `{"jsonrpc":"2.0","id":0,"method":"initialize","params":{}}`)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !strings.Contains(string(body), "unavailable") {
+			alice.sessionID = resp.Header.Get(mcpsession.Header)
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("pool did not start")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	bob := &testClient{t: t, gatewayURL: gatewayURL, user: "bob"}
+	bob.initialize()
+
+	// Both sessions share the process and use the same request id
+	_, aliceEcho := alice.call(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{"text":"alice"}}}`)
+	_, bobEcho := bob.call(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo","arguments":{"text":"bob"}}}`)
+	if aliceEcho["id"] != 1.0 || result(t, aliceEcho)["text"] != "alice" || bobEcho["id"] != 1.0 || result(t, bobEcho)["text"] != "bob" {
+		t.Errorf("expected the responses of each session, got %v and %v", aliceEcho, bobEcho)
+	}
+	if result(t, aliceEcho)["pid"] != result(t, bobEcho)["pid"] {
+		t.Error("expected the sessions to share the process")
+	}
+
+	// Notifications of the shared process go to every session
+	streams := map[string]*bufio.Reader{}
+	for _, tc := range []*testClient{alice, bob} {
+		resp := tc.send("GET", "text/event-stream", "")
+		t.Cleanup(func() { resp.Body.Close() })
+		streams[tc.user] = bufio.NewReader(resp.Body)
+	}
+	alice.call(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"notify"}}`)
+	for user, r := range streams {
+		if events := readEvents(t, r, 1); events[0]["method"] != "notifications/tools/list_changed" {
+			t.Errorf("%s: expected list changed notification, got %v", user, events[0])
+		}
+	}
+
+	// A crashed process is restarted, the session survives
+	if _, crashed := alice.call(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"crash"}}`); crashed["error"] == nil {
+		t.Errorf("expected an error for the request the process crashed on, got %v", crashed)
+	}
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		_, response := alice.call(`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"echo"}}`)
+		if r, ok := response["result"].(map[string]any); ok {
+			if r["pid"] == result(t, aliceEcho)["pid"] {
+				t.Error("expected a new process")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("process was not restarted")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestNewSessionEnds(t *testing.T) {
+	testCases := []struct {
+		name string
+		end  func(tc *testClient, sessions *mcpsession.Registry)
+	}{
+		{
+			name: "crash",
+			end: func(tc *testClient, _ *mcpsession.Registry) {
+				if _, response := tc.call(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"crash"}}`); response["error"] == nil {
+					t.Errorf("expected an error, got %v", response)
+				}
+			},
+		},
+		{
+			name: "idle",
+			end: func(*testClient, *mcpsession.Registry) {
+				time.Sleep(500 * time.Millisecond)
+			},
+		},
+		{
+			name: "terminated",
+			end: func(tc *testClient, sessions *mcpsession.Registry) {
+				session, err := sessions.Get(t.Context(), "/git/mcp", tc.sessionID)
+				if err != nil || session == nil {
+					t.Fatalf("expected the session, got %v: %v", session, err)
+				}
+				if err := sessions.Terminate(t.Context(), session, ""); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			gatewayURL, sessions := serveTestBridge(t, newTestServer(t, config.StdioModeSession, 200*time.Millisecond))
+			tc := &testClient{t: t, gatewayURL: gatewayURL, user: "alice"}
+			tc.initialize()
+
+			testCase.end(tc, sessions)
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				status, _ := tc.call(`{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+				if status == http.StatusNotFound {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("expected status 404 once the session ended, got %d", status)
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package stdio
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// heartbeatInterval is how often an SSE comment is sent on quiet streams.
+const heartbeatInterval = 15 * time.Second
+
+var (
+	errStreamIdle    = errors.New("no message within the idle timeout")
+	errStreamTooLong = errors.New("stream reached its maximum duration")
+)
+
+// stream queues the messages of one HTTP response, the responses to the
+// requests of a POST or the standalone stream of a GET, while the response is
+// written.
+type stream struct {
+	mu      sync.Mutex
+	queue   []*message
+	pending int     // responses the stream waits for, 0 for standalone streams
+	calls   []*call // requests that were sent for the stream
+	closed  bool
+	ready   chan struct{} // signaled when messages were queued or closed
+}
+
+func newStream(pending int) *stream {
+	return &stream{pending: pending, ready: make(chan struct{}, 1)}
+}
+
+// push queues m. It reports false if the stream is closed. The stream closes
+// once the last response it waits for was queued.
+func (s *stream) push(m *message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.queue = append(s.queue, m)
+	if m.isResponse() && s.pending > 0 {
+		s.pending--
+		s.closed = s.pending == 0
+	}
+	s.signal()
+	return true
+}
+
+// drop stops waiting for a response that will not come.
+func (s *stream) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending > 0 {
+		s.pending--
+		s.closed = s.closed || s.pending == 0
+		s.signal()
+	}
+}
+
+func (s *stream) track(c *call) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, c)
+}
+
+func (s *stream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.signal()
+}
+
+// finish closes the stream and cancels the requests that were not answered.
+func (s *stream) finish() {
+	s.mu.Lock()
+	s.closed = true
+	calls := s.calls
+	s.calls = nil
+	s.mu.Unlock()
+
+	for _, c := range calls {
+		c.process.abandon(c)
+	}
+}
+
+// pop returns the queued messages and whether the stream is closed.
+func (s *stream) pop() ([]*message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := s.queue
+	s.queue = nil
+	return messages, s.closed
+}
+
+func (s *stream) signal() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// collect waits for the responses of the stream. Other messages are dropped,
+// clients that accept no event stream cannot receive them.
+func (s *stream) collect(idleTimeout, maxDuration time.Duration) ([]*message, error) {
+	idle, deadline := newTimer(idleTimeout), newTimer(maxDuration)
+	defer idle.stop()
+	defer deadline.stop()
+
+	var responses []*message
+	for {
+		messages, closed := s.pop()
+		for _, m := range messages {
+			if m.isResponse() {
+				responses = append(responses, m)
+			}
+		}
+		if closed {
+			return responses, nil
+		}
+		if len(messages) > 0 {
+			idle.reset()
+		}
+
+		select {
+		case <-s.ready:
+		case <-idle.c():
+			return nil, errStreamIdle
+		case <-deadline.c():
+			return nil, errStreamTooLong
+		}
+	}
+}
+
+// writeEvents writes the messages of s as SSE events and flushes each batch.
+// Quiet streams get a heartbeat comment. It returns when s is closed, a
+// timeout ends the stream, or the client cannot be written to anymore.
+func writeEvents(w *bufio.Writer, s *stream, idleTimeout, maxDuration time.Duration) error {
+	idle, deadline := newTimer(idleTimeout), newTimer(maxDuration)
+	defer idle.stop()
+	defer deadline.stop()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	// The response headers are only sent with the first data
+	if _, err := w.WriteString(": stream open\n\n"); err != nil {
+		return err
+	}
+
+	for {
+		messages, closed := s.pop()
+		for _, m := range messages {
+			data, err := json.Marshal(m)
+			if err != nil {
+				return err
+			}
+			if _, err := w.WriteString("event: message\ndata: " + string(data) + "\n\n"); err != nil {
+				return err
+			}
+		}
+		if len(messages) > 0 {
+			idle.reset()
+			heartbeat.Reset(heartbeatInterval)
+		}
+		// Flush fails once the client disconnected
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if closed {
+			return nil
+		}
+
+		select {
+		case <-s.ready:
+		case <-heartbeat.C:
+			if _, err := w.WriteString(": keepalive\n\n"); err != nil {
+				return err
+			}
+		case <-idle.c():
+			return errStreamIdle
+		case <-deadline.c():
+			return errStreamTooLong
+		}
+	}
+}
+
+// timer is a time.Timer that never fires when its duration is zero.
+type timer struct {
+	d time.Duration
+	t *time.Timer
+}
+
+func newTimer(d time.Duration) *timer {
+	t := &timer{d: d}
+	if d > 0 {
+		t.t = time.NewTimer(d)
+	}
+	return t
+}
+
+func (t *timer) c() <-chan time.Time {
+	if t.t == nil {
+		return nil
+	}
+	return t.t.C
+}
+
+func (t *timer) reset() {
+	if t.t != nil {
+		t.t.Reset(t.d)
+	}
+}
+
+func (t *timer) stop() {
+	if t.t != nil {
+		t.t.Stop()
+	}
+}
@@ -14,6 +14,7 @@ const (
 	OAuthClientTTL         = 90 * 24 * time.Hour
 	SessionTTL             = 7 * 24 * time.Hour
 	ResourceAccessTokenTTL = 30 * 24 * time.Hour
+	MCPSessionTTL          = 24 * time.Hour
 )
 
 type Store struct {
@@ -42,6 +43,32 @@ func (s *Store) Set(ctx context.Context, key string, value any) error {
 	return s.rdb.Set(ctx, s.prefix+key, value, s.ttl).Err()
 }
 
+func (s *Store) SetWithTTL(ctx context.Context, key string, value any, ttl time.Duration) error {
+	return s.rdb.Set(ctx, s.prefix+key, value, ttl).Err()
+}
+
+// Expire resets the TTL of key to the TTL of the store.
+func (s *Store) Expire(ctx context.Context, key string) error {
+	return s.rdb.Expire(ctx, s.prefix+key, s.ttl).Err()
+}
+
 func (s *Store) Del(ctx context.Context, key string) error {
 	return s.rdb.Del(ctx, s.prefix+key).Err()
 }
+
+// SAdd adds members to the set at key and resets its TTL.
+func (s *Store) SAdd(ctx context.Context, key string, members ...any) error {
+	pipe := s.rdb.TxPipeline()
+	pipe.SAdd(ctx, s.prefix+key, members...)
+	pipe.Expire(ctx, s.prefix+key, s.ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (s *Store) SMembers(ctx context.Context, key string) ([]string, error) {
+	return s.rdb.SMembers(ctx, s.prefix+key).Result()
+}
+
+func (s *Store) SRem(ctx context.Context, key string, members ...any) error {
+	return s.rdb.SRem(ctx, s.prefix+key, members...).Err()
+}
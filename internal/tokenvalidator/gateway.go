@@ -0,0 +1,59 @@
+package tokenvalidator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/schnurbus/go-mcp-gateway/internal/auth"
+)
+
+type gatewayValidator struct {
+	auth     *auth.Auth
+	resource string
+}
+
+// NewGateway accepts only access tokens issued by the gateway that are valid
+// for resource. The MCP server receives the upstream access token the gateway
+// token is mapped to.
+func NewGateway(a *auth.Auth, resource string) TokenValidator {
+	return &gatewayValidator{
+		auth:     a,
+		resource: resource,
+	}
+}
+
+func (v *gatewayValidator) Validate(ctx context.Context, token string) (*Principal, error) {
+	accessToken, authErr := v.auth.GetAccessToken(ctx, token)
+	if authErr != nil {
+		if authErr.Code == auth.ServerError {
+			return nil, fmt.Errorf("failed to get access token: %s", authErr.Description)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, authErr.Description)
+	}
+
+	if accessToken.Resource != "" && accessToken.Resource != v.resource {
+		return nil, fmt.Errorf("%w: access token is not valid for this resource", ErrInvalidToken)
+	}
+
+	grant, authErr := v.auth.UpstreamGrant(ctx, accessToken)
+	if authErr != nil {
+		if authErr.Code == auth.InvalidGrant {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidToken, authErr.Description)
+		}
+		return nil, fmt.Errorf("failed to get upstream access token: %s", authErr.Description)
+	}
+
+	return &Principal{
+		Provider:       accessToken.Provider,
+		Subject:        accessToken.UID,
+		Email:          accessToken.Email,
+		Name:           accessToken.Name,
+		ClientID:       accessToken.ClientID,
+		Scopes:         strings.Fields(accessToken.Scope),
+		ExpiresAt:      time.Unix(accessToken.ExpiresAt, 0),
+		UpstreamToken:  grant.AccessToken,
+		UpstreamScopes: grant.Scopes,
+	}, nil
+}
@@ -0,0 +1,114 @@
+package tokenvalidator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/auth"
+	"github.com/schnurbus/go-mcp-gateway/internal/vault"
+)
+
+func TestGateway(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	key, _ := vault.GenerateKey()
+	v, err := vault.NewVault(&vault.VaultConfig{Keys: [][]byte{key}}, rdb)
+	if err != nil {
+		t.Fatalf("failed to create vault: %v", err)
+	}
+	a := auth.NewAuth(&auth.AuthConfig{
+		BaseURL:           "http://localhost:8080",
+		AccessTokenFormat: auth.AccessTokenFormatOpaque,
+		Vault:             v,
+	}, rdb)
+	ctx := context.Background()
+
+	tokens, authErr := a.IssueTokens(ctx, &auth.TokenGrant{
+		UID:                 "12345",
+		Email:               "user@example.com",
+		Provider:            "github",
+		ClientID:            "client-a",
+		Resource:            "http://localhost:8080/calc/mcp",
+		UpstreamAccessToken: "upstream-access-token",
+		UpstreamScopes:      []string{"openid", "drive.readonly"},
+	})
+	if authErr != nil {
+		t.Fatalf("failed to issue tokens: %v", authErr)
+	}
+
+	principal, err := NewGateway(a, "http://localhost:8080/calc/mcp").Validate(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if principal.Provider != "github" || principal.Subject != "12345" || principal.ClientID != "client-a" || principal.UpstreamToken != "upstream-access-token" {
+		t.Errorf("unexpected principal: %+v", principal)
+	}
+	if missing := principal.MissingUpstreamScopes([]string{"drive.readonly", "gmail.readonly"}); len(missing) != 1 || missing[0] != "gmail.readonly" {
+		t.Errorf("expected missing 'gmail.readonly', got %v", missing)
+	}
+
+	if _, err := NewGateway(a, "http://localhost:8080/files/mcp").Validate(ctx, tokens.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for other resource, got %v", err)
+	}
+	if _, err := NewGateway(a, "http://localhost:8080/calc/mcp").Validate(ctx, "upstream-access-token"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for upstream token, got %v", err)
+	}
+}
+
+func TestGateway_Scopes(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	key, _ := vault.GenerateKey()
+	v, err := vault.NewVault(&vault.VaultConfig{Keys: [][]byte{key}}, rdb)
+	if err != nil {
+		t.Fatalf("failed to create vault: %v", err)
+	}
+	a := auth.NewAuth(&auth.AuthConfig{
+		BaseURL:           "http://localhost:8080",
+		AccessTokenFormat: auth.AccessTokenFormatOpaque,
+		Vault:             v,
+	}, rdb)
+	ctx := context.Background()
+	validator := NewGateway(a, "http://localhost:8080/calc/mcp")
+
+	testCases := []struct {
+		name     string
+		scope    string
+		expected bool
+	}{
+		{name: "granted scope", scope: "mcp:read mcp:write", expected: true},
+		{name: "other scope", scope: "mcp:read", expected: false},
+		{name: "no scope", scope: "", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tokens, authErr := a.IssueTokens(ctx, &auth.TokenGrant{
+				UID:                 "12345",
+				ClientID:            "client-a",
+				Resource:            "http://localhost:8080/calc/mcp",
+				Scope:               tc.scope,
+				UpstreamAccessToken: "upstream-access-token",
+			})
+			if authErr != nil {
+				t.Fatalf("failed to issue tokens: %v", authErr)
+			}
+			if tokens.Scope != tc.scope {
+				t.Errorf("expected granted scope %q in token response, got %q", tc.scope, tokens.Scope)
+			}
+
+			principal, err := validator.Validate(ctx, tokens.AccessToken)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := principal.HasScopes([]string{"mcp:write"}); got != tc.expected {
+				t.Errorf("expected HasScopes(mcp:write) %v, got %v with scopes %v", tc.expected, got, principal.Scopes)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package tokenvalidator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/schnurbus/go-mcp-gateway/internal/middleware/googletokenvalidator"
+)
+
+type googleValidator struct {
+	clientID string
+	cache    *googletokenvalidator.Cache
+}
+
+// NewGoogle validates Google access tokens issued to clientID with Google's
+// tokeninfo endpoint. cache is optional.
+func NewGoogle(clientID string, cache *googletokenvalidator.Cache) TokenValidator {
+	return &googleValidator{
+		clientID: clientID,
+		cache:    cache,
+	}
+}
+
+func (v *googleValidator) Validate(ctx context.Context, token string) (*Principal, error) {
+	var tokenInfo *googletokenvalidator.TokenInfoResponse
+	var err error
+	if v.cache != nil {
+		tokenInfo, err = v.cache.TokenInfo(ctx, token)
+	} else {
+		tokenInfo, err = googletokenvalidator.FetchTokenInfo(token)
+	}
+	if err == nil {
+		err = googletokenvalidator.CheckTokenInfo(tokenInfo, v.clientID)
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, googletokenvalidator.ErrTokenExpired):
+		return nil, fmt.Errorf("%w: %w", ErrTokenExpired, err)
+	case errors.Is(err, googletokenvalidator.ErrInvalidToken),
+		errors.Is(err, googletokenvalidator.ErrInvalidAud),
+		errors.Is(err, googletokenvalidator.ErrDecode):
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	default:
+		return nil, err
+	}
+
+	// The token is the upstream Google access token itself
+	scopes := strings.Fields(tokenInfo.Scope)
+	return &Principal{
+		Provider:       "google",
+		Subject:        tokenInfo.Sub,
+		Email:          tokenInfo.Email,
+		Scopes:         scopes,
+		ClientID:       tokenInfo.Azp,
+		ExpiresAt:      time.Time(tokenInfo.Exp),
+		UpstreamScopes: scopes,
+	}, nil
+}
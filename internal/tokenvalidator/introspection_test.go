@@ -0,0 +1,80 @@
+package tokenvalidator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIntrospection(t *testing.T) {
+	introspectionServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "gateway" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.FormValue("token") {
+		case "valid-token":
+			json.NewEncoder(w).Encode(map[string]any{
+				"active":    true,
+				"sub":       "12345",
+				"scope":     "mcp:read",
+				"client_id": "client-a",
+				"aud":       []string{"http://localhost:8080/calc/mcp"},
+				"exp":       time.Now().Add(time.Hour).Unix(),
+			})
+		case "other-audience":
+			json.NewEncoder(w).Encode(map[string]any{
+				"active": true,
+				"aud":    "http://localhost:8080/files/mcp",
+			})
+		case "no-audience":
+			json.NewEncoder(w).Encode(map[string]any{
+				"active": true,
+				"sub":    "12345",
+			})
+		default:
+			json.NewEncoder(w).Encode(map[string]any{"active": false})
+		}
+	}))
+	defer introspectionServer.Close()
+
+	v, err := NewIntrospection(&IntrospectionConfig{
+		URL:          introspectionServer.URL,
+		ClientID:     "gateway",
+		ClientSecret: "secret",
+		Audience:     "http://localhost:8080/calc/mcp",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	principal, err := v.Validate(ctx, "valid-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if principal.Provider != introspectionServer.URL || principal.Subject != "12345" || principal.ClientID != "client-a" || !principal.HasScopes([]string{"mcp:read"}) {
+		t.Errorf("unexpected principal: %+v", principal)
+	}
+
+	if _, err := v.Validate(ctx, "unknown-token"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for inactive token, got %v", err)
+	}
+	if _, err := v.Validate(ctx, "other-audience"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for other audience, got %v", err)
+	}
+	if _, err := v.Validate(ctx, "no-audience"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected ErrInvalidToken for token without audience, got %v", err)
+	}
+
+	// Failing to authenticate at the endpoint is not a verdict on the token
+	v, _ = NewIntrospection(&IntrospectionConfig{URL: introspectionServer.URL})
+	if _, err := v.Validate(ctx, "valid-token"); err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected introspection failure, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package tokenvalidator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/schnurbus/go-mcp-gateway/internal/auth"
+	"github.com/schnurbus/go-mcp-gateway/internal/keyset"
+)
+
+// jwksRefreshInterval limits how often the JWKS is fetched again when a token
+// is signed by an unknown key.
+const jwksRefreshInterval = time.Minute
+
+var supportedAlgorithms = []jose.SignatureAlgorithm{jose.RS256, jose.ES256, jose.PS256, jose.EdDSA}
+
+// JWTConfig configures the validation of JWT access tokens (RFC 9068).
+type JWTConfig struct {
+	// Issuer is the expected iss claim.
+	Issuer string
+
+	// Audience is the expected aud claim, typically the resource of the route.
+	Audience string
+
+	// JWKSURL is the JWKS of the issuer. If empty, KeySet is used.
+	JWKSURL string
+
+	// KeySet verifies tokens signed by the gateway itself.
+	KeySet *keyset.KeySet
+}
+
+type jwtValidator struct {
+	issuer   string
+	audience string
+	jwksURL  string
+	keySet   *keyset.KeySet
+
+	mu        sync.Mutex
+	jwks      *jose.JSONWebKeySet
+	fetchedAt time.Time
+}
+
+type jwtClaims struct {
+	jwt.Claims
+	Email           string `json:"email,omitempty"`
+	Name            string `json:"name,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+	ClientID        string `json:"client_id,omitempty"`
+	AuthorizedParty string `json:"azp,omitempty"`
+}
+
+// NewJWT validates JWT access tokens locally against the keys of the issuer.
+func NewJWT(config *JWTConfig) (TokenValidator, error) {
+	if config.Issuer == "" {
+		return nil, fmt.Errorf("issuer is required")
+	}
+	if config.JWKSURL == "" && config.KeySet == nil {
+		return nil, fmt.Errorf("jwks url or key set is required")
+	}
+
+	return &jwtValidator{
+		issuer:   config.Issuer,
+		audience: config.Audience,
+		jwksURL:  config.JWKSURL,
+		keySet:   config.KeySet,
+	}, nil
+}
+
+func (v *jwtValidator) Validate(ctx context.Context, token string) (*Principal, error) {
+	var claims jwtClaims
+	if err := v.verify(ctx, token, &claims); err != nil {
+		return nil, err
+	}
+
+	expected := jwt.Expected{
+		Issuer: v.issuer,
+		Time:   time.Now(),
+	}
+	if v.audience != "" {
+		expected.AnyAudience = jwt.Audience{v.audience}
+	}
+	if err := claims.ValidateWithLeeway(expected, jwt.DefaultLeeway); err != nil {
+		if errors.Is(err, jwt.ErrExpired) {
+			return nil, fmt.Errorf("%w: %w", ErrTokenExpired, err)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if claims.Expiry == nil {
+		return nil, fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
+	}
+
+	clientID := claims.ClientID
+	if clientID == "" {
+		clientID = claims.AuthorizedParty
+	}
+
+	return &Principal{
+		Provider:  claims.Issuer,
+		Subject:   claims.Subject,
+		Email:     claims.Email,
+		Name:      claims.Name,
+		Scopes:    strings.Fields(claims.Scope),
+		ClientID:  clientID,
+		ExpiresAt: claims.Expiry.Time(),
+	}, nil
+}
+
+// verify checks the signature of token. Tokens of the gateway itself must be
+// access tokens; identity assertions are signed with the same keys and for the
+// same audience, so they are rejected by their typ.
+func (v *jwtValidator) verify(ctx context.Context, token string, claims *jwtClaims) error {
+	if v.jwksURL == "" {
+		if err := v.keySet.Verify(token, auth.AccessTokenType, claims); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+		return nil
+	}
+
+	parsed, err := jwt.ParseSigned(token, supportedAlgorithms)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if len(parsed.Headers) != 1 {
+		return fmt.Errorf("%w: expected exactly one signature", ErrInvalidToken)
+	}
+	if keyset.HasType(parsed.Headers[0], auth.IdentityAssertionType) {
+		return fmt.Errorf("%w: identity assertions are not access tokens", ErrInvalidToken)
+	}
+
+	key, err := v.key(ctx, parsed.Headers[0].KeyID)
+	if err != nil {
+		return err
+	}
+	if err := parsed.Claims(key.Key, claims); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return nil
+}
+
+// key returns the key with kid from the JWKS, fetching the JWKS again if the
+// key is unknown so that keys rotated in by the issuer are picked up.
+func (v *jwtValidator) key(ctx context.Context, kid string) (*jose.JSONWebKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.jwks != nil {
+		if keys := v.jwks.Key(kid); len(keys) > 0 {
+			return &keys[0], nil
+		}
+		if time.Since(v.fetchedAt) < jwksRefreshInterval {
+			return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+		}
+	}
+
+	jwks, err := fetchJWKS(ctx, v.jwksURL)
+	if err != nil {
+		return nil, err
+	}
+	v.jwks = jwks
+	v.fetchedAt = time.Now()
+
+	if keys := v.jwks.Key(kid); len(keys) > 0 {
+		return &keys[0], nil
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+}
+
+func fetchJWKS(ctx context.Context, jwksURL string) (*jose.JSONWebKeySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code fetching jwks: %d", resp.StatusCode)
+	}
+
+	var jwks jose.JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("failed to decode jwks: %w", err)
+	}
+	return &jwks, nil
+}
@@ -0,0 +1,228 @@
+package tokenvalidator
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/auth"
+	"github.com/schnurbus/go-mcp-gateway/internal/keyset"
+	"github.com/schnurbus/go-mcp-gateway/internal/vault"
+)
+
+func newTestKeySet(t *testing.T) *keyset.KeySet {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := keyset.ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := keyset.New([]jose.JSONWebKey{jwk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func signTestToken(t *testing.T, ks *keyset.KeySet, issuer, audience string, expiry time.Time) string {
+	t.Helper()
+	token, err := ks.Sign(auth.AccessTokenType, &jwtClaims{
+		Claims: jwt.Claims{
+			Issuer:   issuer,
+			Subject:  "12345",
+			Audience: jwt.Audience{audience},
+			Expiry:   jwt.NewNumericDate(expiry),
+		},
+		Email:    "user@example.com",
+		Scope:    "mcp:read mcp:write",
+		ClientID: "client-a",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestJWT_RemoteJWKS(t *testing.T) {
+	ks := newTestKeySet(t)
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ks.JWKS())
+	}))
+	defer jwksServer.Close()
+
+	v, err := NewJWT(&JWTConfig{
+		Issuer:   "https://issuer.example.com",
+		Audience: "http://localhost:8080/calc/mcp",
+		JWKSURL:  jwksServer.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	principal, err := v.Validate(ctx, signTestToken(t, ks, "https://issuer.example.com", "http://localhost:8080/calc/mcp", time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if principal.Provider != "https://issuer.example.com" || principal.Subject != "12345" || principal.Email != "user@example.com" || principal.ClientID != "client-a" {
+		t.Errorf("unexpected principal: %+v", principal)
+	}
+	if !principal.HasScopes([]string{"mcp:write"}) {
+		t.Errorf("expected scope mcp:write, got %v", principal.Scopes)
+	}
+
+	testCases := []struct {
+		name     string
+		token    string
+		expected error
+	}{
+		{
+			name:     "expired",
+			token:    signTestToken(t, ks, "https://issuer.example.com", "http://localhost:8080/calc/mcp", time.Now().Add(-time.Hour)),
+			expected: ErrTokenExpired,
+		},
+		{
+			name:     "other issuer",
+			token:    signTestToken(t, ks, "https://other.example.com", "http://localhost:8080/calc/mcp", time.Now().Add(time.Hour)),
+			expected: ErrInvalidToken,
+		},
+		{
+			name:     "other audience",
+			token:    signTestToken(t, ks, "https://issuer.example.com", "http://localhost:8080/files/mcp", time.Now().Add(time.Hour)),
+			expected: ErrInvalidToken,
+		},
+		{
+			name:     "unknown key",
+			token:    signTestToken(t, newTestKeySet(t), "https://issuer.example.com", "http://localhost:8080/calc/mcp", time.Now().Add(time.Hour)),
+			expected: ErrInvalidToken,
+		},
+		{
+			name:     "malformed",
+			token:    "not-a-jwt",
+			expected: ErrInvalidToken,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := v.Validate(ctx, tc.token); !errors.Is(err, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestJWT_LocalKeySet(t *testing.T) {
+	ks := newTestKeySet(t)
+	v, err := NewJWT(&JWTConfig{
+		Issuer:   "http://localhost:8080",
+		Audience: "http://localhost:8080/calc/mcp",
+		KeySet:   ks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.Validate(context.Background(), signTestToken(t, ks, "http://localhost:8080", "http://localhost:8080/calc/mcp", time.Now().Add(time.Hour))); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestJWT_AccessTokensAndIdentityAssertionsAreNotInterchangeable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	key, _ := vault.GenerateKey()
+	vlt, err := vault.NewVault(&vault.VaultConfig{Keys: [][]byte{key}}, rdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := newTestKeySet(t)
+	a := auth.NewAuth(&auth.AuthConfig{
+		BaseURL:           "http://localhost:8080",
+		AccessTokenFormat: auth.AccessTokenFormatJWT,
+		KeySet:            ks,
+		Vault:             vlt,
+	}, rdb)
+	ctx := context.Background()
+
+	tokens, authErr := a.IssueTokens(ctx, &auth.TokenGrant{
+		UID:                 "12345",
+		ClientID:            "client-a",
+		Resource:            "http://localhost:8080/calc/mcp",
+		UpstreamAccessToken: "google-access-token",
+	})
+	if authErr != nil {
+		t.Fatalf("failed to issue tokens: %v", authErr)
+	}
+	assertion, err := a.SignIdentityAssertion(&auth.IdentityAssertion{
+		Subject:  "12345",
+		ClientID: "client-a",
+		Audience: "http://localhost:8080/calc/mcp",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ks.JWKS())
+	}))
+	defer jwksServer.Close()
+
+	local, err := NewJWT(&JWTConfig{
+		Issuer:   "http://localhost:8080",
+		Audience: "http://localhost:8080/calc/mcp",
+		KeySet:   ks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := NewJWT(&JWTConfig{
+		Issuer:   "http://localhost:8080",
+		Audience: "http://localhost:8080/calc/mcp",
+		JWKSURL:  jwksServer.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, v := range map[string]TokenValidator{"key set": local, "jwks": remote} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := v.Validate(ctx, tokens.AccessToken); err != nil {
+				t.Errorf("access token should be valid: %v", err)
+			}
+			if _, err := v.Validate(ctx, assertion); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("identity assertion must not be accepted as access token, got %v", err)
+			}
+		})
+	}
+
+	// MCP servers verify identity assertions against the gateway JWKS
+	var claims auth.IdentityAssertionClaims
+	if err := ks.Verify(assertion, auth.IdentityAssertionType, &claims); err != nil {
+		t.Errorf("identity assertion should verify: %v", err)
+	}
+	if err := ks.Verify(tokens.AccessToken, auth.IdentityAssertionType, &claims); !errors.Is(err, keyset.ErrUnexpectedType) {
+		t.Errorf("access token must not be accepted as identity assertion, got %v", err)
+	}
+}
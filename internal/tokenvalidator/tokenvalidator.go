@@ -0,0 +1,66 @@
+package tokenvalidator
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token is expired")
+)
+
+// Principal is the identity a validated access token was issued for.
+type Principal struct {
+	// Provider vouches for Subject: the upstream provider of gateway tokens,
+	// otherwise the issuer of the token. Subjects are only unique per
+	// provider.
+	Provider string
+
+	Subject   string
+	Email     string
+	Name      string
+	Scopes    []string
+	ClientID  string
+	ExpiresAt time.Time
+
+	// UpstreamToken replaces the bearer token when the request is forwarded
+	// to the MCP server. Empty forwards the bearer token unchanged.
+	UpstreamToken string
+
+	// UpstreamScopes are the scopes granted to the upstream Google access
+	// token the MCP server receives, empty if unknown.
+	UpstreamScopes []string
+}
+
+// HasScopes reports whether all of required were granted to the principal.
+func (p *Principal) HasScopes(required []string) bool {
+	for _, scope := range required {
+		if !slices.Contains(p.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// MissingUpstreamScopes returns the scopes of required that were not granted
+// to the upstream access token of the principal.
+func (p *Principal) MissingUpstreamScopes(required []string) []string {
+	var missing []string
+	for _, scope := range required {
+		if !slices.Contains(p.UpstreamScopes, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// TokenValidator validates bearer tokens presented to a proxy route.
+// Implementations return an error wrapping ErrTokenExpired for expired tokens
+// and ErrInvalidToken for any other token that is not accepted. Other errors
+// indicate that the token could not be checked.
+type TokenValidator interface {
+	Validate(ctx context.Context, token string) (*Principal, error)
+}
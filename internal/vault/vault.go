@@ -0,0 +1,327 @@
+package vault
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/logger"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider"
+	"github.com/schnurbus/go-mcp-gateway/internal/store"
+	"github.com/schnurbus/go-mcp-gateway/internal/utils"
+	"golang.org/x/oauth2"
+)
+
+// KeySize is the size of the AES-256 keys the vault encrypts with.
+const KeySize = 32
+
+var (
+	// ErrNotFound is returned for grants the vault does not hold, e.g.
+	// because they were revoked.
+	ErrNotFound = errors.New("upstream grant not found")
+
+	// ErrInvalidGrant is returned if the upstream access token expired and
+	// cannot be refreshed anymore.
+	ErrInvalidGrant = errors.New("upstream grant is no longer valid")
+)
+
+// Refresher refreshes an upstream access token at the provider called name.
+// Rejected refresh tokens must yield an error wrapping
+// provider.ErrInvalidGrant.
+type Refresher interface {
+	RefreshToken(ctx context.Context, name, refreshToken string) (*oauth2.Token, error)
+}
+
+type VaultConfig struct {
+	Keys          [][]byte // the first key encrypts, all keys decrypt
+	Refresher     Refresher
+	RefreshBefore time.Duration // refresh access tokens expiring this soon, default 1m
+	LockTTL       time.Duration // upper bound of a refresh, default 30s
+}
+
+// Vault keeps the upstream tokens of users encrypted in Redis and hands out
+// fresh upstream access tokens, refreshing them shortly before they expire.
+// Refreshes are serialized across gateway instances with a Redis lock, so an
+// upstream refresh token is never used twice at once.
+type Vault struct {
+	rdb           *redis.Client
+	aeads         []cipher.AEAD
+	refresher     Refresher
+	refreshBefore time.Duration
+	lockTTL       time.Duration
+	grantStore    *store.Store // key: grant key, value: encrypted grant
+}
+
+// Grant is the upstream authorization of a user for a client.
+type Grant struct {
+	Provider     string   `json:"provider,omitempty"`
+	AccessToken  string   `json:"access_token"`
+	RefreshToken string   `json:"refresh_token,omitempty"`
+	Expiry       int64    `json:"expiry,omitempty"` // Unix timestamp, 0 if the access token does not expire
+	Scopes       []string `json:"scopes,omitempty"` // granted scopes, empty if unknown
+}
+
+const (
+	lockPrefix   = "vault_lock:"
+	lockPollWait = 100 * time.Millisecond
+)
+
+// unlockScript deletes a lock only if it is still held by the caller.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func NewVault(config *VaultConfig, rdb *redis.Client) (*Vault, error) {
+	if len(config.Keys) == 0 {
+		return nil, fmt.Errorf("at least one vault key is required")
+	}
+
+	aeads := make([]cipher.AEAD, 0, len(config.Keys))
+	for i, key := range config.Keys {
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("vault key %d must be %d bytes, got %d", i, KeySize, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cipher: %w", err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gcm: %w", err)
+		}
+		aeads = append(aeads, aead)
+	}
+
+	refreshBefore := config.RefreshBefore
+	if refreshBefore == 0 {
+		refreshBefore = time.Minute
+	}
+	lockTTL := config.LockTTL
+	if lockTTL == 0 {
+		lockTTL = 30 * time.Second
+	}
+
+	return &Vault{
+		rdb:           rdb,
+		aeads:         aeads,
+		refresher:     config.Refresher,
+		refreshBefore: refreshBefore,
+		lockTTL:       lockTTL,
+		grantStore:    store.NewStore(rdb, "vault", store.OAuthRefreshTokenTTL),
+	}, nil
+}
+
+// ParseKeys decodes base64 encoded vault keys.
+func ParseKeys(encoded []string) ([][]byte, error) {
+	keys := make([][]byte, 0, len(encoded))
+	for i, e := range encoded {
+		key, err := base64.StdEncoding.DecodeString(e)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode vault key %d: %w", i, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// GenerateKey returns a random vault key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Key returns the vault key of the grant of user uid at the provider called
+// name for clientID. It does not reveal the user.
+func Key(name, uid, clientID string) string {
+	return utils.S256(name + "\x00" + uid + "\x00" + clientID)
+}
+
+// Put stores grant under key, replacing the previous grant. Providers omit
+// the refresh token when users authorize again, the previous refresh token
+// is kept then.
+func (v *Vault) Put(ctx context.Context, key string, grant *Grant) error {
+	if grant.RefreshToken == "" {
+		if previous, err := v.Get(ctx, key); err == nil && previous.RefreshToken != "" {
+			merged := *grant
+			merged.RefreshToken = previous.RefreshToken
+			grant = &merged
+		}
+	}
+
+	plaintext, err := json.Marshal(grant)
+	if err != nil {
+		return fmt.Errorf("failed to marshal grant: %w", err)
+	}
+
+	// The key is authenticated along with the grant, so encrypted grants
+	// cannot be swapped between users
+	aead := v.aeads[0]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	ciphertext := aead.Seal(nonce, nonce, plaintext, []byte(key))
+
+	return v.grantStore.Set(ctx, key, base64.StdEncoding.EncodeToString(ciphertext))
+}
+
+// Get returns the grant stored under key.
+func (v *Vault) Get(ctx context.Context, key string) (*Grant, error) {
+	encoded, err := v.grantStore.Get(ctx, key)
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get grant: %w", err)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode grant: %w", err)
+	}
+
+	for _, aead := range v.aeads {
+		if len(ciphertext) < aead.NonceSize() {
+			break
+		}
+		nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+		plaintext, err := aead.Open(nil, nonce, sealed, []byte(key))
+		if err != nil {
+			continue
+		}
+
+		var grant Grant
+		if err := json.Unmarshal(plaintext, &grant); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal grant: %w", err)
+		}
+		return &grant, nil
+	}
+
+	return nil, fmt.Errorf("failed to decrypt grant with any vault key")
+}
+
+// Touch extends the lifetime of the grant stored under key.
+func (v *Vault) Touch(ctx context.Context, key string) error {
+	return v.grantStore.Expire(ctx, key)
+}
+
+// Delete removes the grant stored under key.
+func (v *Vault) Delete(ctx context.Context, key string) error {
+	return v.grantStore.Del(ctx, key)
+}
+
+// Fresh returns the grant stored under key with a valid upstream access token.
+// Access tokens about to expire are refreshed first. If another instance is
+// refreshing the grant, it waits for the refreshed token.
+func (v *Vault) Fresh(ctx context.Context, key string) (*Grant, error) {
+	log := logger.FromContext(ctx)
+	deadline := time.Now().Add(v.lockTTL)
+
+	for {
+		grant, err := v.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if !v.needsRefresh(grant) {
+			return grant, nil
+		}
+		if grant.RefreshToken == "" {
+			if expired(grant) {
+				return nil, fmt.Errorf("%w: access token expired and cannot be refreshed", ErrInvalidGrant)
+			}
+			return grant, nil
+		}
+
+		lockToken := utils.RandString(16)
+		locked, err := v.rdb.SetNX(ctx, lockPrefix+key, lockToken, v.lockTTL).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock grant: %w", err)
+		}
+		if locked {
+			return v.refresh(ctx, key, lockToken)
+		}
+
+		// Another instance is refreshing the grant
+		if time.Now().After(deadline) {
+			if !expired(grant) {
+				return grant, nil
+			}
+			return nil, fmt.Errorf("timed out waiting for upstream token refresh")
+		}
+		log.Debug("Waiting for upstream token refresh")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollWait):
+		}
+	}
+}
+
+// refresh refreshes the grant stored under key while holding its lock.
+func (v *Vault) refresh(ctx context.Context, key, lockToken string) (*Grant, error) {
+	log := logger.FromContext(ctx)
+	defer func() {
+		if err := unlockScript.Run(ctx, v.rdb, []string{lockPrefix + key}, lockToken).Err(); err != nil {
+			log.Warn("Failed to unlock grant", "error", err)
+		}
+	}()
+
+	// The grant may have been refreshed since it was read
+	grant, err := v.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !v.needsRefresh(grant) {
+		return grant, nil
+	}
+
+	token, err := v.refresher.RefreshToken(ctx, grant.Provider, grant.RefreshToken)
+	if err != nil {
+		if errors.Is(err, provider.ErrInvalidGrant) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidGrant, err)
+		}
+		// Keep using the current access token while it is valid
+		if !expired(grant) {
+			log.Warn("Failed to refresh upstream token, using current token", "error", err)
+			return grant, nil
+		}
+		return nil, fmt.Errorf("failed to refresh upstream token: %w", err)
+	}
+
+	grant.AccessToken = token.AccessToken
+	grant.Expiry = 0
+	if !token.Expiry.IsZero() {
+		grant.Expiry = token.Expiry.Unix()
+	}
+	// Providers rotating refresh tokens invalidate the one just used
+	if token.RefreshToken != "" {
+		grant.RefreshToken = token.RefreshToken
+	}
+	if err := v.Put(ctx, key, grant); err != nil {
+		return nil, err
+	}
+
+	log.Info("Refreshed upstream token", "provider", grant.Provider)
+	return grant, nil
+}
+
+func (v *Vault) needsRefresh(grant *Grant) bool {
+	return grant.Expiry > 0 && time.Until(time.Unix(grant.Expiry, 0)) < v.refreshBefore
+}
+
+func expired(grant *Grant) bool {
+	return grant.Expiry > 0 && time.Now().Unix() >= grant.Expiry
+}
@@ -0,0 +1,228 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/schnurbus/go-mcp-gateway/internal/provider"
+	"golang.org/x/oauth2"
+)
+
+// fakeRefresher issues numbered access tokens and counts refreshes.
+type fakeRefresher struct {
+	calls   atomic.Int32
+	delay   time.Duration
+	invalid bool
+	rotate  bool // issue numbered refresh tokens
+}
+
+func (r *fakeRefresher) RefreshToken(ctx context.Context, name, refreshToken string) (*oauth2.Token, error) {
+	n := r.calls.Add(1)
+	time.Sleep(r.delay)
+	if r.invalid {
+		return nil, fmt.Errorf("%w: revoked", provider.ErrInvalidGrant)
+	}
+	token := &oauth2.Token{
+		AccessToken:  fmt.Sprintf("access-token-%d", n),
+		RefreshToken: refreshToken,
+		Expiry:       time.Now().Add(time.Hour),
+	}
+	if r.rotate {
+		token.RefreshToken = fmt.Sprintf("refresh-token-%d", n)
+	}
+	return token, nil
+}
+
+func newTestVault(t *testing.T, rdb *redis.Client, refresher Refresher, keys ...[]byte) *Vault {
+	t.Helper()
+	if len(keys) == 0 {
+		key, err := GenerateKey()
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		keys = [][]byte{key}
+	}
+	v, err := NewVault(&VaultConfig{Keys: keys, Refresher: refresher}, rdb)
+	if err != nil {
+		t.Fatalf("failed to create vault: %v", err)
+	}
+	return v
+}
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return mr, rdb
+}
+
+func TestVault_Encrypted(t *testing.T) {
+	mr, rdb := newTestRedis(t)
+	key, _ := GenerateKey()
+	v := newTestVault(t, rdb, &fakeRefresher{}, key)
+	ctx := context.Background()
+
+	grantKey := Key("google", "12345", "client-a")
+	if err := v.Put(ctx, grantKey, &Grant{AccessToken: "secret-access-token", RefreshToken: "secret-refresh-token"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	raw, err := mr.Get("vault:" + grantKey)
+	if err != nil {
+		t.Fatalf("expected grant in redis: %v", err)
+	}
+	if strings.Contains(raw, "secret") {
+		t.Error("grant should be encrypted at rest")
+	}
+
+	// Rotated keys still decrypt grants encrypted with the old key
+	newKey, _ := GenerateKey()
+	rotated := newTestVault(t, rdb, &fakeRefresher{}, newKey, key)
+	grant, err := rotated.Get(ctx, grantKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if grant.RefreshToken != "secret-refresh-token" {
+		t.Errorf("expected 'secret-refresh-token', got '%s'", grant.RefreshToken)
+	}
+
+	// Grants are bound to their key
+	mr.Set("vault:"+Key("google", "67890", "client-a"), raw)
+	if _, err := v.Get(ctx, Key("google", "67890", "client-a")); err == nil {
+		t.Error("expected error for grant copied to another key")
+	}
+
+	if _, err := v.Get(ctx, Key("google", "unknown", "client-a")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestVault_Fresh(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	refresher := &fakeRefresher{}
+	v := newTestVault(t, rdb, refresher)
+	ctx := context.Background()
+	grantKey := Key("google", "12345", "client-a")
+
+	// Fresh tokens are returned as they are
+	v.Put(ctx, grantKey, &Grant{AccessToken: "fresh", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour).Unix()})
+	if grant, err := v.Fresh(ctx, grantKey); err != nil || grant.AccessToken != "fresh" {
+		t.Errorf("expected 'fresh', got %+v, %v", grant, err)
+	}
+
+	// Tokens about to expire are refreshed
+	v.Put(ctx, grantKey, &Grant{AccessToken: "stale", RefreshToken: "refresh", Expiry: time.Now().Add(10 * time.Second).Unix()})
+	if grant, err := v.Fresh(ctx, grantKey); err != nil || grant.AccessToken != "access-token-1" {
+		t.Errorf("expected 'access-token-1', got %+v, %v", grant, err)
+	}
+	if grant, err := v.Fresh(ctx, grantKey); err != nil || grant.AccessToken != "access-token-1" {
+		t.Errorf("expected refreshed token to be stored, got %+v, %v", grant, err)
+	}
+
+	// Tokens without expiry are never refreshed
+	v.Put(ctx, grantKey, &Grant{AccessToken: "forever"})
+	if grant, err := v.Fresh(ctx, grantKey); err != nil || grant.AccessToken != "forever" {
+		t.Errorf("expected 'forever', got %+v, %v", grant, err)
+	}
+	if refresher.calls.Load() != 1 {
+		t.Errorf("expected 1 refresh, got %d", refresher.calls.Load())
+	}
+}
+
+func TestVault_PutKeepsRefreshToken(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	v := newTestVault(t, rdb, &fakeRefresher{})
+	ctx := context.Background()
+	grantKey := Key("google", "12345", "client-a")
+
+	v.Put(ctx, grantKey, &Grant{AccessToken: "first", RefreshToken: "refresh-1", Scopes: []string{"openid"}})
+
+	// Google omits the refresh token when users consent again
+	v.Put(ctx, grantKey, &Grant{AccessToken: "second", Scopes: []string{"openid", "drive.readonly"}})
+	grant, err := v.Get(ctx, grantKey)
+	if err != nil || grant.AccessToken != "second" || grant.RefreshToken != "refresh-1" || len(grant.Scopes) != 2 {
+		t.Errorf("expected new access token with previous refresh token, got %+v, %v", grant, err)
+	}
+
+	// New refresh tokens replace the previous one
+	v.Put(ctx, grantKey, &Grant{AccessToken: "third", RefreshToken: "refresh-2"})
+	if grant, err := v.Get(ctx, grantKey); err != nil || grant.RefreshToken != "refresh-2" {
+		t.Errorf("expected 'refresh-2', got %+v, %v", grant, err)
+	}
+}
+
+func TestVault_FreshRotatedRefreshToken(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	v := newTestVault(t, rdb, &fakeRefresher{rotate: true})
+	ctx := context.Background()
+	grantKey := Key("oidc", "12345", "client-a")
+
+	v.Put(ctx, grantKey, &Grant{AccessToken: "stale", RefreshToken: "refresh-token-0", Expiry: time.Now().Add(10 * time.Second).Unix()})
+	if _, err := v.Fresh(ctx, grantKey); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if grant, err := v.Get(ctx, grantKey); err != nil || grant.RefreshToken != "refresh-token-1" {
+		t.Errorf("expected rotated 'refresh-token-1' to be stored, got %+v, %v", grant, err)
+	}
+}
+
+func TestVault_FreshInvalidGrant(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	v := newTestVault(t, rdb, &fakeRefresher{invalid: true})
+	ctx := context.Background()
+	grantKey := Key("google", "12345", "client-a")
+
+	v.Put(ctx, grantKey, &Grant{AccessToken: "expired", RefreshToken: "revoked", Expiry: time.Now().Add(-time.Minute).Unix()})
+	if _, err := v.Fresh(ctx, grantKey); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("expected ErrInvalidGrant, got %v", err)
+	}
+}
+
+func TestVault_ConcurrentRefresh(t *testing.T) {
+	_, rdb := newTestRedis(t)
+	key, _ := GenerateKey()
+	refresher := &fakeRefresher{delay: 200 * time.Millisecond}
+	ctx := context.Background()
+	grantKey := Key("google", "12345", "client-a")
+
+	// Two gateway instances sharing Redis
+	replicas := []*Vault{
+		newTestVault(t, rdb, refresher, key),
+		newTestVault(t, rdb, refresher, key),
+	}
+	replicas[0].Put(ctx, grantKey, &Grant{AccessToken: "stale", RefreshToken: "refresh", Expiry: time.Now().Add(10 * time.Second).Unix()})
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			grant, err := replicas[i%2].Fresh(ctx, grantKey)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			tokens[i] = grant.AccessToken
+		}()
+	}
+	wg.Wait()
+
+	if refresher.calls.Load() != 1 {
+		t.Errorf("expected 1 refresh, got %d", refresher.calls.Load())
+	}
+	for _, token := range tokens {
+		if token != "access-token-1" {
+			t.Errorf("expected 'access-token-1', got '%s'", token)
+		}
+	}
+}